@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ivmaks/go-verbosity/verbosity"
@@ -72,6 +75,22 @@ EXAMPLES:
     # Delete message from chat
     %[1]s -delete-chat 456 -delete-post 123 -token YOUR_TOKEN
 
+    # Upload a file to chat with a progress bar
+    %[1]s -upload-chat 456 -upload-file ./video.mp4 -token YOUR_TOKEN
+
+    # Schedule a message every weekday at 10:00
+    %[1]s -schedule-chat 456 -schedule-cron "0 10 * * mon-fri" -message "Standup" -token YOUR_TOKEN
+
+    # Schedule a one-shot private message
+    %[1]s -schedule-user 123 -schedule-at "2025-01-31 18:00" -message "Time to report" -token YOUR_TOKEN
+
+    # List and cancel scheduled jobs
+    %[1]s -list-jobs -token YOUR_TOKEN
+    %[1]s -cancel-job 0123456789abcdef -token YOUR_TOKEN
+
+    # Run the scheduler until interrupted
+    %[1]s -run-scheduler -token YOUR_TOKEN
+
     # Use custom API URL
     %[1]s -api-url https://custom-api.example.com  -token YOUR_TOKEN
 `
@@ -127,6 +146,26 @@ func main() {
 	deleteChatID := flag.Int64("delete-chat", 0, "Chat ID for message deletion")
 	deletePostNo := flag.Int64("delete-post", 0, "Post number to delete")
 
+	// File upload flags
+	uploadChatID := flag.Int64("upload-chat", 0, "Chat ID for file upload")
+	uploadFile := flag.String("upload-file", "", "Path of the file to upload")
+	uploadType := flag.String("upload-type", "", "Content type of the uploaded file")
+	uploadLimit := flag.Int64("upload-limit", 0, "Upload bandwidth limit in bytes per second")
+
+	// Scheduler flags
+	jobsFile := flag.String("jobs-file", "jobs.json", "File with scheduled jobs")
+	scheduleChatID := flag.Int64("schedule-chat", 0, "Schedule a message to chat by ID")
+	scheduleUserID := flag.Int64("schedule-user", 0, "Schedule a private message to user by ID")
+	scheduleAt := flag.String("schedule-at", "", "One-shot run time: \"2006-01-02 15:04\" or RFC3339")
+	scheduleCron := flag.String("schedule-cron", "", "Cron expression for a recurring job")
+	scheduleEvery := flag.Duration("schedule-every", 0, "Interval for a recurring job, e.g. 1h")
+	scheduleMissed := flag.String("schedule-missed", "", "Missed run policy: once, skip, all")
+	scheduleTemplate := flag.String("schedule-template", "", "Template name to send instead of -message")
+	templatesDir := flag.String("templates-dir", "", "Directory with message templates")
+	listJobs := flag.Bool("list-jobs", false, "List scheduled jobs")
+	cancelJob := flag.String("cancel-job", "", "Cancel scheduled job by ID")
+	runScheduler := flag.Bool("run-scheduler", false, "Run the scheduler until interrupted")
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Info-Bot for Verbosity API v%s
 
@@ -152,7 +191,25 @@ OPTIONS:
 		os.Exit(0)
 	}
 
-	if *token == "" {
+	// Выполняем запрошенные операции
+	operations := countOperations(
+		*userID, *userName, *chatID, *chatTitle, *orgID, *orgTitle,
+		*listChats, *listOrgs, *listUsers, *getChatMembers, *getChatAdmins,
+		*getOrgMembers, *getOrgAdmins, *topChatsByMembers, *topChatsByPosts,
+		*topOrgsByUsers, *myChats, *favoriteChats, *publicChats, *privateChats,
+		*myOrgs, *adminOrgs, *chatStats, *orgStats,
+		*sendPrivateID, *sendPublicID, *messageText,
+		*updateChatID, *updatePostNo, *updateE2E, *updateReplyNo, *updateQuote,
+		*updateAttachments, *deleteChatID, *deletePostNo, *uploadChatID,
+		*scheduleChatID, *scheduleUserID, *listJobs, *cancelJob, *runScheduler,
+	)
+
+	// Список и отмена заданий работают только с файлом заданий
+	// и не требуют токена и доступа к API
+	localOperations := countOperations(*listJobs, *cancelJob)
+	localOnly := localOperations > 0 && localOperations == operations
+
+	if *token == "" && !localOnly {
 		fmt.Fprintf(os.Stderr, "Error: API token is required. Set VERBOSITY_API_TOKEN environment variable or use -token flag.\n\n")
 		flag.Usage()
 		os.Exit(1)
@@ -168,24 +225,22 @@ OPTIONS:
 	// Создаем клиент
 	client := verbosity.NewClient(config)
 
-	// Проверяем подключение - пытаемся получить список чатов
-	_, err := client.GetChatIDs()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to connect to Verbosity API: %v\n", err)
-		os.Exit(1)
+	if *templatesDir != "" {
+		templates, err := verbosity.LoadTemplatesDir(*templatesDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to load templates: %v\n", err)
+			os.Exit(1)
+		}
+		client.SetTemplates(templates)
 	}
 
-	// Выполняем запрошенные операции
-	operations := countOperations(
-		*userID, *userName, *chatID, *chatTitle, *orgID, *orgTitle,
-		*listChats, *listOrgs, *listUsers, *getChatMembers, *getChatAdmins,
-		*getOrgMembers, *getOrgAdmins, *topChatsByMembers, *topChatsByPosts,
-		*topOrgsByUsers, *myChats, *favoriteChats, *publicChats, *privateChats,
-		*myOrgs, *adminOrgs, *chatStats, *orgStats,
-		*sendPrivateID, *sendPublicID, *messageText,
-		*updateChatID, *updatePostNo, *updateE2E, *updateReplyNo, *updateQuote,
-		*updateAttachments, *deleteChatID, *deletePostNo,
-	)
+	// Проверяем подключение - пытаемся получить список чатов
+	if !localOnly {
+		if _, err := client.GetChatIDs(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to connect to Verbosity API: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	if operations == 0 {
 		fmt.Printf("Info-Bot for Verbosity API v%s\n\n", Version)
@@ -239,6 +294,26 @@ OPTIONS:
 		fmt.Println("  -delete-chat <id>        Chat ID for message deletion")
 		fmt.Println("  -delete-post <no>        Post number to delete")
 		fmt.Println()
+		fmt.Println("File Upload:")
+		fmt.Println("  -upload-chat <id>        Chat ID for file upload")
+		fmt.Println("  -upload-file <path>      Path of the file to upload")
+		fmt.Println("  -upload-type <type>      Content type of the uploaded file")
+		fmt.Println("  -upload-limit <bytes>    Upload bandwidth limit in bytes per second")
+		fmt.Println()
+		fmt.Println("Scheduled Messages:")
+		fmt.Println("  -schedule-chat <id>      Schedule a message to chat by ID")
+		fmt.Println("  -schedule-user <id>      Schedule a private message to user by ID")
+		fmt.Println("  -schedule-at <time>      One-shot run time (\"2006-01-02 15:04\" or RFC3339)")
+		fmt.Println("  -schedule-cron <expr>    Cron expression for a recurring job")
+		fmt.Println("  -schedule-every <dur>    Interval for a recurring job, e.g. 1h")
+		fmt.Println("  -schedule-missed <mode>  Missed run policy: once, skip, all")
+		fmt.Println("  -schedule-template <n>   Template name to send instead of -message")
+		fmt.Println("  -list-jobs               List scheduled jobs")
+		fmt.Println("  -cancel-job <id>         Cancel scheduled job by ID")
+		fmt.Println("  -run-scheduler           Run the scheduler until interrupted")
+		fmt.Println("  -jobs-file <path>        File with scheduled jobs (default: jobs.json)")
+		fmt.Println("  -templates-dir <dir>     Directory with message templates")
+		fmt.Println()
 		fmt.Println("Options:")
 		fmt.Println("  -api-url <url>   API URL (default: https://api.verbosity.io)")
 		fmt.Println("  -file-url <url>  File URL (default: https://file.verbosity.io)")
@@ -292,6 +367,21 @@ OPTIONS:
 		UpdateAttachments: *updateAttachments,
 		DeleteChatID:      *deleteChatID,
 		DeletePostNo:      *deletePostNo,
+		UploadChatID:      *uploadChatID,
+		UploadFile:        *uploadFile,
+		UploadType:        *uploadType,
+		UploadLimit:       *uploadLimit,
+		JobsFile:          *jobsFile,
+		ScheduleChatID:    *scheduleChatID,
+		ScheduleUserID:    *scheduleUserID,
+		ScheduleAt:        *scheduleAt,
+		ScheduleCron:      *scheduleCron,
+		ScheduleEvery:     *scheduleEvery,
+		ScheduleMissed:    *scheduleMissed,
+		ScheduleTemplate:  *scheduleTemplate,
+		ListJobs:          *listJobs,
+		CancelJob:         *cancelJob,
+		RunScheduler:      *runScheduler,
 		OutputMode:        *outputMode,
 	})
 
@@ -336,6 +426,21 @@ type OperationsConfig struct {
 	UpdateAttachments string
 	DeleteChatID      int64
 	DeletePostNo      int64
+	UploadChatID      int64
+	UploadFile        string
+	UploadType        string
+	UploadLimit       int64
+	JobsFile          string
+	ScheduleChatID    int64
+	ScheduleUserID    int64
+	ScheduleAt        string
+	ScheduleCron      string
+	ScheduleEvery     time.Duration
+	ScheduleMissed    string
+	ScheduleTemplate  string
+	ListJobs          bool
+	CancelJob         string
+	RunScheduler      bool
 	OutputMode        string
 }
 
@@ -599,6 +704,121 @@ func processOperations(client *verbosity.Client, config *verbosity.Config, ops *
 			printDeleteMessageResponse(response, ops.OutputMode)
 		})
 	}
+
+	// File upload operations
+	if ops.UploadChatID != 0 && ops.UploadFile != "" {
+		executeWithErrorHandling("uploading file", func() (interface{}, error) {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			progress := newProgressBar(os.Stderr)
+			defer progress.Done()
+
+			return client.UploadFile(ops.UploadChatID, ops.UploadFile, &verbosity.UploadOptions{
+				Context:        ctx,
+				Progress:       progress.Update,
+				ContentType:    ops.UploadType,
+				BytesPerSecond: ops.UploadLimit,
+			})
+		}, func(result interface{}) {
+			fmt.Printf("File uploaded to chat %d:\n", ops.UploadChatID)
+			printData(map[string]interface{}{"guid": result.(*verbosity.FileUploadResponse).GUID}, ops.OutputMode)
+		})
+	}
+
+	// Scheduler operations
+	if ops.ScheduleChatID != 0 || ops.ScheduleUserID != 0 || ops.ListJobs || ops.CancelJob != "" || ops.RunScheduler {
+		processSchedulerOperations(client, ops)
+	}
+}
+
+func processSchedulerOperations(client *verbosity.Client, ops *OperationsConfig) {
+	store, err := verbosity.NewFileStore(ops.JobsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening jobs file: %v\n", err)
+		return
+	}
+	scheduler := verbosity.NewScheduler(client, store)
+
+	if ops.ScheduleChatID != 0 || ops.ScheduleUserID != 0 {
+		executeWithErrorHandling("scheduling job", func() (interface{}, error) {
+			job, err := buildJob(ops)
+			if err != nil {
+				return nil, err
+			}
+			return scheduler.Schedule(job)
+		}, func(result interface{}) {
+			fmt.Println("Job scheduled:")
+			printJobs([]*verbosity.Job{result.(*verbosity.Job)}, ops.OutputMode)
+		})
+	}
+
+	if ops.CancelJob != "" {
+		executeWithErrorHandling("canceling job", func() (interface{}, error) {
+			return nil, scheduler.Cancel(ops.CancelJob)
+		}, func(result interface{}) {
+			fmt.Printf("Job %s canceled\n", ops.CancelJob)
+		})
+	}
+
+	if ops.ListJobs {
+		executeWithErrorHandling("listing jobs", func() (interface{}, error) {
+			return scheduler.List()
+		}, func(result interface{}) {
+			printJobs(result.([]*verbosity.Job), ops.OutputMode)
+		})
+	}
+
+	if ops.RunScheduler {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		scheduler.OnError = func(job *verbosity.Job, err error) {
+			if job != nil {
+				fmt.Fprintf(os.Stderr, "Error running job %s: %v\n", job.ID, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error running scheduler: %v\n", err)
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "Scheduler started with jobs from %s, press Ctrl+C to stop\n", ops.JobsFile)
+		scheduler.Run(ctx, time.Second*30)
+	}
+}
+
+// buildJob creates a job from the scheduling flags
+func buildJob(ops *OperationsConfig) (verbosity.Job, error) {
+	job := verbosity.Job{
+		ChatID:   ops.ScheduleChatID,
+		UserID:   ops.ScheduleUserID,
+		Text:     ops.MessageText,
+		Cron:     ops.ScheduleCron,
+		Interval: ops.ScheduleEvery,
+		Missed:   verbosity.MissedRunPolicy(ops.ScheduleMissed),
+	}
+
+	switch {
+	case ops.ScheduleTemplate != "":
+		job.Kind = verbosity.JobTemplate
+		job.Template = ops.ScheduleTemplate
+	case ops.ScheduleChatID != 0:
+		job.Kind = verbosity.JobMessage
+	default:
+		job.Kind = verbosity.JobPrivateMessage
+	}
+
+	if ops.ScheduleAt != "" {
+		at, err := time.ParseInLocation("2006-01-02 15:04", ops.ScheduleAt, time.Local)
+		if err != nil {
+			at, err = time.Parse(time.RFC3339, ops.ScheduleAt)
+		}
+		if err != nil {
+			return job, fmt.Errorf("invalid -schedule-at value %q", ops.ScheduleAt)
+		}
+		job.At = at
+	}
+
+	return job, nil
 }
 
 // Вспомогательные функции для вывода
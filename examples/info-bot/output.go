@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ivmaks/go-verbosity/verbosity"
@@ -257,6 +259,41 @@ func printMemberIDs(title string, ids []int64, mode string) {
 	fmt.Println()
 }
 
+func printJobs(jobs []*verbosity.Job, mode string) {
+	switch mode {
+	case "json":
+		printJSONCompact(jobs)
+	case "json-pretty":
+		printJSONPretty(jobs)
+	default:
+		if len(jobs) == 0 {
+			fmt.Println("No scheduled jobs")
+			return
+		}
+		fmt.Printf("Scheduled jobs (%d):\n", len(jobs))
+		for _, job := range jobs {
+			schedule := "once"
+			switch {
+			case job.Cron != "":
+				schedule = "cron " + job.Cron
+			case job.Interval != 0:
+				schedule = "every " + job.Interval.String()
+			}
+
+			target := fmt.Sprintf("chat %d", job.ChatID)
+			if job.ChatID == 0 {
+				target = fmt.Sprintf("user %d", job.UserID)
+			}
+
+			fmt.Printf("  %s  %s  %-20s  %s  %s\n", job.ID, job.Next.Format("2006-01-02 15:04"), schedule, target, job.Kind)
+			if job.LastError != "" {
+				fmt.Printf("      last error: %s\n", job.LastError)
+			}
+		}
+	}
+	fmt.Println()
+}
+
 func printStats(stats map[string]interface{}, mode string) {
 	switch mode {
 	case "json":
@@ -283,3 +320,54 @@ func printJSONPretty(data interface{}) {
 	encoder.SetEscapeHTML(false)
 	encoder.Encode(data)
 }
+
+// progressBar draws an upload progress bar on a terminal line.
+type progressBar struct {
+	out     io.Writer
+	start   time.Time
+	percent int
+	drawn   bool
+}
+
+func newProgressBar(out io.Writer) *progressBar {
+	return &progressBar{out: out, start: time.Now(), percent: -1}
+}
+
+// Update redraws the bar when the percentage changes.
+func (p *progressBar) Update(sent, total int64) {
+	if total <= 0 {
+		return
+	}
+	percent := int(sent * 100 / total)
+	if percent == p.percent {
+		return
+	}
+	p.percent = percent
+
+	const width = 30
+	filled := percent * width / 100
+	speed := float64(sent) / time.Since(p.start).Seconds()
+	fmt.Fprintf(p.out, "\r[%s%s] %3d%% %s / %s %s/s ", strings.Repeat("#", filled), strings.Repeat(".", width-filled),
+		percent, formatBytes(sent), formatBytes(total), formatBytes(int64(speed)))
+	p.drawn = true
+}
+
+// Done ends the progress bar line.
+func (p *progressBar) Done() {
+	if p.drawn {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
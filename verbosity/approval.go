@@ -0,0 +1,476 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Actions used by approval buttons.
+const (
+	ApprovalApproveAction = "approval.approve"
+	ApprovalRejectAction  = "approval.reject"
+)
+
+const approvalKeyPrefix = "approval:"
+
+// DefaultApprovalRetention is how long finished approvals are kept when
+// Approvals.Retention is zero.
+const DefaultApprovalRetention = 24 * time.Hour
+
+// ApprovalStatus is the state of an approval.
+type ApprovalStatus string
+
+// Approval statuses.
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+	ApprovalExpired  ApprovalStatus = "expired"
+)
+
+// ApprovalDecision is a decision of a single approver.
+type ApprovalDecision struct {
+	UserID     int64     `json:"user_id"`
+	UniqueName string    `json:"unique_name,omitempty"`
+	Approve    bool      `json:"approve"`
+	Time       time.Time `json:"time"`
+}
+
+// ApprovalRequest describes an approval to create.
+type ApprovalRequest struct {
+	// Kind selects the outcome handler registered with OnOutcome.
+	Kind   string
+	ChatID int64
+	Text   string
+	// Approvers limits who may decide. Chat admins may also decide when
+	// AdminsOnly is set. If both are empty, any chat member may decide.
+	Approvers  []int64
+	AdminsOnly bool
+	// Quorum is the number of approvals needed. Zero means one.
+	// A single rejection rejects the request.
+	Quorum int
+	// Deadline after which the request expires. Zero means no deadline.
+	Deadline time.Time
+	// Data is stored with the approval and passed back to the handler.
+	Data map[string]string
+}
+
+// Approval is the stored state of an approval.
+type Approval struct {
+	ID         string             `json:"id"`
+	Kind       string             `json:"kind"`
+	ChatID     int64              `json:"chat_id"`
+	PostNo     int64              `json:"post_no"`
+	Text       string             `json:"text"`
+	Approvers  []int64            `json:"approvers,omitempty"`
+	AdminsOnly bool               `json:"admins_only,omitempty"`
+	Quorum     int                `json:"quorum"`
+	Deadline   time.Time          `json:"deadline,omitempty"`
+	Data       map[string]string  `json:"data,omitempty"`
+	Status     ApprovalStatus     `json:"status"`
+	Decisions  []ApprovalDecision `json:"decisions,omitempty"`
+	Created    time.Time          `json:"created"`
+	Finished   time.Time          `json:"finished,omitempty"`
+	// Handled is set once the post shows the outcome and the outcome
+	// handler has succeeded.
+	Handled bool `json:"handled,omitempty"`
+}
+
+// Approvals returns the number of positive decisions.
+func (a *Approval) Approvals() int {
+	count := 0
+	for _, decision := range a.Decisions {
+		if decision.Approve {
+			count++
+		}
+	}
+	return count
+}
+
+func (a *Approval) expiryState() expiryState {
+	return expiryState{
+		ID:       a.ID,
+		Open:     a.Status == ApprovalPending,
+		Deadline: a.Deadline,
+		Finished: a.Finished,
+		Done:     a.Handled,
+	}
+}
+
+// decided checks if the user has already decided.
+func (a *Approval) decided(userID int64) bool {
+	for _, decision := range a.Decisions {
+		if decision.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalHandler is called once an approval is approved, rejected or expired.
+// If it returns an error, ExpireDue calls it again.
+type ApprovalHandler func(approval *Approval) error
+
+// Approvals manages approval posts with Approve and Reject buttons.
+//
+// Register the button handlers with Attach and call Run to expire
+// approvals after their deadline, retry failed outcomes and delete old
+// finished approvals:
+//
+//	approvals := verbosity.NewApprovals(client, verbosity.NewMemoryStore())
+//	approvals.OnOutcome("deploy", func(a *verbosity.Approval) error { ... })
+//	approvals.Attach(router)
+//	go approvals.Run(ctx, time.Minute)
+type Approvals struct {
+	// ApproveLabel and RejectLabel are the titles of the buttons.
+	ApproveLabel string
+	RejectLabel  string
+	// Retention is how long finished approvals are kept,
+	// DefaultApprovalRetention if zero.
+	Retention time.Duration
+	// OnError is called for errors in Run. It may be nil.
+	OnError func(err error)
+
+	client *Client
+	store  Store
+	now    func() time.Time
+
+	// mu serializes state changes of approvals. It is not held during
+	// API calls or while outcome handlers run.
+	mu       sync.Mutex
+	handlers map[string]ApprovalHandler
+	// expiry delivers the outcomes, reserving each delivery under mu
+	expiry expiryLoop
+	// posts serializes the post updates of each approval
+	posts keyLocks
+}
+
+// NewApprovals creates an approval manager that keeps state in the store.
+func NewApprovals(client *Client, store Store) *Approvals {
+	a := &Approvals{
+		ApproveLabel: "Approve",
+		RejectLabel:  "Reject",
+		client:       client,
+		store:        store,
+		now:          time.Now,
+		handlers:     make(map[string]ApprovalHandler),
+	}
+	a.expiry = expiryLoop{
+		store:   store,
+		prefix:  approvalKeyPrefix,
+		newItem: func() expirable { return &Approval{} },
+		finish: func(item expirable) error {
+			approval := item.(*Approval)
+			if err := a.finish(approval, ApprovalExpired); err != nil {
+				return fmt.Errorf("failed to expire approval %s: %w", approval.ID, err)
+			}
+			return nil
+		},
+		followUp: func(item expirable) error {
+			approval := item.(*Approval)
+			if err := a.deliver(approval); err != nil {
+				return fmt.Errorf("failed to deliver approval %s: %w", approval.ID, err)
+			}
+			return nil
+		},
+		mu: &a.mu,
+	}
+	return a
+}
+
+// OnOutcome registers the handler for approvals of the kind.
+func (a *Approvals) OnOutcome(kind string, handler ApprovalHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.handlers[kind] = handler
+}
+
+// Attach registers the approval button handlers in the router.
+func (a *Approvals) Attach(router *Router) {
+	router.HandleAction(ApprovalApproveAction, a.HandleApprove)
+	router.HandleAction(ApprovalRejectAction, a.HandleReject)
+}
+
+// Create posts an approval request to the chat.
+func (a *Approvals) Create(req ApprovalRequest) (*Approval, error) {
+	if req.Text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	approval := &Approval{
+		ID:         newID(),
+		Kind:       req.Kind,
+		ChatID:     req.ChatID,
+		Text:       req.Text,
+		Approvers:  req.Approvers,
+		AdminsOnly: req.AdminsOnly,
+		Quorum:     req.Quorum,
+		Deadline:   req.Deadline,
+		Data:       req.Data,
+		Status:     ApprovalPending,
+		Created:    a.now(),
+	}
+	if approval.Quorum <= 0 {
+		approval.Quorum = 1
+	}
+
+	response, err := a.client.SendRich(req.ChatID, a.Render(approval))
+	if err != nil {
+		return nil, err
+	}
+	approval.PostNo = response.PostNo
+
+	if err := putJSON(a.store, approvalKeyPrefix+approval.ID, approval); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// Get returns the stored approval.
+func (a *Approvals) Get(id string) (*Approval, error) {
+	var approval Approval
+	if err := getJSON(a.store, approvalKeyPrefix+id, &approval); err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// Render renders the approval post.
+func (a *Approvals) Render(approval *Approval) *RichMessage {
+	msg := NewRichMessage().Text(approval.Text + "\n\n")
+
+	switch approval.Status {
+	case ApprovalApproved:
+		msg.Bold("Approved")
+	case ApprovalRejected:
+		msg.Bold("Rejected")
+	case ApprovalExpired:
+		msg.Bold("Expired")
+	default:
+		msg.Text(fmt.Sprintf("Approvals: %d of %d", approval.Approvals(), approval.Quorum))
+		if !approval.Deadline.IsZero() {
+			msg.Text(", until " + approval.Deadline.Format("02.01.2006 15:04"))
+		}
+	}
+
+	for _, decision := range approval.Decisions {
+		msg.Text("\n")
+		if decision.Approve {
+			msg.Text("+ ")
+		} else {
+			msg.Text("- ")
+		}
+		msg.Mention(decision.UserID, decision.UniqueName)
+	}
+
+	if approval.Status == ApprovalPending {
+		params := map[string]string{"approval": approval.ID}
+		msg.Text("\n")
+		msg.Action(a.ApproveLabel, ApprovalApproveAction, params)
+		msg.Text(" ")
+		msg.Action(a.RejectLabel, ApprovalRejectAction, params)
+	}
+
+	return msg
+}
+
+// HandleApprove records an approval.
+func (a *Approvals) HandleApprove(req *ActionRequest) error {
+	return a.decide(req, true)
+}
+
+// HandleReject records a rejection.
+func (a *Approvals) HandleReject(req *ActionRequest) error {
+	return a.decide(req, false)
+}
+
+// decide records the decision of the user and delivers the outcome if the
+// decision finishes the approval.
+func (a *Approvals) decide(req *ActionRequest, approve bool) error {
+	finished, err := a.record(req, approve)
+	if err != nil || finished == nil {
+		return err
+	}
+	return a.deliver(finished)
+}
+
+// record records the decision of the user and returns the approval if it
+// is finished. Decisions of users who may not decide, repeated decisions
+// and buttons of finished approvals are ignored.
+//
+// The API calls are made without holding a.mu: the approver checks before
+// the decision is recorded, the post update after it is persisted.
+func (a *Approvals) record(req *ActionRequest, approve bool) (*Approval, error) {
+	id := req.Params["approval"]
+	approval, err := a.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if approval.ChatID != req.ChatID || approval.Status != ApprovalPending || approval.decided(req.UserID) {
+		return nil, nil
+	}
+
+	var decision *ApprovalDecision
+	if approval.Deadline.IsZero() || a.now().Before(approval.Deadline) {
+		allowed, err := a.mayDecide(approval, req.UserID)
+		if err != nil || !allowed {
+			return nil, err
+		}
+		decision = &ApprovalDecision{UserID: req.UserID, Approve: approve}
+		if user, err := a.client.GetUserByID(req.UserID); err == nil {
+			decision.UniqueName = user.UniqueName
+		}
+	}
+
+	approval, finished, err := a.apply(id, req.ChatID, decision)
+	if err != nil || approval == nil {
+		return nil, err
+	}
+	if finished {
+		return approval, nil
+	}
+	return nil, a.refresh(id)
+}
+
+// apply records the decision in the stored approval, or expires it if the
+// deadline has passed or the decision is nil. It returns the approval and
+// whether it is finished, or nil if the decision no longer applies.
+func (a *Approvals) apply(id string, chatID int64, decision *ApprovalDecision) (*Approval, bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	approval, err := a.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if approval.ChatID != chatID || approval.Status != ApprovalPending {
+		return nil, false, nil
+	}
+	if decision == nil || (!approval.Deadline.IsZero() && !a.now().Before(approval.Deadline)) {
+		return approval, true, a.finish(approval, ApprovalExpired)
+	}
+	if approval.decided(decision.UserID) {
+		return nil, false, nil
+	}
+
+	decision.Time = a.now()
+	approval.Decisions = append(approval.Decisions, *decision)
+
+	switch {
+	case !decision.Approve:
+		return approval, true, a.finish(approval, ApprovalRejected)
+	case approval.Approvals() >= approval.Quorum:
+		return approval, true, a.finish(approval, ApprovalApproved)
+	}
+	if err := putJSON(a.store, approvalKeyPrefix+approval.ID, approval); err != nil {
+		return nil, false, err
+	}
+	return approval, false, nil
+}
+
+// refresh updates the post of a pending approval with its stored state.
+// Updates of one approval run one at a time, so the post never goes back
+// to an older state.
+func (a *Approvals) refresh(id string) error {
+	unlock := a.posts.lock(id)
+	defer unlock()
+
+	a.mu.Lock()
+	approval, err := a.Get(id)
+	a.mu.Unlock()
+	if err != nil || approval.Status != ApprovalPending {
+		return err
+	}
+
+	if _, err := a.client.editMessage(approval.ChatID, approval.PostNo, a.Render(approval).String()); err != nil {
+		return fmt.Errorf("failed to update approval post: %w", err)
+	}
+	return nil
+}
+
+// mayDecide checks if the user may decide on the approval.
+func (a *Approvals) mayDecide(approval *Approval, userID int64) (bool, error) {
+	for _, id := range approval.Approvers {
+		if id == userID {
+			return true, nil
+		}
+	}
+	if approval.AdminsOnly {
+		return a.client.IsChatAdmin(approval.ChatID, userID)
+	}
+	return len(approval.Approvers) == 0, nil
+}
+
+// finish saves the final status and reserves the delivery of the outcome
+// for the caller. The caller holds a.mu and calls deliver after releasing it.
+func (a *Approvals) finish(approval *Approval, status ApprovalStatus) error {
+	approval.Status = status
+	approval.Finished = a.now()
+
+	if err := putJSON(a.store, approvalKeyPrefix+approval.ID, approval); err != nil {
+		return err
+	}
+	a.expiry.reserve(approval.ID)
+	return nil
+}
+
+// deliver updates the post of a finished approval and calls the outcome
+// handler. The approval is marked handled only when both succeed, so that
+// ExpireDue retries a failed delivery. The caller must have reserved the
+// delivery and must not hold a.mu.
+func (a *Approvals) deliver(approval *Approval) error {
+	a.mu.Lock()
+	handler := a.handlers[approval.Kind]
+	a.mu.Unlock()
+
+	err := a.deliverOutcome(approval, handler)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expiry.release(approval.ID)
+	if err != nil {
+		return err
+	}
+	approval.Handled = true
+	return putJSON(a.store, approvalKeyPrefix+approval.ID, approval)
+}
+
+func (a *Approvals) deliverOutcome(approval *Approval, handler ApprovalHandler) error {
+	if _, err := a.client.editMessage(approval.ChatID, approval.PostNo, a.Render(approval).String()); err != nil {
+		return fmt.Errorf("failed to update approval post: %w", err)
+	}
+	if handler != nil {
+		return handler(approval)
+	}
+	return nil
+}
+
+// ExpireDue expires pending approvals past their deadline, retries the
+// outcomes that failed to be delivered and deletes finished approvals
+// older than Retention.
+func (a *Approvals) ExpireDue() error {
+	retention := a.Retention
+	if retention <= 0 {
+		retention = DefaultApprovalRetention
+	}
+	return a.expiry.process(a.now(), retention)
+}
+
+// Run calls ExpireDue every interval until the context is canceled.
+func (a *Approvals) Run(ctx context.Context, interval time.Duration) error {
+	return runEvery(ctx, interval, a.ExpireDue, func(err error) {
+		if a.OnError != nil {
+			a.OnError(err)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package verbosity
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApprovalsQuorum(t *testing.T) {
+	chat, client := newFakeChat(t)
+	chat.users[1] = User{ID: 1, UniqueName: "alice"}
+	chat.users[2] = User{ID: 2, UniqueName: "bob"}
+
+	approvals := NewApprovals(client, NewMemoryStore())
+
+	var outcomes []*Approval
+	approvals.OnOutcome("deploy", func(approval *Approval) error {
+		outcomes = append(outcomes, approval)
+		return nil
+	})
+
+	router := NewRouter("mybot")
+	approvals.Attach(router)
+
+	approval, err := approvals.Create(ApprovalRequest{
+		Kind:      "deploy",
+		ChatID:    10,
+		Text:      "Deploy v1.2 to prod?",
+		Approvers: []int64{1, 2},
+		Quorum:    2,
+		Data:      map[string]string{"version": "v1.2"},
+	})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+	if post := chat.post(approval.PostNo); !contains(post, "Approvals: 0 of 2") || !contains(post, "bot://approval.approve?") {
+		t.Errorf("Unexpected approval post:\n%s", post)
+	}
+
+	click := func(userID int64, action string) {
+		err := router.HandleActionRequest(&ActionRequest{UserID: userID, ChatID: 10, PostNo: approval.PostNo,
+			Action: action, Params: map[string]string{"approval": approval.ID}})
+		if err != nil {
+			t.Fatalf("Decision should not return error: %v", err)
+		}
+	}
+
+	click(3, ApprovalApproveAction) // not an approver
+	click(1, ApprovalApproveAction)
+	click(1, ApprovalApproveAction) // repeated decision
+
+	if post := chat.post(approval.PostNo); !contains(post, "Approvals: 1 of 2") || !contains(post, "+ @alice") {
+		t.Errorf("Unexpected approval post:\n%s", post)
+	}
+	if len(outcomes) != 0 {
+		t.Fatalf("Outcome should wait for the quorum, got %d", len(outcomes))
+	}
+
+	click(2, ApprovalApproveAction)
+
+	if len(outcomes) != 1 || outcomes[0].Status != ApprovalApproved || outcomes[0].Data["version"] != "v1.2" {
+		t.Fatalf("Expected approved outcome, got %+v", outcomes)
+	}
+	post := chat.post(approval.PostNo)
+	if !contains(post, "**Approved**") || !contains(post, "+ @bob") || contains(post, "bot://") {
+		t.Errorf("Unexpected finished post:\n%s", post)
+	}
+
+	click(1, ApprovalRejectAction)
+	if len(outcomes) != 1 {
+		t.Errorf("Finished approval should ignore decisions, got %d outcomes", len(outcomes))
+	}
+}
+
+func TestApprovalsAdminReject(t *testing.T) {
+	chat, client := newFakeChat(t)
+	chat.chats[10] = Chat{ID: 10, AdminIDs: []int64{5}}
+
+	approvals := NewApprovals(client, NewMemoryStore())
+
+	var status ApprovalStatus
+	approvals.OnOutcome("access", func(approval *Approval) error {
+		status = approval.Status
+		return nil
+	})
+
+	approval, err := approvals.Create(ApprovalRequest{Kind: "access", ChatID: 10, Text: "Grant access?", AdminsOnly: true})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+
+	reject := func(userID int64) {
+		approvals.HandleReject(&ActionRequest{UserID: userID, ChatID: 10, PostNo: approval.PostNo,
+			Action: ApprovalRejectAction, Params: map[string]string{"approval": approval.ID}})
+	}
+
+	reject(6)
+	if status != "" {
+		t.Fatalf("Non-admin should not decide, got status %s", status)
+	}
+
+	reject(5)
+	if status != ApprovalRejected {
+		t.Errorf("Expected rejected status, got '%s'", status)
+	}
+	if post := chat.post(approval.PostNo); !contains(post, "**Rejected**") || !contains(post, "- @5") {
+		t.Errorf("Unexpected finished post:\n%s", post)
+	}
+}
+
+func TestApprovalsExpire(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	approvals := NewApprovals(client, NewMemoryStore())
+	approvals.now = func() time.Time { return now }
+
+	var status ApprovalStatus
+	approvals.OnOutcome("", func(approval *Approval) error {
+		status = approval.Status
+		return nil
+	})
+
+	approval, err := approvals.Create(ApprovalRequest{ChatID: 10, Text: "Merge?", Deadline: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+
+	if err := approvals.ExpireDue(); err != nil || status != "" {
+		t.Fatalf("Approval should not expire before the deadline, got %s (%v)", status, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := approvals.ExpireDue(); err != nil {
+		t.Fatalf("ExpireDue should not return error: %v", err)
+	}
+	if status != ApprovalExpired {
+		t.Errorf("Expected expired status, got '%s'", status)
+	}
+	if post := chat.post(approval.PostNo); !contains(post, "**Expired**") {
+		t.Errorf("Unexpected expired post:\n%s", post)
+	}
+}
+
+func TestApprovalsRetryFailedOutcome(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	approvals := NewApprovals(client, NewMemoryStore())
+	approvals.now = func() time.Time { return now }
+
+	calls := 0
+	approvals.OnOutcome("deploy", func(approval *Approval) error {
+		calls++
+		// Handlers may use the manager
+		approvals.OnOutcome("other", nil)
+		if calls == 1 {
+			return errors.New("deploy failed")
+		}
+		return nil
+	})
+
+	approval, err := approvals.Create(ApprovalRequest{Kind: "deploy", ChatID: 10, Text: "Deploy?"})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+	approve := func() error {
+		return approvals.HandleApprove(&ActionRequest{UserID: 1, ChatID: 10, PostNo: approval.PostNo,
+			Action: ApprovalApproveAction, Params: map[string]string{"approval": approval.ID}})
+	}
+
+	chat.setFailing(true)
+	if err := approve(); err == nil {
+		t.Fatal("Expected error when the post cannot be updated")
+	}
+	chat.setFailing(false)
+
+	if err := approvals.ExpireDue(); err == nil || calls != 1 {
+		t.Fatalf("Expected the outcome to be retried and fail, got %d calls (%v)", calls, err)
+	}
+	if err := approvals.ExpireDue(); err != nil || calls != 2 {
+		t.Fatalf("Expected the outcome to be retried, got %d calls (%v)", calls, err)
+	}
+	if post := chat.post(approval.PostNo); !contains(post, "**Approved**") {
+		t.Errorf("Unexpected finished post:\n%s", post)
+	}
+
+	approvals.ExpireDue()
+	if calls != 2 {
+		t.Errorf("Handled outcome should not be retried, got %d calls", calls)
+	}
+
+	now = now.Add(DefaultApprovalRetention)
+	approvals.ExpireDue()
+	if _, err := approvals.Get(approval.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the old approval to be deleted, got %v", err)
+	}
+}
+
+func TestApprovalsKeepDecisionWhenPostUpdateFails(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	approvals := NewApprovals(client, NewMemoryStore())
+	approval, err := approvals.Create(ApprovalRequest{Kind: "deploy", ChatID: 10, Text: "Deploy?", Quorum: 2})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+	approve := func(userID int64) error {
+		return approvals.HandleApprove(&ActionRequest{UserID: userID, ChatID: 10, PostNo: approval.PostNo,
+			Action: ApprovalApproveAction, Params: map[string]string{"approval": approval.ID}})
+	}
+
+	chat.setFailing(true)
+	if err := approve(1); err == nil {
+		t.Fatal("Expected error when the post cannot be updated")
+	}
+	chat.setFailing(false)
+
+	stored, err := approvals.Get(approval.ID)
+	if err != nil || stored.Approvals() != 1 {
+		t.Fatalf("Expected the decision to be stored, got %+v (%v)", stored, err)
+	}
+
+	if err := approve(1); err != nil {
+		t.Fatalf("Repeated decision should not return error: %v", err)
+	}
+	if err := approve(2); err != nil {
+		t.Fatalf("Decision should not return error: %v", err)
+	}
+	if post := chat.post(approval.PostNo); !contains(post, "**Approved**") {
+		t.Errorf("Unexpected finished post:\n%s", post)
+	}
+}
@@ -0,0 +1,238 @@
+package verbosity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileSource is a file to upload and attach to a message. Set either Path,
+// or Reader with Size.
+type FileSource struct {
+	// Name is the file name. Defaults to the base name of Path.
+	Name string
+	// Path is a local file to upload.
+	Path string
+	// Reader and Size provide the file data if Path is empty.
+	Reader io.Reader
+	Size   int64
+	// ContentType is the content type, application/octet-stream if empty.
+	ContentType string
+}
+
+// FileFromPath returns a source for a local file.
+func FileFromPath(path string) FileSource {
+	return FileSource{Path: path}
+}
+
+// FileFromBytes returns a source for data in memory.
+func FileFromBytes(name string, data []byte) FileSource {
+	return FileSource{Name: name, Reader: bytes.NewReader(data), Size: int64(len(data))}
+}
+
+// FileFromReader returns a source reading size bytes from the reader.
+func FileFromReader(name string, reader io.Reader, size int64) FileSource {
+	return FileSource{Name: name, Reader: reader, Size: size}
+}
+
+// name returns the file name.
+func (f FileSource) name() string {
+	if f.Name == "" && f.Path != "" {
+		return filepath.Base(f.Path)
+	}
+	return f.Name
+}
+
+// upload uploads the file to the chat.
+func (f FileSource) upload(ctx context.Context, c *Client, chatID int64) (string, error) {
+	name, reader, size := f.name(), f.Reader, f.Size
+	if f.Path != "" {
+		file, err := os.Open(f.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open file: %w", err)
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return "", fmt.Errorf("failed to get file info: %w", err)
+		}
+		reader, size = file, info.Size()
+	}
+	if reader == nil {
+		return "", fmt.Errorf("file %q has no path or reader", name)
+	}
+
+	response, err := c.UploadFileData(chatID, reader, size, name, &UploadOptions{Context: ctx, ContentType: f.ContentType})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	return response.GUID, nil
+}
+
+// uploadFiles uploads the files to the chat concurrently and returns their
+// GUIDs in order. The first failure cancels the other uploads.
+func (c *Client) uploadFiles(ctx context.Context, chatID int64, files []FileSource) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	guids := make([]string, len(files))
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i := range files {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			guids[i], errs[i] = files[i].upload(ctx, c, chatID)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Report the failures, not the uploads canceled because of them
+	var failed []error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return nil, errors.Join(failed...)
+	}
+	// The caller's context was canceled
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return guids, nil
+}
+
+// filesText returns the message text, or the file names if it is empty.
+func filesText(text string, files []FileSource) string {
+	if text != "" {
+		return text
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// attachFiles attaches the uploaded files to the first post of a message
+// sent with the text. If attaching fails, the posts of the message are
+// deleted, so no message without its files is left in the chat; deleted
+// reports whether that succeeded.
+func (c *Client) attachFiles(chatID int64, postNos []int64, text string, guids []string) (deleted bool, err error) {
+	firstPart := SplitMessage(text, c.maxMessageLength())[0]
+	_, err = c.UpdateMessageWithAttachments(chatID, postNos[0], firstPart, guids)
+	if err == nil {
+		return false, nil
+	}
+
+	errs := []error{fmt.Errorf("failed to attach files: %w", err)}
+	for _, postNo := range postNos {
+		if _, err := c.DeleteMessage(chatID, postNo); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete post %d: %w", postNo, err))
+		}
+	}
+	return len(errs) == 1, errors.Join(errs...)
+}
+
+// SendMessageWithFiles uploads the files concurrently, sends the message
+// and attaches the files to it. If the text is empty, the file names are
+// sent instead.
+//
+// The API attaches files by updating a sent post, so the message is sent
+// first and the files are attached to it.
+//
+// If any upload fails, the other uploads are canceled and no message is sent.
+// If attaching fails, the message is deleted and only the error is returned;
+// if it cannot be deleted either, the message is returned with the error.
+// The API offers no way to delete uploaded files, so the files already
+// uploaded when a step fails are left unattached on the server.
+//
+// API: POST /bot/message, PUT /msg/post/{chat_id}/{post_no}
+func (c *Client) SendMessageWithFiles(ctx context.Context, chatID int64, text string, files ...FileSource) (*MessageResponse, error) {
+	if chatID == 0 {
+		return nil, fmt.Errorf("chat_id cannot be zero")
+	}
+	if text == "" && len(files) == 0 {
+		return nil, fmt.Errorf("text and files cannot both be empty")
+	}
+
+	guids, err := c.uploadFiles(ctx, chatID, files)
+	if err != nil {
+		return nil, err
+	}
+
+	text = filesText(text, files)
+	response, err := c.SendMessage(chatID, text, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(guids) == 0 {
+		return response, nil
+	}
+	if deleted, err := c.attachFiles(chatID, response.PostNos, text, guids); err != nil {
+		if deleted {
+			return nil, err
+		}
+		return response, err
+	}
+	return response, nil
+}
+
+// SendPrivateMessageWithFiles uploads the files concurrently to the private
+// chat with the user, sends the private message and attaches the files to
+// it. If the text is empty, the file names are sent instead.
+//
+// Failures are handled as in SendMessageWithFiles.
+//
+// API: POST /msg/post/private, PUT /msg/post/{chat_id}/{post_no}
+func (c *Client) SendPrivateMessageWithFiles(ctx context.Context, userID int64, text string, files ...FileSource) (*PrivateMessageResponse, error) {
+	if userID == 0 {
+		return nil, fmt.Errorf("user_id cannot be zero")
+	}
+	if text == "" && len(files) == 0 {
+		return nil, fmt.Errorf("text and files cannot both be empty")
+	}
+
+	var chatID int64
+	var guids []string
+	if len(files) > 0 {
+		chat, err := c.GetOrCreatePrivateChat(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get private chat: %w", err)
+		}
+		chatID = chat.ID
+		if guids, err = c.uploadFiles(ctx, chatID, files); err != nil {
+			return nil, err
+		}
+	}
+
+	text = filesText(text, files)
+	response, err := c.SendPrivateMessageByID(userID, text, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(guids) == 0 {
+		return response, nil
+	}
+	if deleted, err := c.attachFiles(chatID, response.PostNos, text, guids); err != nil {
+		if deleted {
+			return nil, err
+		}
+		return response, err
+	}
+	return response, nil
+}
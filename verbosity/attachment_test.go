@@ -0,0 +1,79 @@
+package verbosity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSendMessageWithFiles(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	os.WriteFile(path, []byte("report"), 0o644)
+
+	response, err := client.SendMessageWithFiles(context.Background(), 10, "Weekly report",
+		FileFromPath(path), FileFromBytes("chart.png", []byte("png")))
+	if err != nil {
+		t.Fatalf("SendMessageWithFiles should not return error: %v", err)
+	}
+
+	if len(chat.sent) != 1 || chat.sent[0] != "Weekly report" || len(chat.uploads) != 2 {
+		t.Fatalf("Expected 2 uploads and a single message, got %v and %q", chat.uploads, chat.sent)
+	}
+	guids := chat.attachments[response.PostNo]
+	if len(guids) != 2 || chat.files[guids[0]] != "report" || chat.files[guids[1]] != "png" {
+		t.Errorf("Expected the files attached in order, got %v", guids)
+	}
+
+	private, err := client.SendPrivateMessageWithFiles(context.Background(), 7, "", FileFromBytes("notes.txt", []byte("notes")))
+	if err != nil {
+		t.Fatalf("SendPrivateMessageWithFiles should not return error: %v", err)
+	}
+	if chat.uploads[2] != "1007" || len(chat.attachments[private.PostNo]) != 1 || chat.targets[1] != 7 {
+		t.Errorf("Expected the file uploaded to the private chat, got uploads %v", chat.uploads)
+	}
+	if post := chat.post(private.PostNo); post != "notes.txt" {
+		t.Errorf("Expected the file name as the text, got %q", post)
+	}
+
+	// The files are attached to the first part of a long message
+	client.config.MaxMessageLength = 20
+	long, err := client.SendMessageWithFiles(context.Background(), 10, "first paragraph\n\nsecond paragraph", FileFromBytes("a.txt", []byte("a")))
+	if err != nil {
+		t.Fatalf("SendMessageWithFiles should not return error: %v", err)
+	}
+	if post := chat.post(long.PostNo); post != "first paragraph" || len(chat.attachments[long.PostNo]) != 1 || len(long.PostNos) != 2 {
+		t.Errorf("Expected the file attached to the first part, got %q with %v", post, chat.attachments[long.PostNo])
+	}
+}
+
+func TestSendMessageWithFilesFailure(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	_, err := client.SendMessageWithFiles(context.Background(), 10, "Weekly report",
+		FileFromBytes("chart.png", []byte("png")), FileFromPath(filepath.Join(t.TempDir(), "missing.txt")))
+	if err == nil || !strings.Contains(err.Error(), "failed to open file") {
+		t.Fatalf("Expected error for the missing file, got %v", err)
+	}
+	if len(chat.sent) != 0 {
+		t.Errorf("No message should be sent when an upload fails, got %q", chat.sent)
+	}
+
+	// A message whose files cannot be attached is deleted
+	chat.rejectAttachments = true
+	response, err := client.SendMessageWithFiles(context.Background(), 10, "Weekly report", FileFromBytes("chart.png", []byte("png")))
+	if err == nil || !strings.Contains(err.Error(), "failed to attach files") || response != nil {
+		t.Fatalf("Expected attach error without a message, got %+v and %v", response, err)
+	}
+	if len(chat.sent) != 1 || len(chat.posts) != 0 {
+		t.Errorf("Expected the sent message to be deleted, got posts %v", chat.posts)
+	}
+	chat.rejectAttachments = false
+
+	if _, err := client.SendMessageWithFiles(context.Background(), 10, ""); err == nil {
+		t.Error("Expected error for a message without text and files")
+	}
+}
@@ -0,0 +1,291 @@
+package verbosity
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// AudienceKind is the kind of recipients selected by an Audience.
+type AudienceKind string
+
+const (
+	// AudienceChats selects chats; each chat gets one message.
+	AudienceChats AudienceKind = "chats"
+	// AudienceUsers selects users; each user gets one private message.
+	AudienceUsers AudienceKind = "users"
+)
+
+// ErrAudienceNotConfirmed is returned when a broadcast exceeds
+// AudienceOptions.ConfirmAbove and was not confirmed.
+var ErrAudienceNotConfirmed = errors.New("audience broadcast not confirmed")
+
+// Audience selects the recipients of a targeted broadcast.
+//
+// Chats are selected from the chats available to the bot and must match all
+// the set criteria. For AudienceUsers the recipients are the members of the
+// matching chats; if no chat criterion other than OrgIDs is set, they are the
+// members of the organizations in OrgIDs. Users are sent one message even if
+// they are in several chats.
+type Audience struct {
+	// Kind is the kind of recipients, AudienceChats if empty.
+	Kind AudienceKind
+	// OrgIDs selects chats of the organizations, or their members.
+	OrgIDs []int64
+	// TitlePattern is a regular expression the chat title must match.
+	TitlePattern string
+	// PublicOnly and PrivateOnly select non-private or private chats.
+	PublicOnly  bool
+	PrivateOnly bool
+	// MinMembers and MaxMembers limit the member count if not zero.
+	MinMembers int
+	MaxMembers int
+	// WithUserIDs selects chats containing any of the users.
+	WithUserIDs []int64
+	// ExcludeChatIDs and ExcludeUserIDs are never sent to.
+	// Members of an excluded chat may still be selected through other chats.
+	ExcludeChatIDs []int64
+	ExcludeUserIDs []int64
+}
+
+// AudienceRecipient is a chat or a user selected by an Audience.
+type AudienceRecipient struct {
+	ChatID int64
+	UserID int64
+	// Name is the chat title or the unique name of the user.
+	Name string
+}
+
+// AudienceOptions configures a broadcast to an audience.
+type AudienceOptions struct {
+	BroadcastOptions
+	// ConfirmAbove requires Confirm to approve broadcasts to more recipients.
+	// Zero disables the confirmation.
+	ConfirmAbove int
+	// Confirm is called with the recipients when ConfirmAbove is exceeded.
+	Confirm func(recipients []AudienceRecipient) bool
+}
+
+// hasChatCriteria reports whether the audience filters chats by more than
+// the organization.
+func (a *Audience) hasChatCriteria() bool {
+	return a.TitlePattern != "" || a.PublicOnly || a.PrivateOnly ||
+		a.MinMembers > 0 || a.MaxMembers > 0 || len(a.WithUserIDs) > 0
+}
+
+// chatFilter returns the predicate for chats matching the audience.
+func (a *Audience) chatFilter() (func(chat *Chat) bool, error) {
+	if a.PublicOnly && a.PrivateOnly {
+		return nil, fmt.Errorf("audience cannot be both public and private only")
+	}
+
+	var title *regexp.Regexp
+	if a.TitlePattern != "" {
+		var err error
+		if title, err = regexp.Compile(a.TitlePattern); err != nil {
+			return nil, fmt.Errorf("invalid title pattern: %w", err)
+		}
+	}
+
+	orgs := int64Set(a.OrgIDs)
+	excluded := int64Set(a.ExcludeChatIDs)
+	withUsers := int64Set(a.WithUserIDs)
+
+	return func(chat *Chat) bool {
+		switch {
+		case excluded[chat.ID]:
+			return false
+		case len(orgs) > 0 && (chat.OrganizationID == nil || !orgs[*chat.OrganizationID]):
+			return false
+		case title != nil && !title.MatchString(chat.Title):
+			return false
+		case a.PublicOnly && chat.PM, a.PrivateOnly && !chat.PM:
+			return false
+		case a.MinMembers > 0 && len(chat.MemberIDs) < a.MinMembers:
+			return false
+		case a.MaxMembers > 0 && len(chat.MemberIDs) > a.MaxMembers:
+			return false
+		}
+		if len(withUsers) == 0 {
+			return true
+		}
+		for _, id := range chat.MemberIDs {
+			if withUsers[id] {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// PreviewAudience returns the recipients of the audience without sending
+// anything. The recipients are sorted by ID.
+func (c *Client) PreviewAudience(audience *Audience) ([]AudienceRecipient, error) {
+	if audience == nil {
+		return nil, fmt.Errorf("audience cannot be nil")
+	}
+
+	switch audience.Kind {
+	case "", AudienceChats:
+		return c.audienceChats(audience)
+	case AudienceUsers:
+		return c.audienceUsers(audience)
+	default:
+		return nil, fmt.Errorf("unknown audience kind %q", audience.Kind)
+	}
+}
+
+func (c *Client) audienceChats(audience *Audience) ([]AudienceRecipient, error) {
+	chats, err := c.matchingChats(audience)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]AudienceRecipient, len(chats))
+	for i, chat := range chats {
+		recipients[i] = AudienceRecipient{ChatID: chat.ID, Name: chat.Title}
+	}
+	return recipients, nil
+}
+
+func (c *Client) audienceUsers(audience *Audience) ([]AudienceRecipient, error) {
+	users := make(map[int64]bool)
+	if audience.hasChatCriteria() {
+		chats, err := c.matchingChats(audience)
+		if err != nil {
+			return nil, err
+		}
+		for _, chat := range chats {
+			for _, id := range chat.MemberIDs {
+				users[id] = true
+			}
+		}
+	} else {
+		if len(audience.OrgIDs) == 0 {
+			return nil, fmt.Errorf("audience of users requires organizations or chat criteria")
+		}
+		orgs, err := c.GetOrganizationsByIDs(audience.OrgIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, org := range orgs.Orgs {
+			for _, id := range org.Users {
+				users[id] = true
+			}
+		}
+	}
+	for _, id := range audience.ExcludeUserIDs {
+		delete(users, id)
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	names := make(map[int64]string)
+	if response, err := c.GetUsersByIDs(ids); err == nil {
+		for _, user := range response.Users {
+			names[user.ID] = user.UniqueName
+		}
+	}
+
+	recipients := make([]AudienceRecipient, len(ids))
+	for i, id := range ids {
+		recipients[i] = AudienceRecipient{UserID: id, Name: names[id]}
+	}
+	return recipients, nil
+}
+
+// matchingChats returns the available chats matching the audience sorted by ID.
+func (c *Client) matchingChats(audience *Audience) ([]Chat, error) {
+	match, err := audience.chatFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	chats, err := c.GetAllChats()
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []Chat
+	seen := make(map[int64]bool)
+	for i := range chats.Chats {
+		chat := &chats.Chats[i]
+		if !seen[chat.ID] && match(chat) {
+			seen[chat.ID] = true
+			matching = append(matching, *chat)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].ID < matching[j].ID })
+	return matching, nil
+}
+
+// BroadcastToAudience sends a message to the recipients of the audience:
+// a message to each selected chat or a private message to each selected user.
+//
+// If the number of recipients exceeds opts.ConfirmAbove, opts.Confirm must
+// approve the recipients; otherwise nothing is sent and
+// ErrAudienceNotConfirmed is returned. Use PreviewAudience for a dry run.
+func (c *Client) BroadcastToAudience(audience *Audience, text string, opts *AudienceOptions) ([]BroadcastResult, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+	if opts == nil {
+		opts = &AudienceOptions{}
+	}
+
+	recipients, err := c.PreviewAudience(audience)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("audience has no recipients")
+	}
+	if opts.ConfirmAbove > 0 && len(recipients) > opts.ConfirmAbove {
+		if opts.Confirm == nil || !opts.Confirm(recipients) {
+			return nil, ErrAudienceNotConfirmed
+		}
+	}
+
+	targets := make([]BroadcastResult, len(recipients))
+	for i, recipient := range recipients {
+		targets[i] = BroadcastResult{ChatID: recipient.ChatID, UserID: recipient.UserID}
+	}
+
+	return c.broadcast(targets, &opts.BroadcastOptions, "send message", func(i int, result *BroadcastResult) error {
+		if result.UserID == 0 {
+			response, err := c.SendMessage(result.ChatID, text, nil)
+			if err != nil {
+				return err
+			}
+			result.Response = response
+			result.PostNo = response.PostNo
+			return nil
+		}
+
+		response, err := c.SendPrivateMessageByID(result.UserID, text, nil)
+		if err != nil {
+			return err
+		}
+		result.ChatID = response.ChatID
+		result.PostNo = response.PostNo
+		result.Response = &MessageResponse{PostNo: response.PostNo, PostNos: response.PostNos}
+		return nil
+	})
+}
+
+// int64Set returns the set of the IDs.
+func int64Set(ids []int64) map[int64]bool {
+	set := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,81 @@
+package verbosity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAudience(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	org := int64(100)
+	chat.chats[1] = Chat{ID: 1, Title: "Team backend", OrganizationID: &org, MemberIDs: []int64{1, 2, 3}}
+	chat.chats[2] = Chat{ID: 2, Title: "Team frontend", OrganizationID: &org, MemberIDs: []int64{3, 4}}
+	chat.chats[3] = Chat{ID: 3, Title: "Flood", MemberIDs: []int64{1, 2, 3, 4, 5, 6}}
+	chat.chats[4] = Chat{ID: 4, Title: "alice", PM: true, MemberIDs: []int64{1}}
+	chat.orgs[org] = Org{ID: org, Users: []int64{1, 2, 3, 4, 9}}
+	chat.users[1] = User{ID: 1, UniqueName: "alice"}
+
+	tests := []struct {
+		name     string
+		audience Audience
+		chats    []int64
+		users    []int64
+	}{
+		{name: "org chats", audience: Audience{OrgIDs: []int64{org}}, chats: []int64{1, 2}},
+		{name: "title", audience: Audience{TitlePattern: "^Team "}, chats: []int64{1, 2}},
+		{name: "public", audience: Audience{PublicOnly: true, ExcludeChatIDs: []int64{3}}, chats: []int64{1, 2}},
+		{name: "private", audience: Audience{PrivateOnly: true}, chats: []int64{4}},
+		{name: "members", audience: Audience{MinMembers: 2, MaxMembers: 3}, chats: []int64{1, 2}},
+		{name: "with user", audience: Audience{WithUserIDs: []int64{4}}, chats: []int64{2, 3}},
+		{name: "org users", audience: Audience{Kind: AudienceUsers, OrgIDs: []int64{org}, ExcludeUserIDs: []int64{2}}, users: []int64{1, 3, 4, 9}},
+		{name: "chat users", audience: Audience{Kind: AudienceUsers, TitlePattern: "^Team "}, users: []int64{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		recipients, err := client.PreviewAudience(&tt.audience)
+		if err != nil {
+			t.Errorf("%s: PreviewAudience returned error: %v", tt.name, err)
+			continue
+		}
+		var chats, users []int64
+		for _, r := range recipients {
+			if r.UserID != 0 {
+				users = append(users, r.UserID)
+			} else {
+				chats = append(chats, r.ChatID)
+			}
+		}
+		if !reflect.DeepEqual(chats, tt.chats) || !reflect.DeepEqual(users, tt.users) {
+			t.Errorf("%s: got chats %v users %v, expected %v %v", tt.name, chats, users, tt.chats, tt.users)
+		}
+	}
+
+	if _, err := client.PreviewAudience(&Audience{Kind: AudienceUsers}); err == nil {
+		t.Error("Audience of users without criteria should return error")
+	}
+	if _, err := client.PreviewAudience(&Audience{TitlePattern: "("}); err == nil {
+		t.Error("Invalid title pattern should return error")
+	}
+
+	users := &Audience{Kind: AudienceUsers, TitlePattern: "^Team "}
+	var confirmed []AudienceRecipient
+	_, err := client.BroadcastToAudience(users, "hello", &AudienceOptions{
+		ConfirmAbove: 3,
+		Confirm:      func(recipients []AudienceRecipient) bool { confirmed = recipients; return false },
+	})
+	if err != ErrAudienceNotConfirmed || len(confirmed) != 4 || confirmed[0].Name != "alice" || len(chat.sent) != 0 {
+		t.Fatalf("Expected unconfirmed broadcast, got %v with %d sent", err, len(chat.sent))
+	}
+
+	results, err := client.BroadcastToAudience(users, "hello", &AudienceOptions{ConfirmAbove: 10})
+	if err != nil || len(results) != 4 {
+		t.Fatalf("BroadcastToAudience returned %d results (%v)", len(results), err)
+	}
+	if results[0].UserID != 1 || results[0].PostNo == 0 {
+		t.Errorf("Unexpected result %+v", results[0])
+	}
+	if len(chat.targets) != 4 {
+		t.Errorf("Expected each user to get one message, got %v", chat.targets)
+	}
+}
@@ -1,12 +1,8 @@
 package verbosity
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"math/big"
 	"net/url"
 )
 
@@ -39,8 +35,11 @@ type BotRequest struct {
 
 // TextBlock represents a parsed text block.
 type TextBlock struct {
-	Type  string `json:"type"`
-	Value string `json:"value"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	URL    string `json:"url,omitempty"`
+	UserID int64  `json:"user_id,omitempty"`
+	Lang   string `json:"lang,omitempty"`
 }
 
 // ActionRequest represents an action callback request.
@@ -83,21 +82,17 @@ func (c *Client) GetBotInfoFromAPI() (*User, error) {
 //
 // where bkey = to_bytes(int(key, 16))
 func (c *Client) VerifySignature(body, signature string) (bool, error) {
-	if len(c.config.APIToken) < 20 {
-		return false, fmt.Errorf("API token is too short")
-	}
+	return c.VerifySignatureBytes([]byte(body), signature)
+}
 
-	// Convert hex key to bytes
-	bkey, ok := new(big.Int).SetString(c.config.APIToken[:20], 16)
-	if !ok {
-		return false, fmt.Errorf("failed to parse API token key")
+// VerifySignatureBytes verifies the X-Signature header for a raw request body.
+func (c *Client) VerifySignatureBytes(body []byte, signature string) (bool, error) {
+	verifier, err := c.Verifier()
+	if err != nil {
+		return false, err
 	}
 
-	h := hmac.New(sha256.New, bkey.Bytes())
-	h.Write([]byte(body))
-	expected := base64.StdEncoding.EncodeToString(h.Sum(nil))
-
-	return signature == expected, nil
+	return verifier.Verify(body, signature), nil
 }
 
 // ParseBotRequest parses a JSON bot request.
@@ -136,6 +131,9 @@ func CreateActionURL(action, title string, params map[string]string) string {
 }
 
 // IsUserMentioned checks if the bot is mentioned in the message text.
+//
+// Deprecated: it only recognizes a mention with the literal value "bot".
+// Use IsMentioned with the bot unique name instead.
 func (r *BotRequest) IsUserMentioned() bool {
 	for _, block := range r.TextParsed {
 		if block.Type == "mention" && block.Value == "bot" {
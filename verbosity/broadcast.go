@@ -0,0 +1,225 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultBroadcastWorkers is the default number of concurrent sends.
+const DefaultBroadcastWorkers = 4
+
+// ErrBroadcastStopped is the error of the chats skipped after the broadcast
+// was stopped by BroadcastOptions.StopOnError or the context.
+var ErrBroadcastStopped = errors.New("broadcast stopped")
+
+// BroadcastResult is the outcome of a broadcast to one chat or user.
+// UserID is set for private messages.
+type BroadcastResult struct {
+	ChatID   int64
+	UserID   int64
+	PostNo   int64
+	Response *MessageResponse
+	Err      error
+}
+
+// BroadcastOptions configures a broadcast.
+type BroadcastOptions struct {
+	// Context cancels the remaining sends. Defaults to context.Background().
+	Context context.Context
+	// Workers is the number of concurrent sends, DefaultBroadcastWorkers if zero.
+	Workers int
+	// RatePerSecond limits the sends across all workers. Zero means no limit.
+	RatePerSecond float64
+	// StopOnError skips the remaining chats after the first failure.
+	StopOnError bool
+	// Progress is called after each chat. Calls are not concurrent.
+	Progress func(done, total int, result BroadcastResult)
+}
+
+// BroadcastMessage sends a message to multiple chats concurrently and
+// returns the responses of the chats that received it, in the order of
+// chatIDs. The sends continue past failures; the error is not nil if any
+// chat failed.
+//
+// Deprecated: use BroadcastMessageWithOptions, which returns a result per
+// chat.
+func (c *Client) BroadcastMessage(chatIDs []int64, text string) ([]MessageResponse, error) {
+	results, err := c.BroadcastMessageWithOptions(chatIDs, text, nil)
+	return broadcastResponses(results), err
+}
+
+// BroadcastMessageWithOptions sends a message to multiple chats with a bounded
+// worker pool and an optional rate limit.
+//
+// The results are in the order of chatIDs, one per chat. The error is not nil
+// if any chat failed; the results tell which chats received the message.
+func (c *Client) BroadcastMessageWithOptions(chatIDs []int64, text string, opts *BroadcastOptions) ([]BroadcastResult, error) {
+	if len(chatIDs) == 0 {
+		return nil, fmt.Errorf("chat_ids slice cannot be empty")
+	}
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	targets := make([]BroadcastResult, len(chatIDs))
+	for i, chatID := range chatIDs {
+		targets[i].ChatID = chatID
+	}
+	return c.broadcast(targets, opts, "send message", func(i int, result *BroadcastResult) error {
+		response, err := c.SendMessage(result.ChatID, text, nil)
+		if err != nil {
+			return err
+		}
+		result.Response = response
+		result.PostNo = response.PostNo
+		return nil
+	})
+}
+
+// SendMessageToAllMyChats sends a message to all chats where the bot is a
+// member and returns the responses of the chats that received it.
+//
+// Deprecated: use SendMessageToAllMyChatsWithOptions, which returns a
+// result per chat.
+func (c *Client) SendMessageToAllMyChats(text string) ([]MessageResponse, error) {
+	results, err := c.SendMessageToAllMyChatsWithOptions(text, nil)
+	return broadcastResponses(results), err
+}
+
+// SendMessageToAllMyChatsWithOptions sends a message to all chats where the
+// bot is a member, see BroadcastMessageWithOptions.
+func (c *Client) SendMessageToAllMyChatsWithOptions(text string, opts *BroadcastOptions) ([]BroadcastResult, error) {
+	chats, err := c.GetMyChats()
+	if err != nil {
+		return nil, err
+	}
+
+	chatIDs := make([]int64, len(chats.Chats))
+	for i, chat := range chats.Chats {
+		chatIDs[i] = chat.ID
+	}
+
+	return c.BroadcastMessageWithOptions(chatIDs, text, opts)
+}
+
+// broadcastResponses returns the responses of the successful results.
+func broadcastResponses(results []BroadcastResult) []MessageResponse {
+	var responses []MessageResponse
+	for _, result := range results {
+		if result.Err == nil && result.Response != nil {
+			responses = append(responses, *result.Response)
+		}
+	}
+	return responses
+}
+
+// broadcast calls send for each target and collects the results.
+// The targets hold the recipient; send fills in the response. The action
+// names what is sent in the error, such as "send message".
+func (c *Client) broadcast(targets []BroadcastResult, opts *BroadcastOptions, action string, send func(i int, result *BroadcastResult) error) ([]BroadcastResult, error) {
+	if opts == nil {
+		opts = &BroadcastOptions{}
+	}
+	parent := opts.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultBroadcastWorkers
+	}
+	if workers > len(targets) {
+		workers = len(targets)
+	}
+	limiter := newRateLimiter(opts.RatePerSecond)
+
+	results := make([]BroadcastResult, len(targets))
+	indexes := make(chan int)
+
+	var (
+		mu   sync.Mutex
+		done int
+		wg   sync.WaitGroup
+	)
+	finish := func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		done++
+		if results[i].Err != nil && opts.StopOnError {
+			cancel()
+		}
+		if opts.Progress != nil {
+			opts.Progress(done, len(results), results[i])
+		}
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := targets[i]
+				if err := limiter.Wait(ctx); err != nil {
+					result.Err = ErrBroadcastStopped
+				} else if err := send(i, &result); err != nil {
+					result.Err = err
+				}
+				results[i] = result
+				finish(i)
+			}
+		}()
+	}
+
+	for i := range targets {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil && result.Err != ErrBroadcastStopped {
+			errs = append(errs, fmt.Errorf("%s: %w", result.recipient(), result.Err))
+		}
+	}
+	if len(errs) == 0 && ctx.Err() != nil && parent.Err() != nil {
+		errs = append(errs, parent.Err())
+	}
+	if len(errs) > 0 {
+		failed, skipped := countFailed(results)
+		if skipped > 0 {
+			return results, fmt.Errorf("failed to %s to %d of %d recipients, %d skipped: %w", action, failed, len(results), skipped, errors.Join(errs...))
+		}
+		return results, fmt.Errorf("failed to %s to %d of %d recipients: %w", action, failed, len(results), errors.Join(errs...))
+	}
+	return results, nil
+}
+
+// recipient describes the recipient of the result for errors.
+func (r BroadcastResult) recipient() string {
+	if r.UserID != 0 {
+		return fmt.Sprintf("user %d", r.UserID)
+	}
+	return fmt.Sprintf("chat %d", r.ChatID)
+}
+
+// countFailed returns the number of failed results and of results skipped
+// with ErrBroadcastStopped.
+func countFailed(results []BroadcastResult) (int, int) {
+	failed, skipped := 0, 0
+	for _, result := range results {
+		switch {
+		case result.Err == ErrBroadcastStopped:
+			skipped++
+		case result.Err != nil:
+			failed++
+		}
+	}
+	return failed, skipped
+}
@@ -0,0 +1,77 @@
+package verbosity
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBroadcastMessage(t *testing.T) {
+	flaky, client := newFlakyServer(t)
+	flaky.failures[3], flaky.status[3] = 1, http.StatusForbidden
+
+	var progress []int
+	results, err := client.BroadcastMessageWithOptions([]int64{1, 2, 3, 4, 5}, "hello", &BroadcastOptions{
+		Workers:       3,
+		RatePerSecond: 1000,
+		Progress: func(done, total int, result BroadcastResult) {
+			if total != 5 {
+				t.Errorf("Expected total 5, got %d", total)
+			}
+			progress = append(progress, done)
+		},
+	})
+
+	var apiErr *APIError
+	if err == nil || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected error wrapping the API error, got %v", err)
+	}
+	if len(results) != 5 || len(progress) != 5 || progress[4] != 5 {
+		t.Fatalf("Expected 5 results and progress calls, got %d and %v", len(results), progress)
+	}
+	for i, result := range results {
+		if result.ChatID != int64(i+1) {
+			t.Errorf("Result %d is for chat %d", i, result.ChatID)
+		}
+		if failed := result.ChatID == 3; failed != (result.Err != nil) || failed != (result.PostNo == 0) {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	}
+	if len(flaky.sent) != 4 {
+		t.Errorf("Expected 4 delivered messages, got %d", len(flaky.sent))
+	}
+}
+
+func TestBroadcastStopOnError(t *testing.T) {
+	flaky, client := newFlakyServer(t)
+	flaky.failures[1], flaky.status[1] = 1, http.StatusInternalServerError
+
+	results, err := client.BroadcastMessageWithOptions([]int64{1, 2, 3}, "hello", &BroadcastOptions{Workers: 1, StopOnError: true})
+	if err == nil || !strings.Contains(err.Error(), "to 1 of 3 recipients, 2 skipped") {
+		t.Fatalf("Expected skipped chats not to be counted as failed, got %v", err)
+	}
+	if results[0].Err == nil || results[1].Err != ErrBroadcastStopped || results[2].Err != ErrBroadcastStopped {
+		t.Errorf("Expected remaining chats to be skipped, got %+v", results)
+	}
+	if len(flaky.sent) != 0 {
+		t.Errorf("Expected no delivered messages, got %v", flaky.sent)
+	}
+
+	if _, err := client.BroadcastMessage(nil, "hello"); err == nil {
+		t.Error("Expected error for empty chat list")
+	}
+}
+
+func TestBroadcastMessageResponses(t *testing.T) {
+	flaky, client := newFlakyServer(t)
+	flaky.failures[2], flaky.status[2] = 1, http.StatusForbidden
+
+	responses, err := client.BroadcastMessage([]int64{1, 2, 3}, "hello")
+	if err == nil {
+		t.Fatal("Expected error for the failed chat")
+	}
+	if len(responses) != 2 || responses[0].PostNo == 0 || responses[1].PostNo == 0 {
+		t.Errorf("Expected the responses of the delivered chats, got %+v", responses)
+	}
+}
@@ -0,0 +1,381 @@
+package verbosity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ChatWriter defaults.
+const (
+	DefaultChatWriterInterval        = 2 * time.Second
+	DefaultChatWriterUploadThreshold = 64 << 10
+	DefaultChatWriterFileName        = "output.log"
+)
+
+// ChatWriterMode is how a ChatWriter shows the output.
+type ChatWriterMode string
+
+// Chat writer modes.
+const (
+	// ChatWriterPosts sends each flushed chunk as new posts.
+	ChatWriterPosts ChatWriterMode = "posts"
+	// ChatWriterRolling edits a single post with the tail of the output.
+	ChatWriterRolling ChatWriterMode = "rolling"
+)
+
+// ChatWriter is an io.WriteCloser that streams output into a chat.
+//
+// Complete lines are buffered and flushed in code blocks every Interval,
+// or as soon as they fill a message. Close flushes the rest. If the output
+// exceeds UploadThreshold bytes, Close also uploads the full log as a text
+// file and attaches it to the last post. Above the threshold the log is
+// kept in a temporary file instead of memory.
+//
+// Write does not fail when a flush fails: the lines are kept, the flush is
+// retried after Interval and the error is reported to OnError. A command
+// writing into the writer is not stopped by a temporary API failure.
+//
+//	w := client.NewChatWriter(chatID)
+//	w.Mode = verbosity.ChatWriterRolling
+//	cmd.Stdout, cmd.Stderr = w, w
+//	err := cmd.Run()
+//	w.Close()
+type ChatWriter struct {
+	// Mode is ChatWriterPosts if empty.
+	Mode ChatWriterMode
+	// Interval is the time between flushes, DefaultChatWriterInterval if zero.
+	Interval time.Duration
+	// Language is the language of the code blocks, e.g. "text".
+	Language string
+	// UploadThreshold is the output size in bytes above which Close uploads
+	// the full log, DefaultChatWriterUploadThreshold if zero.
+	// A negative value disables the upload, and the output is not kept.
+	UploadThreshold int
+	// FileName is the name of the uploaded log, DefaultChatWriterFileName if empty.
+	FileName string
+	// OnError is called when a flush started by Write or the timer fails,
+	// and when the log cannot be kept for the upload. It may be nil.
+	OnError func(err error)
+
+	client *Client
+	chatID int64
+
+	mu  sync.Mutex
+	log bytes.Buffer
+	// logFile holds the log once it exceeds UploadThreshold
+	logFile *os.File
+	logSize int64
+	logErr  error
+	partial string
+	pending []string
+	lines   []string
+	skipped int
+	postNo  int64
+	timer   *time.Timer
+	closed  bool
+	// stale is set when the rolling post is behind w.lines
+	stale bool
+	// failed is set after a failed flush until the timer retries it
+	failed bool
+}
+
+// NewChatWriter creates a writer that streams output into the chat.
+func (c *Client) NewChatWriter(chatID int64) *ChatWriter {
+	return &ChatWriter{client: c, chatID: chatID}
+}
+
+// PostNo returns the number of the last post written.
+func (w *ChatWriter) PostNo() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.postNo
+}
+
+// Write buffers the output. It flushes immediately when the buffered lines
+// fill a message; if that flush fails, the error is reported to OnError
+// and the flush is retried after Interval.
+func (w *ChatWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, fmt.Errorf("chat writer is closed")
+	}
+	if w.uploadThreshold() > 0 && w.logErr == nil {
+		if err := w.writeLog(p); err != nil {
+			w.logErr = err
+			w.report(err)
+		}
+	}
+
+	text := w.partial + string(p)
+	lines := strings.Split(text, "\n")
+	w.partial = lines[len(lines)-1]
+	w.pending = append(w.pending, lines[:len(lines)-1]...)
+
+	if !w.failed && w.Mode != ChatWriterRolling && utf8.RuneCountInString(w.block(w.pending)) >= w.limit() {
+		if err := w.flush(); err != nil {
+			w.report(err)
+		}
+	}
+	w.schedule()
+	return len(p), nil
+}
+
+// writeLog keeps the output for the upload, in memory up to
+// UploadThreshold and in a temporary file above it. The caller holds w.mu.
+func (w *ChatWriter) writeLog(p []byte) error {
+	w.logSize += int64(len(p))
+	if w.logFile == nil && w.logSize <= int64(w.uploadThreshold()) {
+		w.log.Write(p)
+		return nil
+	}
+
+	if w.logFile == nil {
+		file, err := os.CreateTemp("", "chatwriter-*.log")
+		if err != nil {
+			return fmt.Errorf("failed to create output log: %w", err)
+		}
+		w.logFile = file
+		if _, err := file.Write(w.log.Bytes()); err != nil {
+			return fmt.Errorf("failed to write output log: %w", err)
+		}
+		w.log = bytes.Buffer{}
+	}
+	if _, err := w.logFile.Write(p); err != nil {
+		return fmt.Errorf("failed to write output log: %w", err)
+	}
+	return nil
+}
+
+// removeLog removes the temporary log file. The caller holds w.mu.
+func (w *ChatWriter) removeLog() {
+	if w.logFile != nil {
+		w.logFile.Close()
+		os.Remove(w.logFile.Name())
+		w.logFile = nil
+	}
+}
+
+// report passes the error to OnError. The caller holds w.mu.
+func (w *ChatWriter) report(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// schedule starts the flush timer if there is output to write.
+// The caller holds w.mu.
+func (w *ChatWriter) schedule() {
+	if w.timer != nil || (len(w.pending) == 0 && !w.stale) {
+		return
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultChatWriterInterval
+	}
+	w.timer = time.AfterFunc(interval, w.tick)
+}
+
+// Flush writes the buffered lines.
+func (w *ChatWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+// Close flushes the rest of the output, including an incomplete last line,
+// and uploads the full log if it exceeds UploadThreshold.
+func (w *ChatWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.partial != "" {
+		w.pending = append(w.pending, w.partial)
+		w.partial = ""
+	}
+
+	defer w.removeLog()
+
+	err := w.flush()
+	if threshold := w.uploadThreshold(); threshold > 0 && w.logSize > int64(threshold) {
+		if w.logErr != nil {
+			return errors.Join(err, w.logErr)
+		}
+		err = errors.Join(err, w.upload())
+	}
+	return err
+}
+
+func (w *ChatWriter) tick() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.flush()
+	if err == nil {
+		return
+	}
+	if !w.closed {
+		w.schedule()
+	}
+	w.report(err)
+}
+
+// flush writes the pending lines. The caller holds w.mu.
+func (w *ChatWriter) flush() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if len(w.pending) == 0 && !w.stale {
+		w.failed = false
+		return nil
+	}
+	pending := w.pending
+	w.pending = nil
+
+	if w.Mode == ChatWriterRolling {
+		err := w.roll(pending)
+		w.failed = err != nil
+		return err
+	}
+
+	response, err := w.client.SendMessage(w.chatID, w.block(pending), nil)
+	if err != nil {
+		// Keep the lines for the next flush
+		w.pending = append(pending, w.pending...)
+		w.failed = true
+		return fmt.Errorf("failed to send output: %w", err)
+	}
+	w.failed = false
+	w.postNo = response.PostNo
+	if len(response.PostNos) > 0 {
+		w.postNo = response.PostNos[len(response.PostNos)-1]
+	}
+	return nil
+}
+
+// roll writes the tail of the output to the rolling post. If the write
+// fails, the post is marked stale and written by the next flush.
+func (w *ChatWriter) roll(pending []string) error {
+	w.lines = append(w.lines, pending...)
+	w.stale = true
+	text := w.rollingText("")
+
+	if w.postNo != 0 {
+		_, err := w.client.editMessage(w.chatID, w.postNo, text)
+		if err == nil {
+			w.stale = false
+			return nil
+		}
+		if !IsNotFoundError(err) {
+			return fmt.Errorf("failed to update output: %w", err)
+		}
+	}
+
+	response, err := w.client.SendMessage(w.chatID, text, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send output: %w", err)
+	}
+	w.postNo = response.PostNo
+	w.stale = false
+	return nil
+}
+
+// rollingText returns the tail of the output with the footer that fits
+// into a post, dropping the lines that do not fit and cutting a single
+// line longer than a post.
+func (w *ChatWriter) rollingText(footer string) string {
+	for {
+		text := w.block(w.lines)
+		if w.skipped > 0 {
+			text = fmt.Sprintf("… %d %s above\n%s", w.skipped, PluralEn(w.skipped, "line", "lines"), text)
+		}
+		if footer != "" {
+			text += "\n" + footer
+		}
+		length := utf8.RuneCountInString(text)
+		if length <= w.limit() || len(w.lines) == 0 {
+			return truncateMessage(text, w.limit())
+		}
+		if len(w.lines) > 1 {
+			w.lines = w.lines[1:]
+			w.skipped++
+			continue
+		}
+
+		line := []rune(w.lines[0])
+		keep := len(line) - (length - w.limit()) - 1
+		if keep <= 0 {
+			return truncateMessage(text, w.limit())
+		}
+		w.lines[0] = string(line[:keep]) + "…"
+	}
+}
+
+// upload uploads the full log and attaches it to the last post.
+func (w *ChatWriter) upload() error {
+	name := w.FileName
+	if name == "" {
+		name = DefaultChatWriterFileName
+	}
+
+	var log io.Reader = bytes.NewReader(w.log.Bytes())
+	if w.logFile != nil {
+		if _, err := w.logFile.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read output log: %w", err)
+		}
+		log = w.logFile
+	}
+	response, err := w.client.UploadFileData(w.chatID, log, w.logSize, name)
+	if err != nil {
+		return fmt.Errorf("failed to upload output: %w", err)
+	}
+
+	text := fmt.Sprintf("Full output: %s (%d bytes)", name, w.logSize)
+	if w.Mode == ChatWriterRolling && w.postNo != 0 {
+		text = w.rollingText(text)
+	} else {
+		sent, err := w.client.SendMessage(w.chatID, text, nil)
+		if err != nil {
+			return fmt.Errorf("failed to send output: %w", err)
+		}
+		w.postNo = sent.PostNo
+	}
+
+	if _, err := w.client.UpdateMessageWithAttachments(w.chatID, w.postNo, text, []string{response.GUID}); err != nil {
+		return fmt.Errorf("failed to attach output: %w", err)
+	}
+	return nil
+}
+
+// block wraps the lines in a code block.
+func (w *ChatWriter) block(lines []string) string {
+	return "```" + w.Language + "\n" + strings.Join(lines, "\n") + "\n```"
+}
+
+// limit returns the maximum length of a post.
+func (w *ChatWriter) limit() int {
+	if limit := w.client.maxMessageLength(); limit > 0 {
+		return limit
+	}
+	return DefaultMaxMessageLength
+}
+
+func (w *ChatWriter) uploadThreshold() int {
+	if w.UploadThreshold == 0 {
+		return DefaultChatWriterUploadThreshold
+	}
+	return w.UploadThreshold
+}
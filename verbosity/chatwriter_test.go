@@ -0,0 +1,174 @@
+package verbosity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatWriterPosts(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	w := client.NewChatWriter(10)
+	w.Interval = time.Hour
+	w.Language = "text"
+
+	fmt.Fprint(w, "building\nte")
+	fmt.Fprint(w, "sting\npartial")
+	if len(chat.sent) != 0 {
+		t.Fatalf("Output should be buffered until the interval, got %q", chat.sent)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush should not return error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+
+	expected := []string{"```text\nbuilding\ntesting\n```", "```text\npartial\n```"}
+	if len(chat.sent) != 2 || chat.sent[0] != expected[0] || chat.sent[1] != expected[1] {
+		t.Errorf("Unexpected posts %q, expected %q", chat.sent, expected)
+	}
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Error("Write after Close should return error")
+	}
+}
+
+func TestChatWriterRolling(t *testing.T) {
+	chat, client := newFakeChat(t)
+	client.config.MaxMessageLength = 100
+
+	w := client.NewChatWriter(10)
+	w.Mode = ChatWriterRolling
+	w.Interval = time.Hour
+	w.UploadThreshold = 50
+
+	var output strings.Builder
+	for i := 1; i <= 3; i++ {
+		fmt.Fprintf(io.MultiWriter(w, &output), "line %d\n", i)
+	}
+	w.Flush()
+	for i := 4; i <= 10; i++ {
+		fmt.Fprintf(io.MultiWriter(w, &output), "line %d\n", i)
+	}
+	if w.logFile == nil || w.log.Len() != 0 {
+		t.Errorf("Log above the threshold should be kept in a file, got %d bytes in memory", w.log.Len())
+	}
+	logFile := w.logFile.Name()
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+
+	if len(chat.sent) != 1 {
+		t.Fatalf("Rolling output should use a single post, got %q", chat.sent)
+	}
+	post := chat.post(1)
+	if !strings.HasPrefix(post, "… 5 lines above\n```\nline 6\n") || !strings.Contains(post, "line 10\n```\nFull output: output.log (71 bytes)") {
+		t.Errorf("Unexpected rolling post %q", post)
+	}
+	if guids := chat.attachments[1]; len(guids) != 1 || chat.files[guids[0]] != output.String() {
+		t.Errorf("Full log should be attached, got %v", guids)
+	}
+	if _, err := os.Stat(logFile); !os.IsNotExist(err) {
+		t.Errorf("Log file should be removed on Close, got %v", err)
+	}
+}
+
+func TestChatWriterWriteSurvivesFailedFlush(t *testing.T) {
+	chat, client := newFakeChat(t)
+	client.config.MaxMessageLength = 30
+
+	var errs []error
+	w := client.NewChatWriter(10)
+	w.Interval = time.Hour
+	w.OnError = func(err error) { errs = append(errs, err) }
+
+	chat.setFailing(true)
+	if n, err := io.WriteString(w, strings.Repeat("x", 40)+"\n"); err != nil || n != 41 {
+		t.Fatalf("Write should not fail when the flush fails, got %d, %v", n, err)
+	}
+	io.WriteString(w, "more\n")
+	if len(errs) != 1 {
+		t.Errorf("Expected one reported error until the retry, got %v", errs)
+	}
+
+	chat.setFailing(false)
+	w.tick()
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+	if all := strings.Join(chat.sent, "\n"); !strings.Contains(all, strings.Repeat("x", 20)) || !strings.Contains(all, "more") {
+		t.Errorf("Kept output should be sent, got %q", chat.sent)
+	}
+}
+
+func TestChatWriterInterval(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	w := client.NewChatWriter(10)
+	w.Interval = 10 * time.Millisecond
+	io.WriteString(w, "tick\n")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && chat.post(1) == "" {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if chat.post(1) != "```\ntick\n```" {
+		t.Errorf("Output should be flushed after the interval, got %q", chat.post(1))
+	}
+	w.Close()
+}
+
+func TestChatWriterKeepsOutputOnFailure(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	w := client.NewChatWriter(10)
+	w.Interval = time.Hour
+	w.UploadThreshold = -1
+
+	io.WriteString(w, "first\n")
+	chat.setFailing(true)
+	if err := w.Flush(); err == nil {
+		t.Fatal("Flush should return the send error")
+	}
+	chat.setFailing(false)
+	io.WriteString(w, "second\n")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+
+	if len(chat.sent) != 1 || chat.sent[0] != "```\nfirst\nsecond\n```" {
+		t.Errorf("Failed output should be sent again, got %q", chat.sent)
+	}
+	if w.log.Len() != 0 {
+		t.Errorf("Output should not be kept without upload, got %d bytes", w.log.Len())
+	}
+}
+
+func TestChatWriterRollingCutsLongLine(t *testing.T) {
+	chat, client := newFakeChat(t)
+	client.config.MaxMessageLength = 50
+
+	w := client.NewChatWriter(10)
+	w.Mode = ChatWriterRolling
+	w.Interval = time.Hour
+
+	io.WriteString(w, strings.Repeat("x", 200)+"\n")
+	chat.setFailing(true)
+	if err := w.Flush(); err == nil {
+		t.Fatal("Flush should return the send error")
+	}
+	chat.setFailing(false)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+
+	post := chat.post(1)
+	if len(chat.sent) != 1 || !strings.HasSuffix(post, "x…\n```") || len([]rune(post)) != 50 {
+		t.Errorf("Long line should be cut to a single post, got %q", chat.sent)
+	}
+}
@@ -15,6 +15,12 @@ type Config struct {
 	FileURL string
 	// Bot API token
 	APIToken string
+	// Maximum message length in characters, longer messages are split into parts.
+	// Zero means DefaultMaxMessageLength, a negative value disables splitting.
+	MaxMessageLength int
+	// Maximum size of a downloaded file in bytes.
+	// Zero means DefaultMaxDownloadSize, a negative value disables the limit.
+	MaxDownloadSize int64
 }
 
 // DefaultConfig returns a Config with values from environment variables.
@@ -42,6 +48,7 @@ func getEnv(key, defaultValue string) string {
 type Client struct {
 	config     *Config
 	httpClient *http.Client
+	templates  *Templates
 }
 
 // NewClient creates a new Verbosity API client with the given configuration.
@@ -59,6 +66,14 @@ func NewClientFromEnv() *Client {
 	return NewClient(DefaultConfig())
 }
 
+// fileHTTPClient returns a copy of the HTTP client without the timeout
+// for file transfers bounded by their context, as large files take long.
+func (c *Client) fileHTTPClient() *http.Client {
+	client := *c.httpClient
+	client.Timeout = 0
+	return &client
+}
+
 // Config returns the client configuration.
 func (c *Client) Config() *Config {
 	return c.config
@@ -0,0 +1,44 @@
+package verbosity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronNext(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC) // Wednesday
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 5, 1, 12, 45, 0, 0, time.UTC)},
+		{"0 10 * * mon-fri", time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2024, 5, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 5, 5, 9, 0, 0, 0, time.UTC)},
+		{"30 12 1 * *", time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 8 13 * fri", time.Date(2024, 5, 3, 8, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)},
+		{"5,35 12 * * *", time.Date(2024, 5, 1, 12, 35, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) returned error: %v", tt.expr, err)
+			continue
+		}
+		if next := schedule.Next(base); !next.Equal(tt.expected) {
+			t.Errorf("ParseCron(%q).Next() = %v, expected %v", tt.expr, next, tt.expected)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * * mon-xyz", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) should return error", expr)
+		}
+	}
+}
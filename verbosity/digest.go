@@ -0,0 +1,414 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Digest defaults.
+const (
+	DefaultDigestWindow       = 5 * time.Minute
+	DefaultDigestMaxEvents    = 50
+	DefaultDigestEditInterval = 5 * time.Second
+	DefaultDigestCloseRetry   = 10 * time.Minute
+)
+
+// DigestEvent is a single event collected into a digest.
+type DigestEvent struct {
+	Time time.Time
+	Text string
+	// Data is passed to the digest template as is.
+	Data interface{}
+}
+
+// Digest is a batch of events for one chat and key. It is the data of the
+// digest template.
+type Digest struct {
+	ChatID int64
+	Key    string
+	PostNo int64
+	Events []DigestEvent
+	Start  time.Time
+	// Closed is set for the final render after the window ends.
+	Closed bool
+
+	rendered string
+	// edited is the time of the last write attempt
+	edited   time.Time
+	dirty    bool
+	closedAt time.Time
+}
+
+// copy returns a copy of the digest with its own events.
+func (d *Digest) copy() *Digest {
+	copied := *d
+	copied.Events = append([]DigestEvent(nil), d.Events...)
+	return &copied
+}
+
+// Digests batches events into digest messages.
+//
+// The first event for a chat and key posts a digest message. Later events
+// within Window edit that post in place, at most once per EditInterval.
+// The digest is closed after Window or MaxEvents; the next event starts a
+// new post. A closed digest whose final write fails is retried by FlushDue
+// for CloseRetry; it is dropped earlier if the API rejects the write
+// permanently, for example because the post was deleted. Call Flush on
+// shutdown to write the pending changes.
+//
+// Posts are written without holding the internal lock, so Add does not
+// wait for the chat API unless the event starts, closes or edits a digest.
+//
+//	digests := verbosity.NewDigests(client)
+//	go digests.Run(ctx, time.Second)
+//	defer digests.Flush()
+//	digests.Add(chatID, "alerts", verbosity.DigestEvent{Text: "disk is full on db1"})
+type Digests struct {
+	// Window is the time a digest collects events, DefaultDigestWindow if zero.
+	Window time.Duration
+	// MaxEvents closes a digest early, DefaultDigestMaxEvents if zero.
+	MaxEvents int
+	// EditInterval is the minimum time between edits of a digest post,
+	// DefaultDigestEditInterval if zero.
+	EditInterval time.Duration
+	// Template is the name of the client template rendering the digest.
+	// If empty, the digest is rendered as a list of events.
+	Template string
+	Locale   string
+	// CloseRetry is how long the final write of a closed digest is retried,
+	// DefaultDigestCloseRetry if zero.
+	CloseRetry time.Duration
+	// OnError is called when a digest cannot be posted or updated, and when
+	// a closed digest is dropped. It may be nil.
+	OnError func(digest *Digest, err error)
+
+	client *Client
+	now    func() time.Time
+
+	// mu guards the digests. It is not held while posts are written.
+	mu      sync.Mutex
+	digests map[string]*Digest
+	// closing holds the closed digests whose final write failed
+	closing []*Digest
+	// writes serializes the writes of each chat and key
+	writes keyLocks
+}
+
+// NewDigests creates a digest aggregator.
+func NewDigests(client *Client) *Digests {
+	return &Digests{
+		client:  client,
+		now:     time.Now,
+		digests: make(map[string]*Digest),
+	}
+}
+
+func (d *Digests) window() time.Duration {
+	if d.Window > 0 {
+		return d.Window
+	}
+	return DefaultDigestWindow
+}
+
+func (d *Digests) maxEvents() int {
+	if d.MaxEvents > 0 {
+		return d.MaxEvents
+	}
+	return DefaultDigestMaxEvents
+}
+
+func (d *Digests) editInterval() time.Duration {
+	if d.EditInterval > 0 {
+		return d.EditInterval
+	}
+	return DefaultDigestEditInterval
+}
+
+func (d *Digests) closeRetry() time.Duration {
+	if d.CloseRetry > 0 {
+		return d.CloseRetry
+	}
+	return DefaultDigestCloseRetry
+}
+
+func digestKey(chatID int64, key string) string {
+	return fmt.Sprintf("%d:%s", chatID, key)
+}
+
+// Add adds the event to the open digest of the chat and key, starting a new
+// digest if there is none. The event time defaults to now.
+func (d *Digests) Add(chatID int64, key string, event DigestEvent) error {
+	if chatID == 0 {
+		return fmt.Errorf("chat_id cannot be zero")
+	}
+	if event.Text == "" && event.Data == nil {
+		return fmt.Errorf("event cannot be empty")
+	}
+
+	d.mu.Lock()
+	now := d.now()
+	if event.Time.IsZero() {
+		event.Time = now
+	}
+
+	id := digestKey(chatID, key)
+	digest := d.digests[id]
+	if digest == nil {
+		digest = &Digest{ChatID: chatID, Key: key, Start: now}
+		d.digests[id] = digest
+	}
+	digest.Events = append(digest.Events, event)
+	digest.dirty = true
+
+	switch {
+	case len(digest.Events) >= d.maxEvents():
+		d.close(id, digest, now)
+		d.mu.Unlock()
+		return d.finish(digest)
+	case now.Sub(digest.edited) >= d.editInterval():
+		digest.edited = now
+		d.mu.Unlock()
+		return d.write(digest)
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// Get returns a copy of the open digest of the chat and key.
+func (d *Digests) Get(chatID int64, key string) (*Digest, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	digest, ok := d.digests[digestKey(chatID, key)]
+	if !ok {
+		return nil, false
+	}
+	return digest.copy(), true
+}
+
+// FlushDue retries the failed final writes, writes the delayed edits and
+// closes the digests whose window has ended.
+func (d *Digests) FlushDue() error {
+	errs := []error{d.retryClosing()}
+
+	d.mu.Lock()
+	now := d.now()
+	var closed, due []*Digest
+	for _, id := range d.keys() {
+		digest := d.digests[id]
+		if now.Sub(digest.Start) >= d.window() {
+			d.close(id, digest, now)
+			closed = append(closed, digest)
+			continue
+		}
+		if !digest.dirty || now.Sub(digest.edited) < d.editInterval() {
+			continue
+		}
+		digest.edited = now
+		due = append(due, digest)
+	}
+	d.mu.Unlock()
+
+	for _, digest := range closed {
+		errs = append(errs, d.finish(digest))
+	}
+	for _, digest := range due {
+		errs = append(errs, d.write(digest))
+	}
+	return errors.Join(errs...)
+}
+
+// Flush closes all open digests and writes them. Call it on shutdown.
+func (d *Digests) Flush() error {
+	errs := []error{d.retryClosing()}
+
+	d.mu.Lock()
+	now := d.now()
+	var closed []*Digest
+	for _, id := range d.keys() {
+		digest := d.digests[id]
+		d.close(id, digest, now)
+		closed = append(closed, digest)
+	}
+	d.mu.Unlock()
+
+	for _, digest := range closed {
+		errs = append(errs, d.finish(digest))
+	}
+	return errors.Join(errs...)
+}
+
+// Run flushes due digests every interval until the context is canceled,
+// then flushes all open digests and returns the errors of that flush with
+// the context error. Errors are also reported to OnError.
+func (d *Digests) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), d.Flush())
+		case <-ticker.C:
+			d.FlushDue()
+		}
+	}
+}
+
+// close closes the digest, so that the next event starts a new one.
+// The caller holds d.mu and calls finish after releasing it.
+func (d *Digests) close(id string, digest *Digest, now time.Time) {
+	delete(d.digests, id)
+	digest.Closed = true
+	digest.dirty = true
+	digest.closedAt = now
+}
+
+// finish writes the closed digest. If the write fails, the digest is kept
+// for a retry, unless the failure is permanent or the digest has been
+// retried for CloseRetry; then it is dropped and reported to OnError.
+func (d *Digests) finish(digest *Digest) error {
+	err := d.write(digest)
+	if err == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	var apiErr *APIError
+	permanent := errors.As(err, &apiErr) && !apiErr.Temporary()
+	expired := d.now().Sub(digest.closedAt) >= d.closeRetry()
+	if !permanent && !expired {
+		d.closing = append(d.closing, digest)
+	}
+	d.mu.Unlock()
+
+	if (permanent || expired) && d.OnError != nil {
+		d.OnError(digest, fmt.Errorf("dropped digest %s of chat %d: %w", digest.Key, digest.ChatID, err))
+	}
+	return err
+}
+
+// retryClosing writes the closed digests whose final write failed.
+func (d *Digests) retryClosing() error {
+	d.mu.Lock()
+	closing := d.closing
+	d.closing = nil
+	d.mu.Unlock()
+
+	var errs []error
+	for _, digest := range closing {
+		errs = append(errs, d.finish(digest))
+	}
+	return errors.Join(errs...)
+}
+
+// keys returns the sorted keys of the open digests.
+func (d *Digests) keys() []string {
+	keys := make([]string, 0, len(d.digests))
+	for id := range d.digests {
+		keys = append(keys, id)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// write posts or updates the digest message without holding d.mu. Writes
+// of one chat and key run one at a time, so a digest is posted once and
+// its post never goes back to an older state.
+func (d *Digests) write(digest *Digest) error {
+	unlock := d.writes.lock(digestKey(digest.ChatID, digest.Key))
+	defer unlock()
+
+	d.mu.Lock()
+	snapshot := digest.copy()
+	digest.dirty = false
+	d.mu.Unlock()
+
+	err := d.post(snapshot)
+
+	d.mu.Lock()
+	if err == nil {
+		digest.PostNo = snapshot.PostNo
+		digest.rendered = snapshot.rendered
+	} else {
+		digest.dirty = true
+	}
+	d.mu.Unlock()
+
+	if err != nil && d.OnError != nil {
+		d.OnError(snapshot, err)
+	}
+	return err
+}
+
+func (d *Digests) post(digest *Digest) error {
+	text, err := d.Render(digest)
+	if err != nil {
+		return err
+	}
+
+	if digest.PostNo == 0 {
+		response, err := d.client.SendMessage(digest.ChatID, text, nil)
+		if err != nil {
+			return fmt.Errorf("failed to post digest: %w", err)
+		}
+		digest.PostNo = response.PostNo
+		digest.rendered = text
+		return nil
+	}
+
+	if text == digest.rendered {
+		return nil
+	}
+	if _, err := d.client.editMessage(digest.ChatID, digest.PostNo, text); err != nil {
+		return fmt.Errorf("failed to update digest: %w", err)
+	}
+	digest.rendered = text
+	return nil
+}
+
+// Render returns the text of the digest.
+func (d *Digests) Render(digest *Digest) (string, error) {
+	limit := d.client.maxMessageLength()
+	if d.Template != "" {
+		text, err := d.client.renderTemplate(d.Template, digest, d.Locale)
+		if err != nil {
+			return "", err
+		}
+		return truncateMessage(text, limit), nil
+	}
+
+	title := digest.Key
+	if title == "" {
+		title = "Digest"
+	}
+	header := fmt.Sprintf("**%s**: %d %s", title, len(digest.Events), PluralEn(len(digest.Events), "event", "events"))
+	if !digest.Closed {
+		header += " (collecting)"
+	}
+
+	lines := make([]string, len(digest.Events))
+	for i, event := range digest.Events {
+		lines[i] = fmt.Sprintf("`%s` %s", event.Time.Format("15:04:05"), event.Text)
+	}
+
+	// Show the latest events that fit into a post
+	for skipped := 0; ; skipped++ {
+		text := header
+		if skipped > 0 {
+			text += fmt.Sprintf("\n… %d earlier %s", skipped, PluralEn(skipped, "event", "events"))
+		}
+		if len(lines) > skipped {
+			text += "\n" + strings.Join(lines[skipped:], "\n")
+		}
+		if limit <= 0 || utf8.RuneCountInString(text) <= limit || skipped >= len(lines) {
+			return truncateMessage(text, limit), nil
+		}
+	}
+}
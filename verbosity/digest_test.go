@@ -0,0 +1,183 @@
+package verbosity
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDigests(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	digests := NewDigests(client)
+	digests.Window = time.Minute
+	digests.MaxEvents = 3
+	digests.now = func() time.Time { return now }
+
+	digests.Add(10, "alerts", DigestEvent{Text: "disk is full"})
+	now = now.Add(time.Second)
+	digests.Add(10, "alerts", DigestEvent{Text: "cpu is high"})
+
+	if len(chat.sent) != 1 || chat.sent[0] != "**alerts**: 1 event (collecting)\n`12:00:00` disk is full" {
+		t.Fatalf("Expected a single digest post, got %q", chat.sent)
+	}
+
+	// The delayed edit is written after the edit interval
+	digests.FlushDue()
+	if chat.post(1) != "**alerts**: 1 event (collecting)\n`12:00:00` disk is full" {
+		t.Errorf("Digest should not be edited before the edit interval, got %q", chat.post(1))
+	}
+	now = now.Add(DefaultDigestEditInterval)
+	digests.FlushDue()
+	if !contains(chat.post(1), "2 events (collecting)") || !contains(chat.post(1), "cpu is high") {
+		t.Errorf("Digest should be edited in place, got %q", chat.post(1))
+	}
+
+	// The window ends
+	now = now.Add(time.Minute)
+	digests.FlushDue()
+	if _, ok := digests.Get(10, "alerts"); ok {
+		t.Error("Digest should be closed after the window")
+	}
+	if contains(chat.post(1), "collecting") {
+		t.Errorf("Closed digest should be final, got %q", chat.post(1))
+	}
+
+	// MaxEvents closes the digest early
+	for _, text := range []string{"a", "b", "c"} {
+		digests.Add(10, "alerts", DigestEvent{Text: text})
+	}
+	if len(chat.sent) != 2 || !contains(chat.post(2), "3 events\n") {
+		t.Errorf("Expected a new full digest, got %q", chat.post(2))
+	}
+
+	// Flush on shutdown
+	digests.Add(20, "", DigestEvent{Text: "deploy started"})
+	digests.Add(20, "", DigestEvent{Text: "deploy done"})
+	if err := digests.Flush(); err != nil {
+		t.Fatalf("Flush should not return error: %v", err)
+	}
+	if post := chat.post(3); post != "**Digest**: 2 events\n`12:01:06` deploy started\n`12:01:06` deploy done" {
+		t.Errorf("Unexpected flushed digest %q", post)
+	}
+}
+
+func TestDigestsTemplate(t *testing.T) {
+	chat, client := newFakeChat(t)
+	templates := NewTemplates()
+	templates.Add("digest", "", `{{len .Events}} alerts{{range .Events}}; {{.Text}}{{end}}`)
+	client.SetTemplates(templates)
+
+	digests := NewDigests(client)
+	digests.Template = "digest"
+	digests.Add(10, "alerts", DigestEvent{Text: "one"})
+	digests.Add(10, "alerts", DigestEvent{Text: "two"})
+	digests.Flush()
+
+	if chat.post(1) != "2 alerts; one; two" {
+		t.Errorf("Unexpected digest %q", chat.post(1))
+	}
+}
+
+func TestDigestsRetryFailedClose(t *testing.T) {
+	chat, client := newFakeChat(t)
+	client.config.MaxMessageLength = 120
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	digests := NewDigests(client)
+	digests.Window = time.Minute
+	digests.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		digests.Add(10, "alerts", DigestEvent{Text: "disk is full on db1"})
+	}
+
+	// The final write fails and is retried
+	chat.setFailing(true)
+	now = now.Add(time.Minute)
+	if err := digests.FlushDue(); err == nil {
+		t.Fatal("FlushDue should return the write error")
+	}
+	if _, ok := digests.Get(10, "alerts"); ok {
+		t.Error("Closed digest should not collect new events")
+	}
+	chat.setFailing(false)
+	if err := digests.FlushDue(); err != nil {
+		t.Fatalf("FlushDue should not return error: %v", err)
+	}
+
+	post := chat.post(1)
+	if !hasPrefix(post, "**alerts**: 10 events\n… ") || !contains(post, "earlier events") {
+		t.Errorf("Closed digest should be written and capped, got %q", post)
+	}
+	if len([]rune(post)) > 120 {
+		t.Errorf("Digest should fit into a post, got %d characters", len([]rune(post)))
+	}
+	if len(chat.sent) != 1 {
+		t.Errorf("Digest should not send replies, got %q", chat.sent)
+	}
+}
+
+func TestDigestsDropClosedDigestAfterCloseRetry(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	digests := NewDigests(client)
+	digests.Window = time.Minute
+	digests.now = func() time.Time { return now }
+
+	var dropped []error
+	digests.OnError = func(digest *Digest, err error) {
+		if contains(err.Error(), "dropped digest") {
+			dropped = append(dropped, err)
+		}
+	}
+
+	chat.setFailing(true)
+	digests.Add(10, "alerts", DigestEvent{Text: "disk is full on db1"})
+	now = now.Add(time.Minute)
+	digests.FlushDue()
+	digests.FlushDue()
+	if len(dropped) != 0 {
+		t.Fatalf("Closed digest should be retried, got %v", dropped)
+	}
+
+	now = now.Add(DefaultDigestCloseRetry)
+	digests.FlushDue()
+	if len(dropped) != 1 {
+		t.Fatalf("Expected the digest to be dropped, got %v", dropped)
+	}
+
+	chat.setFailing(false)
+	if err := digests.FlushDue(); err != nil || len(chat.sent) != 0 {
+		t.Errorf("Dropped digest should not be written, got %q (%v)", chat.sent, err)
+	}
+}
+
+func TestDigestsConcurrentAdd(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	digests := NewDigests(client)
+	digests.EditInterval = time.Nanosecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			digests.Add(10, "alerts", DigestEvent{Text: "disk is full"})
+		}()
+	}
+	wg.Wait()
+
+	if err := digests.Flush(); err != nil {
+		t.Fatalf("Flush should not return error: %v", err)
+	}
+	if len(chat.sent) != 1 {
+		t.Fatalf("Digest should be posted once, got %d posts", len(chat.sent))
+	}
+	if post := chat.post(1); !hasPrefix(post, "**alerts**: 20 events\n") {
+		t.Errorf("Final post should have all events, got %q", post)
+	}
+}
@@ -0,0 +1,192 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// OverflowPolicy defines what a Dispatcher does when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowReject rejects the new job with ErrQueueFull.
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued job to make room for the new one.
+	OverflowDropOldest
+)
+
+var (
+	// ErrQueueFull is returned when a job cannot be queued.
+	ErrQueueFull = errors.New("queue is full")
+	// ErrDispatcherClosed is returned when submitting to a closed dispatcher.
+	ErrDispatcherClosed = errors.New("dispatcher is closed")
+)
+
+// Dispatcher processes jobs with a bounded queue and a fixed number of workers.
+//
+// Jobs submitted for the same chat are always handled by the same worker,
+// so they run one after another in submission order.
+type Dispatcher struct {
+	// OnError is called with job errors, recovered panics and dropped jobs.
+	// It may be nil.
+	OnError func(err error)
+
+	queues []*dispatchQueue
+	policy OverflowPolicy
+	wg     sync.WaitGroup
+}
+
+type dispatchQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	jobs     []dispatchJob
+	capacity int
+	closed   bool
+}
+
+type dispatchJob struct {
+	chatID int64
+	run    func() error
+}
+
+// NewDispatcher starts a dispatcher with the given number of workers.
+// queueSize is the total number of jobs that may wait for a worker.
+func NewDispatcher(workers, queueSize int, policy OverflowPolicy) *Dispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < workers {
+		queueSize = workers
+	}
+
+	d := &Dispatcher{
+		queues: make([]*dispatchQueue, workers),
+		policy: policy,
+	}
+
+	capacity := (queueSize + workers - 1) / workers
+	for i := range d.queues {
+		queue := &dispatchQueue{capacity: capacity}
+		queue.cond = sync.NewCond(&queue.mu)
+		d.queues[i] = queue
+
+		d.wg.Add(1)
+		go d.work(queue)
+	}
+
+	return d
+}
+
+// Submit queues a job for the chat.
+func (d *Dispatcher) Submit(chatID int64, job func() error) error {
+	queue := d.queueFor(chatID)
+
+	queue.mu.Lock()
+	if queue.closed {
+		queue.mu.Unlock()
+		return ErrDispatcherClosed
+	}
+
+	var dropped []dispatchJob
+	if len(queue.jobs) >= queue.capacity {
+		if d.policy != OverflowDropOldest {
+			queue.mu.Unlock()
+			return ErrQueueFull
+		}
+		dropped = append(dropped, queue.jobs[0])
+		queue.jobs = queue.jobs[1:]
+	}
+
+	queue.jobs = append(queue.jobs, dispatchJob{chatID: chatID, run: job})
+	queue.cond.Signal()
+	queue.mu.Unlock()
+
+	for _, old := range dropped {
+		d.report(fmt.Errorf("dropped oldest job for chat %d: %w", old.chatID, ErrQueueFull))
+	}
+	return nil
+}
+
+// Len returns the number of queued jobs.
+func (d *Dispatcher) Len() int {
+	total := 0
+	for _, queue := range d.queues {
+		queue.mu.Lock()
+		total += len(queue.jobs)
+		queue.mu.Unlock()
+	}
+	return total
+}
+
+// Close stops accepting jobs and waits until the queued ones are processed
+// or the context is done.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	for _, queue := range d.queues {
+		queue.mu.Lock()
+		queue.closed = true
+		queue.cond.Broadcast()
+		queue.mu.Unlock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) work(queue *dispatchQueue) {
+	defer d.wg.Done()
+
+	for {
+		queue.mu.Lock()
+		for len(queue.jobs) == 0 && !queue.closed {
+			queue.cond.Wait()
+		}
+		if len(queue.jobs) == 0 {
+			queue.mu.Unlock()
+			return
+		}
+		job := queue.jobs[0]
+		queue.jobs = queue.jobs[1:]
+		queue.mu.Unlock()
+
+		if err := d.run(job); err != nil {
+			d.report(fmt.Errorf("job for chat %d failed: %w", job.chatID, err))
+		}
+	}
+}
+
+// run runs the job, turning a panic into an error so that one bad job
+// does not stop the worker.
+func (d *Dispatcher) run(job dispatchJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.run()
+}
+
+func (d *Dispatcher) queueFor(chatID int64) *dispatchQueue {
+	index := chatID % int64(len(d.queues))
+	if index < 0 {
+		index = -index
+	}
+	return d.queues[index]
+}
+
+func (d *Dispatcher) report(err error) {
+	if d.OnError != nil {
+		d.OnError(err)
+	}
+}
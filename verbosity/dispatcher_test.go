@@ -0,0 +1,191 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcherKeepsPerChatOrder(t *testing.T) {
+	dispatcher := NewDispatcher(4, 100, OverflowReject)
+
+	var mu sync.Mutex
+	order := map[int64][]int{}
+	for i := 0; i < 20; i++ {
+		for chatID := int64(1); chatID <= 3; chatID++ {
+			chatID, i := chatID, i
+			err := dispatcher.Submit(chatID, func() error {
+				mu.Lock()
+				order[chatID] = append(order[chatID], i)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Submit should not return error: %v", err)
+			}
+		}
+	}
+
+	if err := dispatcher.Close(context.Background()); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+
+	for chatID, values := range order {
+		if len(values) != 20 {
+			t.Errorf("Expected 20 jobs for chat %d, got %d", chatID, len(values))
+		}
+		for i, value := range values {
+			if value != i {
+				t.Errorf("Expected jobs for chat %d in order, got %v", chatID, values)
+				break
+			}
+		}
+	}
+}
+
+func TestDispatcherOverflowPolicies(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowReject, OverflowDropOldest} {
+		dispatcher := NewDispatcher(1, 1, policy)
+
+		var dropped []error
+		dispatcher.OnError = func(err error) {
+			dropped = append(dropped, err)
+		}
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		dispatcher.Submit(1, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		<-started
+
+		ran := make(chan string, 2)
+		dispatcher.Submit(1, func() error { ran <- "first"; return nil })
+		err := dispatcher.Submit(1, func() error { ran <- "second"; return nil })
+
+		close(release)
+		dispatcher.Close(context.Background())
+		close(ran)
+
+		var results []string
+		for name := range ran {
+			results = append(results, name)
+		}
+
+		switch policy {
+		case OverflowReject:
+			if !errors.Is(err, ErrQueueFull) {
+				t.Errorf("Expected ErrQueueFull, got %v", err)
+			}
+			if len(results) != 1 || results[0] != "first" {
+				t.Errorf("Expected only the first job to run, got %v", results)
+			}
+		case OverflowDropOldest:
+			if err != nil {
+				t.Errorf("Submit should not return error: %v", err)
+			}
+			if len(results) != 1 || results[0] != "second" {
+				t.Errorf("Expected only the second job to run, got %v", results)
+			}
+			if len(dropped) != 1 || !errors.Is(dropped[0], ErrQueueFull) {
+				t.Errorf("Expected dropped job to be reported, got %v", dropped)
+			}
+		}
+	}
+}
+
+func TestDispatcherRejectsAfterClose(t *testing.T) {
+	dispatcher := NewDispatcher(2, 10, OverflowReject)
+	dispatcher.Close(context.Background())
+
+	if err := dispatcher.Submit(1, func() error { return nil }); !errors.Is(err, ErrDispatcherClosed) {
+		t.Errorf("Expected ErrDispatcherClosed, got %v", err)
+	}
+}
+
+func TestWebhookHandlerAsync(t *testing.T) {
+	handler := newTestWebhookHandler(t)
+	handler.Dispatcher = NewDispatcher(2, 10, OverflowReject)
+
+	processed := make(chan int64, 1)
+	handler.OnMessage = func(req *BotRequest) error {
+		processed <- req.PostNo
+		return nil
+	}
+
+	body := `{"user_id": 1, "chat_id": 10, "post_no": 7, "text": "/report"}`
+	if code := postWebhook(t, handler, body); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+
+	select {
+	case postNo := <-processed:
+		if postNo != 7 {
+			t.Errorf("Expected post 7, got %d", postNo)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected request to be processed asynchronously")
+	}
+
+	handler.Dispatcher.Close(context.Background())
+}
+
+func TestDispatcherRecoversPanics(t *testing.T) {
+	dispatcher := NewDispatcher(1, 10, OverflowReject)
+
+	var errs []error
+	dispatcher.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+
+	ran := false
+	dispatcher.Submit(1, func() error { panic("boom") })
+	dispatcher.Submit(1, func() error { ran = true; return nil })
+	dispatcher.Close(context.Background())
+
+	if !ran {
+		t.Error("Expected the worker to keep running after a panic")
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "panic: boom") {
+		t.Errorf("Expected the panic to be reported, got %v", errs)
+	}
+}
+
+func TestWebhookHandlerAsyncRetriesFailedDelivery(t *testing.T) {
+	handler := newTestWebhookHandler(t)
+	handler.Dispatcher = NewDispatcher(1, 10, OverflowReject)
+
+	calls := 0
+	handler.OnMessage = func(req *BotRequest) error {
+		calls++
+		if calls == 1 {
+			panic("temporary failure")
+		}
+		return nil
+	}
+
+	failed := make(chan struct{})
+	handler.Dispatcher.OnError = func(err error) {
+		close(failed)
+	}
+
+	body := `{"user_id": 1, "chat_id": 10, "post_no": 8, "text": "hi"}`
+	if code := postWebhook(t, handler, body); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	<-failed
+	if code := postWebhook(t, handler, body); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	handler.Dispatcher.Close(context.Background())
+
+	if calls != 2 {
+		t.Errorf("Expected the retried delivery to be processed, got %d calls", calls)
+	}
+}
@@ -0,0 +1,161 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// DefaultMaxDownloadSize is the maximum size of a downloaded file used
+// when Config.MaxDownloadSize is zero.
+const DefaultMaxDownloadSize = 100 << 20
+
+// ErrFileTooLarge is returned when a downloaded file exceeds the size limit.
+var ErrFileTooLarge = errors.New("file exceeds the download size limit")
+
+// FileMeta describes a downloaded file.
+type FileMeta struct {
+	GUID        string
+	Name        string
+	ContentType string
+	// Size is the file size in bytes, or -1 if the server did not report it.
+	Size int64
+}
+
+// maxDownloadSize returns the configured limit, or 0 if there is no limit.
+func (c *Client) maxDownloadSize() int64 {
+	switch {
+	case c.config.MaxDownloadSize < 0:
+		return 0
+	case c.config.MaxDownloadSize == 0:
+		return DefaultMaxDownloadSize
+	default:
+		return c.config.MaxDownloadSize
+	}
+}
+
+// DownloadFile downloads a file by GUID, e.g. from BotRequest.FileGUID or
+// BotRequest.Attachments. The caller must close the returned reader.
+//
+// The content is streamed; reading more than Config.MaxDownloadSize bytes
+// fails with ErrFileTooLarge. The download is not limited by the client
+// timeout; use the context to bound it.
+//
+// API: GET https://file.verbosity.io/file/{guid}
+func (c *Client) DownloadFile(ctx context.Context, guid string) (io.ReadCloser, FileMeta, error) {
+	meta := FileMeta{GUID: guid, Size: -1}
+	if guid == "" {
+		return nil, meta, fmt.Errorf("guid cannot be empty")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.FileURL+"/file/"+url.PathEscape(guid), nil)
+	if err != nil {
+		return nil, meta, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-APIToken", c.config.APIToken)
+
+	resp, err := c.fileHTTPClient().Do(req)
+	if err != nil {
+		return nil, meta, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, meta, c.handleError(resp.StatusCode, body)
+	}
+
+	meta.ContentType = resp.Header.Get("Content-Type")
+	meta.Size = resp.ContentLength
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		meta.Name = params["filename"]
+	}
+
+	limit := c.maxDownloadSize()
+	if limit > 0 && meta.Size > limit {
+		resp.Body.Close()
+		return nil, meta, fmt.Errorf("%w: %d bytes, limit %d", ErrFileTooLarge, meta.Size, limit)
+	}
+	if limit == 0 {
+		return resp.Body, meta, nil
+	}
+	return &limitedBody{body: resp.Body, left: limit}, meta, nil
+}
+
+// DownloadToPath downloads a file by GUID and saves it to the path. If the
+// path is a directory, the file is saved there under its name, or its GUID
+// if the server did not report a name.
+//
+// The file is written to a temporary file and renamed when complete, so a
+// failed download does not leave a partial file behind.
+func (c *Client) DownloadToPath(ctx context.Context, guid, path string) (FileMeta, error) {
+	body, meta, err := c.DownloadFile(ctx, guid)
+	if err != nil {
+		return meta, err
+	}
+	defer body.Close()
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		name := filepath.Base(meta.Name)
+		if name == "." || name == string(filepath.Separator) || name == ".." {
+			name = guid
+		}
+		path = filepath.Join(path, name)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return meta, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return meta, fmt.Errorf("failed to save file: %w", err)
+	}
+	if meta.Size >= 0 && written != meta.Size {
+		return meta, fmt.Errorf("failed to save file: got %d of %d bytes", written, meta.Size)
+	}
+	meta.Size = written
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return meta, fmt.Errorf("failed to save file: %w", err)
+	}
+	return meta, nil
+}
+
+// limitedBody fails with ErrFileTooLarge when more than left bytes are read.
+type limitedBody struct {
+	body io.ReadCloser
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, ErrFileTooLarge
+	}
+	// Read one byte past the limit to tell a file of exactly the limit
+	// from a larger one
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.body.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return n + int(b.left), ErrFileTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,94 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newFileServer(t *testing.T, files map[string]string) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		guid := strings.TrimPrefix(r.URL.Path, "/file/")
+		content, ok := files[guid]
+		if r.Header.Get("X-APIToken") == "" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"not_found","message":"file not found"}`))
+			return
+		}
+		if guid != "unnamed" {
+			w.Header().Set("Content-Disposition", `attachment; filename="report.txt"`)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(&Config{APIURL: server.URL, FileURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+}
+
+func TestDownloadFile(t *testing.T) {
+	client := newFileServer(t, map[string]string{"abc": "hello world", "unnamed": "data"})
+
+	body, meta, err := client.DownloadFile(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("DownloadFile should not return error: %v", err)
+	}
+	defer body.Close()
+	if meta.Name != "report.txt" || meta.ContentType != "text/plain" || meta.Size != 11 {
+		t.Errorf("Unexpected meta %+v", meta)
+	}
+
+	dir := t.TempDir()
+	if _, err := client.DownloadToPath(context.Background(), "abc", dir); err != nil {
+		t.Fatalf("DownloadToPath should not return error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "report.txt")); string(data) != "hello world" {
+		t.Errorf("Unexpected saved file %q", data)
+	}
+	if _, err := client.DownloadToPath(context.Background(), "unnamed", dir); err != nil {
+		t.Fatalf("DownloadToPath should not return error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unnamed")); err != nil {
+		t.Errorf("File without a name should be saved under its GUID: %v", err)
+	}
+
+	if _, _, err := client.DownloadFile(context.Background(), "missing"); !IsNotFoundError(err) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestDownloadFileLimit(t *testing.T) {
+	client := newFileServer(t, map[string]string{"big": strings.Repeat("x", 100)})
+
+	client.config.MaxDownloadSize = 10
+	if _, _, err := client.DownloadFile(context.Background(), "big"); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "big.txt")
+	if _, err := client.DownloadToPath(context.Background(), "big", path); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Failed download should not leave a file")
+	}
+
+	// The streamed body is limited when the size is unknown
+	body := &limitedBody{body: io.NopCloser(strings.NewReader(strings.Repeat("x", 100))), left: 10}
+	buf := make([]byte, 64)
+	n, err := body.Read(buf)
+	if n != 10 || !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Expected 10 bytes and ErrFileTooLarge, got %d %v", n, err)
+	}
+
+	client.config.MaxDownloadSize = 100
+	if _, err := client.DownloadToPath(context.Background(), "big", path); err != nil {
+		t.Errorf("File of exactly the limit should be downloaded: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// expiryState is the part of a stored item used by the expiry loop.
+type expiryState struct {
+	ID       string
+	Open     bool
+	Deadline time.Time
+	// Finished is when the item was finished, Done whether its follow-up
+	// has succeeded.
+	Finished time.Time
+	Done     bool
+}
+
+// expirable is a stored item with a deadline, such as an approval or a poll.
+type expirable interface {
+	expiryState() expiryState
+}
+
+// expiryLoop is the expiry loop shared by approvals and polls. Open items
+// are finished after their deadline, the follow-up of finished items, such
+// as updating the post and calling a handler, is retried until it succeeds
+// and finished items are deleted after the retention period.
+type expiryLoop struct {
+	store  Store
+	prefix string
+	// newItem returns an empty item to load a stored one into.
+	newItem func() expirable
+	// finish finishes an open item past its deadline. It is called with mu
+	// held and must reserve the follow-up.
+	finish func(item expirable) error
+	// followUp runs the reserved follow-up of a finished item. It is called
+	// without mu held and must release the reservation.
+	followUp func(item expirable) error
+
+	// mu is the state lock of the owner
+	mu *sync.Mutex
+	// reserved holds the IDs of items whose follow-up is running
+	reserved map[string]bool
+}
+
+// reserve reserves the follow-up of the item. The caller holds mu.
+func (e *expiryLoop) reserve(id string) {
+	if e.reserved == nil {
+		e.reserved = make(map[string]bool)
+	}
+	e.reserved[id] = true
+}
+
+// release releases the reservation of the item. The caller holds mu.
+func (e *expiryLoop) release(id string) {
+	delete(e.reserved, id)
+}
+
+// process finishes the items past their deadline, runs the pending
+// follow-ups and deletes the items finished before now minus retention.
+func (e *expiryLoop) process(now time.Time, retention time.Duration) error {
+	due, errs := e.collect(now, retention)
+	for _, item := range due {
+		if err := e.followUp(item); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// collect finishes the items past their deadline, deletes the old ones and
+// returns the items whose follow-up must run.
+func (e *expiryLoop) collect(now time.Time, retention time.Duration) ([]expirable, []error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	keys, err := e.store.Keys(e.prefix)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var due []expirable
+	var errs []error
+	for _, key := range keys {
+		item := e.newItem()
+		if err := getJSON(e.store, key, item); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		state := item.expiryState()
+		switch {
+		case state.Open:
+			if state.Deadline.IsZero() || now.Before(state.Deadline) {
+				continue
+			}
+			if err := e.finish(item); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			due = append(due, item)
+		case !state.Done:
+			if !e.reserved[state.ID] {
+				e.reserve(state.ID)
+				due = append(due, item)
+			}
+		case now.Sub(state.Finished) >= retention:
+			if err := e.store.Delete(key); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return due, errs
+}
+
+// runEvery calls fn every interval until the context is canceled and
+// passes its errors to onError.
+func runEvery(ctx context.Context, interval time.Duration, fn func() error, onError func(err error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := fn(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
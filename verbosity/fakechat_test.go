@@ -0,0 +1,184 @@
+package verbosity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeChat is a test server that records sent and updated posts.
+type fakeChat struct {
+	mu      sync.Mutex
+	posts   map[int64]string
+	sent    []string
+	lastNo  int64
+	users   map[int64]User
+	chats   map[int64]Chat
+	orgs    map[int64]Org
+	replies map[int64]int64
+	// targets holds the chat or user ID of each sent message.
+	targets []int64
+	// files holds the uploaded files by GUID, attachments the attached GUIDs by post.
+	files       map[string]string
+	attachments map[int64][]string
+	uploads     []string
+	// parsed holds the text_parsed blocks of each post.
+	parsed map[int64][]TextBlock
+	// failing makes the requests that change posts fail.
+	failing bool
+	// rejectAttachments makes the updates with attachments fail.
+	rejectAttachments bool
+}
+
+func newFakeChat(t *testing.T) (*fakeChat, *Client) {
+	chat := &fakeChat{
+		posts:       make(map[int64]string),
+		users:       make(map[int64]User),
+		chats:       make(map[int64]Chat),
+		orgs:        make(map[int64]Org),
+		files:       make(map[string]string),
+		attachments: make(map[int64][]string),
+		replies:     make(map[int64]int64),
+		parsed:      make(map[int64][]TextBlock),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Text    string `json:"text"`
+			ChatID  int64  `json:"chat_id"`
+			UserID  int64  `json:"user_id"`
+			ReplyNo *int64 `json:"reply_no"`
+
+			TextParsed []TextBlock `json:"text_parsed"`
+
+			Attachments []string `json:"attachments"`
+		}
+		if r.Header.Get("Content-Type") == "application/json" {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Failed to decode request body: %v", err)
+			}
+		}
+
+		chat.mu.Lock()
+		defer chat.mu.Unlock()
+
+		if chat.failing && r.Method != http.MethodGet {
+			http.Error(w, `{"error": "unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/core/user":
+			var response UsersResponse
+			for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+				var userID int64
+				fmt.Sscanf(id, "%d", &userID)
+				if user, ok := chat.users[userID]; ok {
+					response.Users = append(response.Users, user)
+				}
+			}
+			json.NewEncoder(w).Encode(response)
+		case r.Method == http.MethodGet && r.URL.Path == "/core/chat/sync":
+			var response ChatSyncResponse
+			for id := range chat.chats {
+				response.Chats = append(response.Chats, id)
+			}
+			json.NewEncoder(w).Encode(response)
+		case r.Method == http.MethodGet && r.URL.Path == "/core/org":
+			var response OrgsResponse
+			for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+				var orgID int64
+				fmt.Sscanf(id, "%d", &orgID)
+				if org, ok := chat.orgs[orgID]; ok {
+					response.Orgs = append(response.Orgs, org)
+				}
+			}
+			json.NewEncoder(w).Encode(response)
+		case r.Method == http.MethodGet && r.URL.Path == "/core/chat":
+			var response ChatsResponse
+			for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+				var chatID int64
+				fmt.Sscanf(id, "%d", &chatID)
+				if c, ok := chat.chats[chatID]; ok {
+					response.Chats = append(response.Chats, c)
+				}
+			}
+			json.NewEncoder(w).Encode(response)
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/core/chat/pm/"):
+			var userID int64
+			fmt.Sscanf(r.URL.Path, "/core/chat/pm/%d", &userID)
+			json.NewEncoder(w).Encode(Chat{ID: 1000 + userID, PM: true})
+		case r.Method == http.MethodPost && r.URL.Path == "/new/upload":
+			file, _, err := r.FormFile("data")
+			if err != nil {
+				t.Errorf("Failed to read uploaded file: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(file)
+			guid := fmt.Sprintf("file-%d", len(chat.files)+1)
+			chat.files[guid] = string(data)
+			chat.uploads = append(chat.uploads, r.FormValue("chat_id"))
+			json.NewEncoder(w).Encode(FileUploadResponse{GUID: guid})
+		case r.Method == http.MethodPost && (r.URL.Path == "/bot/message" || r.URL.Path == "/msg/post/private"):
+			chat.lastNo++
+			chat.posts[chat.lastNo] = req.Text
+			chat.sent = append(chat.sent, req.Text)
+			chat.targets = append(chat.targets, req.ChatID+req.UserID)
+			chat.parsed[chat.lastNo] = req.TextParsed
+			if req.ReplyNo != nil {
+				chat.replies[chat.lastNo] = *req.ReplyNo
+			}
+			json.NewEncoder(w).Encode(MessageResponse{PostNo: chat.lastNo})
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/msg/post/"):
+			var chatID, postNo int64
+			fmt.Sscanf(r.URL.Path, "/msg/post/%d/%d", &chatID, &postNo)
+			if _, ok := chat.posts[postNo]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if chat.rejectAttachments && len(req.Attachments) > 0 {
+				http.Error(w, `{"error": "invalid attachments"}`, http.StatusBadRequest)
+				return
+			}
+			chat.posts[postNo] = req.Text
+			chat.parsed[postNo] = req.TextParsed
+			if len(req.Attachments) > 0 {
+				chat.attachments[postNo] = req.Attachments
+			}
+			json.NewEncoder(w).Encode(UpdateMessageResponse{})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/msg/post/"):
+			var chatID, postNo int64
+			fmt.Sscanf(r.URL.Path, "/msg/post/%d/%d", &chatID, &postNo)
+			if _, ok := chat.posts[postNo]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(chat.posts, postNo)
+			json.NewEncoder(w).Encode(DeleteMessageResponse{})
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return chat, NewClient(&Config{APIURL: server.URL, FileURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+}
+
+// setFailing makes the requests that change posts fail or succeed again.
+func (c *fakeChat) setFailing(failing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failing = failing
+}
+
+func (c *fakeChat) post(postNo int64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.posts[postNo]
+}
@@ -2,16 +2,46 @@ package verbosity
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net/textproto"
 	"os"
+	"strings"
+	"time"
 )
 
+// UploadOptions configures a file upload.
+type UploadOptions struct {
+	// Context cancels the upload. If set, it replaces the client timeout,
+	// so long uploads are bounded only by the context. Without it, the
+	// client timeout bounds the time without progress, see UploadFileData.
+	Context context.Context
+	// Progress is called as the file data is sent with the bytes sent so far
+	// and the file size.
+	Progress func(sent, total int64)
+	// ContentType is the content type of the file, application/octet-stream if empty.
+	ContentType string
+	// BytesPerSecond limits the upload bandwidth. Zero means no limit.
+	BytesPerSecond int64
+}
+
+// uploadOptions returns the first non-nil options or the defaults.
+func uploadOptions(opts []*UploadOptions) *UploadOptions {
+	for _, o := range opts {
+		if o != nil {
+			return o
+		}
+	}
+	return &UploadOptions{}
+}
+
 // UploadFile uploads a file to the server and returns its GUID.
+// The options are optional, see UploadOptions.
 //
 // API: POST https://file.verbosity.io/new/upload
-func (c *Client) UploadFile(chatID int64, filePath string) (*FileUploadResponse, error) {
+func (c *Client) UploadFile(chatID int64, filePath string, opts ...*UploadOptions) (*FileUploadResponse, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
@@ -23,13 +53,21 @@ func (c *Client) UploadFile(chatID int64, filePath string) (*FileUploadResponse,
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	return c.UploadFileData(chatID, file, fileInfo.Size(), fileInfo.Name())
+	return c.UploadFileData(chatID, file, fileInfo.Size(), fileInfo.Name(), opts...)
 }
 
 // UploadFileData uploads file data directly.
 //
+// The multipart body is streamed from the reader, so memory use does not
+// depend on the file size. Exactly size bytes are read from the reader.
+// Without a context in the options, the client timeout bounds each wait for
+// the reader and the wait for the response after the last byte, not the
+// whole upload, so large files do not fail while they are being sent. With
+// a context, only the context bounds the upload.
+// The options are optional, see UploadOptions.
+//
 // API: POST https://file.verbosity.io/new/upload
-func (c *Client) UploadFileData(chatID int64, reader io.Reader, size int64, filename string) (*FileUploadResponse, error) {
+func (c *Client) UploadFileData(chatID int64, reader io.Reader, size int64, filename string, opts ...*UploadOptions) (*FileUploadResponse, error) {
 	if chatID == 0 {
 		return nil, fmt.Errorf("chat_id cannot be zero")
 	}
@@ -37,45 +75,173 @@ func (c *Client) UploadFileData(chatID int64, reader io.Reader, size int64, file
 		return nil, fmt.Errorf("file size must be positive")
 	}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	options := uploadOptions(opts)
+	ctx := options.Context
+	var idle *time.Timer
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		if timeout := c.httpClient.Timeout; timeout > 0 {
+			idle = time.AfterFunc(timeout, cancel)
+			defer idle.Stop()
+		}
+	}
+	reader = &uploadReader{
+		ctx:      ctx,
+		reader:   reader,
+		total:    size,
+		progress: options.Progress,
+		rate:     options.BytesPerSecond,
+		start:    time.Now(),
+		idle:     idle,
+		timeout:  c.httpClient.Timeout,
+	}
+
+	body, contentType, length, err := newUploadBody(chatID, reader, size, filename, options.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newFileRequest("/new/upload", body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	req.ContentLength = length
+
+	var response FileUploadResponse
+	if err := c.doWith(c.fileHTTPClient(), req, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// newUploadBody returns a multipart body with the chat_id and size fields
+// and the data file part, streamed through a pipe, with its content type
+// and length.
+func newUploadBody(chatID int64, reader io.Reader, size int64, filename, fileType string) (io.ReadCloser, string, int64, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
 
+	// The length of the form without the file data is computed by writing
+	// the form with an empty file and the same boundary.
+	counter := &countingWriter{}
+	empty := multipart.NewWriter(counter)
+	if err := empty.SetBoundary(writer.Boundary()); err != nil {
+		return nil, "", 0, fmt.Errorf("failed to set multipart boundary: %w", err)
+	}
+	if err := writeUploadForm(empty, chatID, bytes.NewReader(nil), 0, size, filename, fileType); err != nil {
+		return nil, "", 0, err
+	}
+
+	go func() {
+		pw.CloseWithError(writeUploadForm(writer, chatID, reader, size, size, filename, fileType))
+	}()
+
+	return pr, writer.FormDataContentType(), counter.n + size, nil
+}
+
+// writeUploadForm writes the upload form with n bytes of file data.
+func writeUploadForm(writer *multipart.Writer, chatID int64, reader io.Reader, n, size int64, filename, fileType string) error {
 	// Add chat_id field
 	if err := writer.WriteField("chat_id", fmt.Sprintf("%d", chatID)); err != nil {
-		return nil, fmt.Errorf("failed to write chat_id field: %w", err)
+		return fmt.Errorf("failed to write chat_id field: %w", err)
 	}
 
 	// Add size field
 	if err := writer.WriteField("size", fmt.Sprintf("%d", size)); err != nil {
-		return nil, fmt.Errorf("failed to write size field: %w", err)
+		return fmt.Errorf("failed to write size field: %w", err)
 	}
 
 	// Add file field
-	part, err := writer.CreateFormFile("data", filename)
+	if fileType == "" {
+		fileType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="data"; filename="%s"`, quoteEscaper.Replace(filename)))
+	header.Set("Content-Type", fileType)
+	part, err := writer.CreatePart(header)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create form file: %w", err)
+		return fmt.Errorf("failed to create form file: %w", err)
 	}
 
-	if _, err := io.Copy(part, reader); err != nil {
-		return nil, fmt.Errorf("failed to copy file data: %w", err)
+	if copied, err := io.CopyN(part, reader, n); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("file data is shorter than its size: got %d of %d bytes", copied, n)
+		}
+		return fmt.Errorf("failed to copy file data: %w", err)
 	}
 
 	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+		return fmt.Errorf("failed to close multipart writer: %w", err)
 	}
+	return nil
+}
 
-	req, err := c.newFileRequest("/new/upload", body)
-	if err != nil {
-		return nil, err
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// uploadReader reports the upload progress, limits the bandwidth and stops
+// reading when the context is canceled. If idle is set, it is restarted
+// with the timeout on every read, so it fires only when the upload stalls.
+type uploadReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	total    int64
+	sent     int64
+	progress func(sent, total int64)
+	rate     int64
+	start    time.Time
+	idle     *time.Timer
+	timeout  time.Duration
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if r.idle != nil {
+		defer r.idle.Reset(r.timeout)
+		r.idle.Reset(r.timeout)
+	}
+	// Read in chunks of a tenth of a second at the limited rate
+	if chunk := r.rate / 10; r.rate > 0 && chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	var response FileUploadResponse
-	if err := c.do(req, &response); err != nil {
-		return nil, err
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.sent += int64(n)
+		if r.progress != nil {
+			r.progress(r.sent, r.total)
+		}
+		if r.rate > 0 {
+			due := r.start.Add(time.Duration(float64(r.sent) / float64(r.rate) * float64(time.Second)))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-r.ctx.Done():
+					timer.Stop()
+					return n, r.ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
 	}
+	return n, err
+}
 
-	return &response, nil
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
 }
 
 // UploadFileFromBytes uploads a file from byte slice.
@@ -134,32 +300,103 @@ func (c *Client) UploadVideo(chatID int64, videoPath string) (*FileUploadRespons
 	return c.UploadFile(chatID, videoPath)
 }
 
-// UploadToMultipleChats uploads a file and sends it to multiple chats.
+// ChatUploadResult is the outcome of a file upload to one chat.
+type ChatUploadResult struct {
+	ChatID int64
+	GUID   string
+	PostNo int64
+	Err    error
+}
+
+// UploadToMultipleChats uploads a file to each of the chats and posts it as
+// an attachment with the file name as the text. It returns the GUID of the
+// first successful upload; the error is not nil if any chat failed.
 //
-// Returns the file GUID and any error.
+// Deprecated: use UploadToMultipleChatsWithOptions, which returns a result
+// per chat.
 func (c *Client) UploadToMultipleChats(filePath string, chatIDs []int64) (string, error) {
+	results, err := c.UploadToMultipleChatsWithOptions(filePath, chatIDs, nil)
+	for _, result := range results {
+		if result.GUID != "" {
+			return result.GUID, err
+		}
+	}
+	return "", err
+}
+
+// UploadToMultipleChatsWithOptions uploads a file to each of the chats and
+// posts it as an attachment with the file name as the text.
+// See UploadDataToMultipleChats.
+func (c *Client) UploadToMultipleChatsWithOptions(filePath string, chatIDs []int64, opts *BroadcastOptions) ([]ChatUploadResult, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return "", fmt.Errorf("failed to get file info: %w", err)
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	return c.UploadDataToMultipleChats(file, fileInfo.Size(), fileInfo.Name(), chatIDs, opts)
+}
+
+// UploadDataToMultipleChats uploads the data to each of the chats, as the
+// API requires an upload per chat, and posts it as an attachment with the
+// file name as the text.
+//
+// The chats are handled by a bounded worker pool configured like a
+// broadcast, see BroadcastOptions; the options may be nil. The context of
+// the options also cancels the running uploads. The data is read through
+// the io.ReaderAt for every chat, so an open file is reused without loading
+// it into memory.
+//
+// The results are in the order of chatIDs and tell the GUID and post
+// number for each chat. Chats skipped after StopOnError or a canceled
+// context have ErrBroadcastStopped. The error is not nil if any chat failed.
+func (c *Client) UploadDataToMultipleChats(data io.ReaderAt, size int64, filename string, chatIDs []int64, opts *BroadcastOptions) ([]ChatUploadResult, error) {
+	if len(chatIDs) == 0 {
+		return nil, fmt.Errorf("chat_ids slice cannot be empty")
 	}
+	if opts == nil {
+		opts = &BroadcastOptions{}
+	}
+	upload := &UploadOptions{Context: opts.Context}
+
+	targets := make([]BroadcastResult, len(chatIDs))
+	for i, chatID := range chatIDs {
+		targets[i].ChatID = chatID
+	}
+	guids := make([]string, len(chatIDs))
+	broadcast, err := c.broadcast(targets, opts, "upload file", func(i int, result *BroadcastResult) error {
+		guid, postNo, err := c.uploadToChat(result.ChatID, io.NewSectionReader(data, 0, size), size, filename, upload)
+		guids[i], result.PostNo = guid, postNo
+		return err
+	})
 
-	uploadResponse, err := c.UploadFileData(0, file, fileInfo.Size(), fileInfo.Name())
+	results := make([]ChatUploadResult, len(broadcast))
+	for i, result := range broadcast {
+		results[i] = ChatUploadResult{ChatID: result.ChatID, GUID: guids[i], PostNo: result.PostNo, Err: result.Err}
+	}
+	return results, err
+}
+
+// uploadToChat uploads the file to the chat and posts it as an attachment.
+// It returns the GUID and the post number as far as it got.
+func (c *Client) uploadToChat(chatID int64, reader io.Reader, size int64, filename string, opts *UploadOptions) (string, int64, error) {
+	upload, err := c.UploadFileData(chatID, reader, size, filename, opts)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	for _, chatID := range chatIDs {
-		_, err := c.UploadFileData(chatID, bytes.NewReader([]byte{}), fileInfo.Size(), fileInfo.Name())
-		if err != nil {
-			return uploadResponse.GUID, fmt.Errorf("failed to upload to chat %d: %w", chatID, err)
-		}
+	post, err := c.SendMessage(chatID, filename, nil)
+	if err != nil {
+		return upload.GUID, 0, fmt.Errorf("failed to post file: %w", err)
 	}
 
-	return uploadResponse.GUID, nil
+	if _, err := c.UpdateMessageWithAttachments(chatID, post.PostNo, filename, []string{upload.GUID}); err != nil {
+		return upload.GUID, post.PostNo, fmt.Errorf("failed to attach file: %w", err)
+	}
+	return upload.GUID, post.PostNo, nil
 }
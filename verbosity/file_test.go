@@ -0,0 +1,199 @@
+package verbosity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// patternReader produces n bytes of a repeating pattern.
+type patternReader struct {
+	n int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = byte('a' + i%26)
+	}
+	r.n -= int64(len(p))
+	return len(p), nil
+}
+
+func TestUploadFileDataStreaming(t *testing.T) {
+	const size = 8 << 20
+
+	var contentLength, fileSize int64
+	var chatID, sizeField string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("Expected multipart body: %v", err)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(part)
+			switch part.FormName() {
+			case "chat_id":
+				chatID = string(data)
+			case "size":
+				sizeField = string(data)
+			case "data":
+				fileSize = int64(len(data))
+			}
+		}
+		json.NewEncoder(w).Encode(FileUploadResponse{GUID: "guid"})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIURL: server.URL, FileURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+	response, err := client.UploadFileData(10, &patternReader{n: size}, size, "video.mp4")
+	if err != nil {
+		t.Fatalf("UploadFileData should not return error: %v", err)
+	}
+	if response.GUID != "guid" || chatID != "10" || sizeField != "8388608" || fileSize != size {
+		t.Errorf("Unexpected upload: guid %q chat_id %q size %q data %d bytes", response.GUID, chatID, sizeField, fileSize)
+	}
+	if contentLength <= size {
+		t.Errorf("Expected Content-Length of the whole form, got %d", contentLength)
+	}
+
+	_, err = client.UploadFileData(10, strings.NewReader("short"), 100, "short.txt")
+	if err == nil || !strings.Contains(err.Error(), "shorter than its size") {
+		t.Errorf("Expected error for short data, got %v", err)
+	}
+}
+
+func TestUploadFileDataOptions(t *testing.T) {
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, header, err := r.FormFile("data"); err == nil {
+			contentType = header.Header.Get("Content-Type")
+		}
+		json.NewEncoder(w).Encode(FileUploadResponse{GUID: "guid"})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIURL: server.URL, FileURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+
+	var sent, total int64
+	calls := 0
+	_, err := client.UploadFileData(10, &patternReader{n: 100 << 10}, 100<<10, "report.csv", &UploadOptions{
+		ContentType:    "text/csv",
+		BytesPerSecond: 1 << 20,
+		Progress: func(s, t int64) {
+			calls++
+			sent, total = s, t
+		},
+	})
+	if err != nil {
+		t.Fatalf("UploadFileData should not return error: %v", err)
+	}
+	if contentType != "text/csv" || sent != 100<<10 || total != 100<<10 || calls < 2 {
+		t.Errorf("Unexpected upload: content type %q, progress %d/%d in %d calls", contentType, sent, total, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = client.UploadFileData(10, &patternReader{n: 1 << 20}, 1<<20, "big.bin", &UploadOptions{
+		Context: ctx,
+		Progress: func(sent, total int64) {
+			if sent > 64<<10 {
+				cancel()
+			}
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected canceled upload, got %v", err)
+	}
+}
+
+func TestUploadFileDataTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		time.Sleep(100 * time.Millisecond)
+		json.NewEncoder(w).Encode(FileUploadResponse{GUID: "guid"})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIURL: server.URL, FileURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+	client.httpClient.Timeout = 20 * time.Millisecond
+
+	// Without a context the client timeout applies
+	if _, err := client.UploadFileData(10, strings.NewReader("data"), 4, "a.txt"); err == nil {
+		t.Error("Upload without a context should be bounded by the client timeout")
+	}
+
+	// The timeout bounds the time without progress, not the whole upload
+	client.httpClient.Timeout = 150 * time.Millisecond
+	if _, err := client.UploadFileData(10, &patternReader{n: 600}, 600, "slow.bin", &UploadOptions{BytesPerSecond: 1000}); err != nil {
+		t.Errorf("Upload longer than the client timeout should not fail while data is sent: %v", err)
+	}
+	client.httpClient.Timeout = 20 * time.Millisecond
+
+	// A context replaces the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.UploadFileData(10, strings.NewReader("data"), 4, "a.txt", &UploadOptions{Context: ctx}); err != nil {
+		t.Errorf("Upload with a context should not use the client timeout: %v", err)
+	}
+	if client.httpClient.Timeout != 20*time.Millisecond {
+		t.Error("Client timeout should not change")
+	}
+}
+
+func TestUploadToMultipleChats(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	os.WriteFile(path, []byte("quarterly report"), 0o644)
+
+	results, err := client.UploadToMultipleChatsWithOptions(path, []int64{10, 0, 20}, &BroadcastOptions{Workers: 1})
+	if err == nil || !strings.Contains(err.Error(), "failed to upload file to 1 of 3 recipients") {
+		t.Fatalf("Expected partial failure, got %v", err)
+	}
+	if len(results) != 3 || results[1].Err == nil || results[0].Err != nil || results[2].Err != nil {
+		t.Fatalf("Unexpected results %+v", results)
+	}
+
+	if len(chat.uploads) != 2 || chat.uploads[0] != "10" || chat.uploads[1] != "20" {
+		t.Errorf("Expected an upload per chat, got %v", chat.uploads)
+	}
+	for _, result := range []ChatUploadResult{results[0], results[2]} {
+		if chat.files[result.GUID] != "quarterly report" {
+			t.Errorf("Chat %d got file %q", result.ChatID, chat.files[result.GUID])
+		}
+		if guids := chat.attachments[result.PostNo]; len(guids) != 1 || guids[0] != result.GUID {
+			t.Errorf("Post %d should have the file attached, got %v", result.PostNo, guids)
+		}
+	}
+
+	guid, err := client.UploadToMultipleChats(path, []int64{30, 40})
+	if err != nil || chat.files[guid] != "quarterly report" {
+		t.Errorf("Expected the GUID of the first upload, got %q and %v", guid, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = client.UploadToMultipleChatsWithOptions(path, []int64{50, 60}, &BroadcastOptions{Context: ctx})
+	if !errors.Is(err, context.Canceled) || results[0].Err != ErrBroadcastStopped || results[1].Err != ErrBroadcastStopped {
+		t.Errorf("Expected canceled uploads to be skipped, got %+v and %v", results, err)
+	}
+}
@@ -0,0 +1,145 @@
+package verbosity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileStore is a Store persisted to a single JSON file.
+//
+// Values must be valid JSON, which is true for all state stored by the
+// package. The file is rewritten atomically on every change, so FileStore
+// suits small amounts of state such as scheduled jobs.
+type FileStore struct {
+	path string
+
+	mu   sync.RWMutex
+	data map[string]json.RawMessage
+}
+
+// NewFileStore opens the store file, creating it on the first write.
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{
+		path: path,
+		data: make(map[string]json.RawMessage),
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store file: %w", err)
+	}
+	if len(strings.TrimSpace(string(content))) == 0 {
+		return store, nil
+	}
+	if err := json.Unmarshal(content, &store.data); err != nil {
+		return nil, fmt.Errorf("failed to decode store file: %w", err)
+	}
+
+	return store, nil
+}
+
+// Path returns the path of the store file.
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+// Get returns the value of the key or ErrNotFound.
+func (s *FileStore) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// Put stores the value under the key and saves the file.
+func (s *FileStore) Put(key string, value []byte) error {
+	if !json.Valid(value) {
+		return fmt.Errorf("value of %s is not valid JSON", key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.data[key]
+	s.data[key] = append(json.RawMessage(nil), value...)
+	if err := s.save(); err != nil {
+		if existed {
+			s.data[key] = previous
+		} else {
+			delete(s.data, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the key and saves the file.
+func (s *FileStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.data[key]
+	if !existed {
+		return nil
+	}
+	delete(s.data, key)
+	if err := s.save(); err != nil {
+		s.data[key] = previous
+		return err
+	}
+	return nil
+}
+
+// Keys returns all keys with the prefix in sorted order.
+func (s *FileStore) Keys(prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	for key := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// save writes the data to a temporary file and renames it over the store file.
+func (s *FileStore) save() error {
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create store file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace store file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package verbosity
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Live message defaults.
+const (
+	// DefaultLiveMessageInterval is the default minimum time between updates
+	// of a live message.
+	DefaultLiveMessageInterval = 3 * time.Second
+	// DefaultLiveMessageRefresh is the default time after which an unchanged
+	// live message is updated to show the elapsed time.
+	DefaultLiveMessageRefresh = 10 * time.Second
+)
+
+// LiveStepStatus is the status of a step of a live message.
+type LiveStepStatus string
+
+// Live message step statuses.
+const (
+	LiveStepPending LiveStepStatus = "pending"
+	LiveStepRunning LiveStepStatus = "running"
+	LiveStepDone    LiveStepStatus = "done"
+	LiveStepFailed  LiveStepStatus = "failed"
+)
+
+// liveStepMarks are the marks of the step statuses.
+var liveStepMarks = map[LiveStepStatus]string{
+	LiveStepPending: "▫️",
+	LiveStepRunning: "⏳",
+	LiveStepDone:    "✅",
+	LiveStepFailed:  "❌",
+}
+
+// LiveStep is a step of a live message.
+type LiveStep struct {
+	Title  string
+	Status LiveStepStatus
+}
+
+// LiveMessage is a chat post that shows the progress of a long job.
+//
+// Changes are coalesced: the post is updated at most once per Interval,
+// in the background. An unchanged post is updated every Refresh to show
+// the elapsed time. Finish or Fail writes the final state immediately; if
+// that write fails, Finish or Fail can be called again.
+// If the post was deleted, the next update sends a new post.
+//
+//	live, err := client.NewLiveMessage(chatID, "Deploy")
+//	build := live.AddStep("Build")
+//	live.SetStep(build, verbosity.LiveStepRunning)
+//	live.SetProgress(3, 10)
+//	live.Finish("Deployed")
+type LiveMessage struct {
+	// Interval is the minimum time between updates of the post,
+	// DefaultLiveMessageInterval if zero.
+	Interval time.Duration
+	// Refresh is the time after which an unchanged post is updated to show
+	// the elapsed time, DefaultLiveMessageRefresh if zero. A negative value
+	// disables the refresh.
+	Refresh time.Duration
+	// OnError is called when a background update fails. It may be nil.
+	OnError func(err error)
+
+	client *Client
+	chatID int64
+	now    func() time.Time
+
+	mu      sync.Mutex
+	postNo  int64
+	title   string
+	status  string
+	done    int
+	total   int
+	steps   []LiveStep
+	started time.Time
+	// ended is the end time shown by the final state, finished is set
+	// once the final state is written
+	ended    time.Time
+	finished bool
+	failed   bool
+	rendered string
+	updated  time.Time
+	timer    *time.Timer
+	// due is the time the timer fires, refreshing is set if the timer
+	// only refreshes the elapsed time
+	due        time.Time
+	refreshing bool
+	seq        int
+}
+
+// NewLiveMessage sends the initial post of a live message to the chat.
+func (c *Client) NewLiveMessage(chatID int64, title string) (*LiveMessage, error) {
+	l := &LiveMessage{
+		client: c,
+		chatID: chatID,
+		now:    time.Now,
+		title:  title,
+	}
+	l.started = l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.send(); err != nil {
+		return nil, err
+	}
+	l.scheduleRefresh()
+	return l, nil
+}
+
+// PostNo returns the number of the current post.
+func (l *LiveMessage) PostNo() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.postNo
+}
+
+// SetStatus sets the status line.
+func (l *LiveMessage) SetStatus(text string) {
+	l.change(func() { l.status = text })
+}
+
+// SetProgress sets the progress bar to done of total. A zero total hides it.
+func (l *LiveMessage) SetProgress(done, total int) {
+	l.change(func() { l.done, l.total = done, total })
+}
+
+// AddStep adds a pending step and returns its index.
+func (l *LiveMessage) AddStep(title string) int {
+	var index int
+	l.change(func() {
+		index = len(l.steps)
+		l.steps = append(l.steps, LiveStep{Title: title, Status: LiveStepPending})
+	})
+	return index
+}
+
+// SetStep sets the status of the step.
+func (l *LiveMessage) SetStep(index int, status LiveStepStatus) {
+	l.change(func() {
+		if index >= 0 && index < len(l.steps) {
+			l.steps[index].Status = status
+		}
+	})
+}
+
+// Finish marks the job as done and writes the final state.
+// A running step is marked done.
+func (l *LiveMessage) Finish(text string) error {
+	return l.finish(text, false)
+}
+
+// Fail marks the job as failed and writes the final state.
+// A running step is marked failed.
+func (l *LiveMessage) Fail(err error) error {
+	text := "Failed"
+	if err != nil {
+		text = "Failed: " + err.Error()
+	}
+	return l.finish(text, true)
+}
+
+func (l *LiveMessage) finish(text string, failed bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.finished {
+		return fmt.Errorf("live message is already finished")
+	}
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+
+	l.ended = l.now()
+	l.failed = failed
+	l.status = text
+	for i := range l.steps {
+		if l.steps[i].Status == LiveStepRunning {
+			l.steps[i].Status = LiveStepDone
+			if failed {
+				l.steps[i].Status = LiveStepFailed
+			}
+		}
+	}
+	if err := l.update(); err != nil {
+		return err
+	}
+	l.finished = true
+	return nil
+}
+
+// change applies the change and schedules an update of the post.
+func (l *LiveMessage) change(apply func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// After Finish or Fail only the final state is written
+	if !l.ended.IsZero() {
+		return
+	}
+	apply()
+
+	interval := l.Interval
+	if interval <= 0 {
+		interval = DefaultLiveMessageInterval
+	}
+	delay := interval - l.now().Sub(l.updated)
+	if delay < 0 {
+		delay = 0
+	}
+	l.schedule(delay, false)
+}
+
+// schedule fires the timer after the delay unless it fires earlier.
+// The caller holds l.mu.
+func (l *LiveMessage) schedule(delay time.Duration, refreshing bool) {
+	due := l.now().Add(delay)
+	if l.timer != nil {
+		if !l.due.After(due) {
+			l.refreshing = l.refreshing && refreshing
+			return
+		}
+		l.timer.Stop()
+	}
+
+	l.seq++
+	seq := l.seq
+	l.due = due
+	l.refreshing = refreshing
+	l.timer = time.AfterFunc(delay, func() { l.flush(seq) })
+}
+
+// scheduleRefresh schedules the update of the elapsed time.
+// The caller holds l.mu.
+func (l *LiveMessage) scheduleRefresh() {
+	refresh := l.Refresh
+	if refresh == 0 {
+		refresh = DefaultLiveMessageRefresh
+	}
+	if refresh > 0 && l.ended.IsZero() {
+		l.schedule(refresh, true)
+	}
+}
+
+// flush writes the coalesced changes.
+func (l *LiveMessage) flush(seq int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.timer == nil || seq != l.seq {
+		return
+	}
+	l.timer = nil
+	if l.refreshing && l.Refresh < 0 {
+		return
+	}
+	if err := l.update(); err != nil && l.OnError != nil {
+		l.OnError(err)
+	}
+	l.scheduleRefresh()
+}
+
+// update writes the current state to the post. The caller holds l.mu.
+func (l *LiveMessage) update() error {
+	text := l.render()
+	if text == l.rendered {
+		return nil
+	}
+
+	_, err := l.client.editMessage(l.chatID, l.postNo, text)
+	if IsNotFoundError(err) {
+		return l.send()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update live message: %w", err)
+	}
+	l.rendered = text
+	l.updated = l.now()
+	return nil
+}
+
+// send posts the current state as a new post. The caller holds l.mu.
+func (l *LiveMessage) send() error {
+	text := l.render()
+	response, err := l.client.SendMessage(l.chatID, text, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send live message: %w", err)
+	}
+	l.postNo = response.PostNo
+	l.rendered = text
+	l.updated = l.now()
+	return nil
+}
+
+// Render returns the text of the live message.
+func (l *LiveMessage) Render() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.render()
+}
+
+func (l *LiveMessage) render() string {
+	var b strings.Builder
+	b.WriteString("**" + l.title + "**")
+
+	if l.total > 0 {
+		done := l.done
+		if done > l.total {
+			done = l.total
+		}
+		filled := done * pollBarWidth / l.total
+		fmt.Fprintf(&b, "\n%s%s %d/%d (%d%%)", strings.Repeat("█", filled), strings.Repeat("░", pollBarWidth-filled),
+			done, l.total, done*100/l.total)
+	}
+
+	for _, step := range l.steps {
+		fmt.Fprintf(&b, "\n%s %s", liveStepMarks[step.Status], step.Title)
+	}
+
+	if l.status != "" {
+		b.WriteString("\n" + l.status)
+	}
+
+	end := l.ended
+	if end.IsZero() {
+		end = l.now()
+	}
+	fmt.Fprintf(&b, "\nElapsed: %s", end.Sub(l.started).Round(time.Second))
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package verbosity
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLiveMessage(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	live, err := client.NewLiveMessage(10, "Deploy")
+	if err != nil {
+		t.Fatalf("NewLiveMessage should not return error: %v", err)
+	}
+	var clock sync.Mutex
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	live.started, live.updated = now, now
+	live.now = func() time.Time { clock.Lock(); defer clock.Unlock(); return now }
+	live.Interval = 20 * time.Millisecond
+
+	build := live.AddStep("Build")
+	live.AddStep("Upload")
+	live.SetStep(build, LiveStepRunning)
+	live.SetProgress(3, 10)
+	clock.Lock()
+	now = now.Add(5 * time.Second)
+	clock.Unlock()
+
+	if len(chat.sent) != 1 || chat.post(1) != "**Deploy**\nElapsed: 0s" {
+		t.Fatalf("Expected a single initial post, got %q", chat.sent)
+	}
+
+	// The changes are written together after the interval
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && chat.post(1) == "**Deploy**\nElapsed: 0s" {
+		time.Sleep(5 * time.Millisecond)
+	}
+	expected := "**Deploy**\n███░░░░░░░ 3/10 (30%)\n⏳ Build\n▫️ Upload\nElapsed: 5s"
+	if post := chat.post(1); post != expected {
+		t.Fatalf("Unexpected live post %q, expected %q", post, expected)
+	}
+
+	// The post was deleted, the final state goes to a new post
+	chat.mu.Lock()
+	delete(chat.posts, 1)
+	chat.mu.Unlock()
+
+	if err := live.Fail(errors.New("upload timeout")); err != nil {
+		t.Fatalf("Fail should not return error: %v", err)
+	}
+	if live.PostNo() != 2 {
+		t.Fatalf("Expected a new post, got %d", live.PostNo())
+	}
+	expected = "**Deploy**\n███░░░░░░░ 3/10 (30%)\n❌ Build\n▫️ Upload\nFailed: upload timeout\nElapsed: 5s"
+	if post := chat.post(2); post != expected {
+		t.Errorf("Unexpected final post %q, expected %q", post, expected)
+	}
+
+	live.SetStatus("ignored")
+	if err := live.Finish("done"); err == nil {
+		t.Error("Finish of a finished live message should return error")
+	}
+}
+
+func TestLiveMessageRetriesFinishAndRefreshes(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	live, err := client.NewLiveMessage(10, "Backup")
+	if err != nil {
+		t.Fatalf("NewLiveMessage should not return error: %v", err)
+	}
+	var clock sync.Mutex
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	live.mu.Lock()
+	live.started, live.updated = now, now
+	live.now = func() time.Time { clock.Lock(); defer clock.Unlock(); return now }
+	live.Refresh = 20 * time.Millisecond
+	live.scheduleRefresh()
+	live.mu.Unlock()
+
+	// The elapsed time is refreshed without other changes
+	clock.Lock()
+	now = now.Add(7 * time.Second)
+	clock.Unlock()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && chat.post(1) != "**Backup**\nElapsed: 7s" {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if post := chat.post(1); post != "**Backup**\nElapsed: 7s" {
+		t.Fatalf("Elapsed time should be refreshed, got %q", post)
+	}
+
+	// A failed final write can be retried
+	chat.setFailing(true)
+	if err := live.Finish("Done"); err == nil {
+		t.Fatal("Finish should return the update error")
+	}
+	chat.setFailing(false)
+	if err := live.Finish("Done"); err != nil {
+		t.Fatalf("Finish should be retried: %v", err)
+	}
+	if post := chat.post(1); post != "**Backup**\nDone\nElapsed: 7s" {
+		t.Errorf("Unexpected final post %q", post)
+	}
+	if err := live.Finish("Done"); err == nil {
+		t.Error("Finish of a finished live message should return error")
+	}
+}
@@ -0,0 +1,328 @@
+package verbosity
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	headingPattern      = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	bulletPattern       = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	orderedPattern      = regexp.MustCompile(`^(\s*)(\d+)[.)]\s+(.*)$`)
+	blockquotePattern   = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	fencePattern        = regexp.MustCompile("^\\s{0,3}(`{3,}|~{3,})\\s*([\\w+#.-]*)\\s*$")
+	closingFencePattern = regexp.MustCompile("^\\s{0,3}(`{3,}|~{3,})\\s*$")
+	markdownEscapables  = "\\`*_[]()#>+-.!~@|"
+)
+
+// MarkdownToRich converts a CommonMark subset into a rich message.
+//
+// Supported syntax: headings, bold, italic, inline code, fenced code blocks,
+// links, bullet and ordered lists, blockquotes and @mentions. Headings are
+// rendered as bold lines, links with the bot:// scheme become action buttons.
+func MarkdownToRich(markdown string) *RichMessage {
+	msg := NewRichMessage()
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+
+	// needBreak is set when the previous line did not end with a line break
+	needBreak := false
+	lineBreak := func() {
+		if needBreak {
+			msg.Text("\n")
+		}
+		needBreak = false
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if match := fencePattern.FindStringSubmatch(line); match != nil {
+			var code []string
+			for i++; i < len(lines); i++ {
+				if closesFence(lines[i], match[1]) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			needBreak = false
+			msg.CodeBlock(match[2], strings.Join(code, "\n"))
+			continue
+		}
+
+		if blockquotePattern.MatchString(line) {
+			var quote []string
+			for ; i < len(lines); i++ {
+				match := blockquotePattern.FindStringSubmatch(lines[i])
+				if match == nil {
+					break
+				}
+				quote = append(quote, unescapeMarkdown(match[1]))
+			}
+			i--
+			needBreak = false
+			msg.Quote(strings.Join(quote, "\n"))
+			continue
+		}
+
+		lineBreak()
+
+		if match := headingPattern.FindStringSubmatch(line); match != nil {
+			msg.Bold(unescapeMarkdown(match[1]))
+		} else if match := bulletPattern.FindStringSubmatch(line); match != nil {
+			msg.Text(match[1] + "• ")
+			parseInline(msg, match[2])
+		} else if match := orderedPattern.FindStringSubmatch(line); match != nil {
+			msg.Text(match[1] + match[2] + ". ")
+			parseInline(msg, match[3])
+		} else {
+			parseInline(msg, line)
+		}
+		needBreak = i < len(lines)-1
+	}
+
+	return msg
+}
+
+// parseInline appends inline markdown of a single line to the message.
+func parseInline(msg *RichMessage, line string) {
+	runes := []rune(line)
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			msg.Text(text.String())
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '\\' && i+1 < len(runes) && strings.ContainsRune(markdownEscapables, runes[i+1]):
+			i++
+			text.WriteRune(runes[i])
+			continue
+
+		case r == '`':
+			// Backslashes are literal in code spans
+			if end := indexLiteral(runes, '`', i+1); end > i+1 {
+				flush()
+				msg.Code(string(runes[i+1 : end]))
+				i = end
+				continue
+			}
+
+		case (r == '*' || r == '_') && i+1 < len(runes) && runes[i+1] == r:
+			delim := string([]rune{r, r})
+			if end := indexString(runes, delim, i+2); end > i+2 {
+				flush()
+				msg.Bold(unescapeMarkdown(string(runes[i+2 : end])))
+				i = end + 1
+				continue
+			}
+
+		case (r == '*' || r == '_') && (r == '*' || i == 0 || !isWordRune(runes[i-1])):
+			if end := indexRune(runes, r, i+1); end > i+1 && !unicode.IsSpace(runes[i+1]) {
+				flush()
+				msg.Italic(unescapeMarkdown(string(runes[i+1 : end])))
+				i = end
+				continue
+			}
+
+		case r == '[':
+			if title, url, end, ok := parseLink(runes, i); ok {
+				flush()
+				if strings.HasPrefix(url, "bot://") {
+					msg.add(TextBlock{Type: BlockAction, Value: title, URL: url})
+				} else {
+					msg.Link(title, url)
+				}
+				i = end
+				continue
+			}
+
+		case r == '@' && (i == 0 || !isWordRune(runes[i-1])):
+			end := i + 1
+			for end < len(runes) && (isWordRune(runes[end]) || runes[end] == '.' || runes[end] == '-') {
+				end++
+			}
+			// Trailing punctuation is not part of the name
+			for end > i+1 && (runes[end-1] == '.' || runes[end-1] == '-') {
+				end--
+			}
+			if end > i+1 {
+				flush()
+				msg.MentionName(string(runes[i+1 : end]))
+				i = end - 1
+				continue
+			}
+		}
+
+		text.WriteRune(r)
+	}
+
+	flush()
+}
+
+// parseLink parses [title](url) starting at position start.
+func parseLink(runes []rune, start int) (string, string, int, bool) {
+	closeTitle := indexRune(runes, ']', start+1)
+	if closeTitle < 0 || closeTitle+1 >= len(runes) || runes[closeTitle+1] != '(' {
+		return "", "", 0, false
+	}
+	closeURL := indexRune(runes, ')', closeTitle+2)
+	if closeURL < 0 {
+		return "", "", 0, false
+	}
+	title := unescapeMarkdown(string(runes[start+1 : closeTitle]))
+	url := strings.TrimSpace(string(runes[closeTitle+2 : closeURL]))
+	return title, url, closeURL, url != ""
+}
+
+// BlocksToMarkdown renders parsed text blocks as Markdown.
+func BlocksToMarkdown(blocks []TextBlock) string {
+	var result strings.Builder
+	for _, block := range blocks {
+		switch block.Type {
+		case BlockText:
+			lineStart := result.Len() == 0 || strings.HasSuffix(result.String(), "\n")
+			result.WriteString(escapeMarkdown(block.Value, lineStart))
+		case BlockBold, BlockItalic:
+			renderBlock(&result, TextBlock{Type: block.Type, Value: escapeMarkdown(block.Value, false)})
+		default:
+			renderBlock(&result, block)
+		}
+	}
+	return result.String()
+}
+
+// Markdown renders the incoming message as Markdown.
+// The plain text is returned if the message has no parsed blocks.
+func (r *BotRequest) Markdown() string {
+	if len(r.TextParsed) == 0 {
+		return r.Text
+	}
+	return BlocksToMarkdown(r.TextParsed)
+}
+
+// SendMarkdown converts Markdown and sends it to a non-private chat.
+//
+// API: POST /bot/message
+func (c *Client) SendMarkdown(chatID int64, markdown string) (*MessageResponse, error) {
+	if strings.TrimSpace(markdown) == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+	return c.SendRich(chatID, MarkdownToRich(markdown))
+}
+
+// SendPrivateMarkdownByID converts Markdown and sends it as a private message.
+//
+// API: POST /msg/post/private
+func (c *Client) SendPrivateMarkdownByID(userID int64, markdown string) (*PrivateMessageResponse, error) {
+	if strings.TrimSpace(markdown) == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+	return c.SendPrivateRichByID(userID, MarkdownToRich(markdown))
+}
+
+// closesFence reports whether the line closes the code block opened with
+// the fence: only fence characters of the same kind, at least as many as
+// the opener, and optional whitespace.
+func closesFence(line, opener string) bool {
+	match := closingFencePattern.FindStringSubmatch(line)
+	return match != nil && match[1][0] == opener[0] && len(match[1]) >= len(opener)
+}
+
+// escapeMarkdown escapes the markup in the text. If lineStart is true, the
+// text starts at the beginning of a line.
+func escapeMarkdown(text string, lineStart bool) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		var escaped strings.Builder
+		for _, r := range line {
+			if strings.ContainsRune("\\`*_[]@", r) {
+				escaped.WriteRune('\\')
+			}
+			escaped.WriteRune(r)
+		}
+		lines[i] = escaped.String()
+		if i > 0 || lineStart {
+			lines[i] = escapeLineStart(lines[i])
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeLineStart escapes a heading, blockquote, list or fence marker at the
+// start of the line.
+func escapeLineStart(line string) string {
+	body := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(body)]
+
+	switch {
+	case strings.HasPrefix(body, "#"), strings.HasPrefix(body, ">"), strings.HasPrefix(body, "~~~"),
+		bulletPattern.MatchString(body):
+		return indent + "\\" + body
+	}
+	if match := orderedPattern.FindStringSubmatchIndex(body); match != nil {
+		marker := match[5]
+		return indent + body[:marker] + "\\" + body[marker:]
+	}
+	return line
+}
+
+func unescapeMarkdown(text string) string {
+	var result strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune(markdownEscapables, runes[i+1]) {
+			i++
+		}
+		result.WriteRune(runes[i])
+	}
+	return result.String()
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func indexRune(runes []rune, r rune, from int) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == '\\' {
+			i++
+			continue
+		}
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexLiteral is indexRune without backslash escapes.
+func indexLiteral(runes []rune, r rune, from int) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexString(runes []rune, s string, from int) int {
+	target := []rune(s)
+	for i := from; i+len(target) <= len(runes); i++ {
+		if runes[i] == '\\' {
+			i++
+			continue
+		}
+		if string(runes[i:i+len(target)]) == s {
+			return i
+		}
+	}
+	return -1
+}
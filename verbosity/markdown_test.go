@@ -0,0 +1,145 @@
+package verbosity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownToRich(t *testing.T) {
+	markdown := "# Build report\n" +
+		"Status: **passed** in *2m*, see [logs](https://ci.example.com/1)\n" +
+		"\n" +
+		"- step `lint`\n" +
+		"2. ping @john\n" +
+		"> quoted\n" +
+		"> text\n" +
+		"```go\n" +
+		"fmt.Println(\"*\")\n" +
+		"```\n" +
+		"[Retry](bot://retry?title=Retry)"
+
+	msg := MarkdownToRich(markdown)
+
+	var types []string
+	for _, block := range msg.Blocks() {
+		if block.Type != BlockText {
+			types = append(types, block.Type)
+		}
+	}
+	expected := []string{
+		BlockBold, BlockBold, BlockItalic, BlockLink, BlockCode, BlockMention,
+		BlockQuote, BlockCodeBlock, BlockAction,
+	}
+	if len(types) != len(expected) {
+		t.Fatalf("Expected blocks %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("Expected block %d to be '%s', got '%s'", i, expected[i], types[i])
+		}
+	}
+
+	text := msg.String()
+	expectedText := "**Build report**\n" +
+		"Status: **passed** in *2m*, see [logs](https://ci.example.com/1)\n" +
+		"\n" +
+		"• step `lint`\n" +
+		"2. ping @john\n" +
+		"> quoted\n" +
+		"> text\n" +
+		"```go\n" +
+		"fmt.Println(\"*\")\n" +
+		"```\n" +
+		"[Retry](bot://retry?title=Retry)"
+	if text != expectedText {
+		t.Errorf("Expected text:\n%s\ngot:\n%s", expectedText, text)
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	inputs := []string{
+		"plain text",
+		"**bold** and *italic* with `code`",
+		"a [link](https://example.com) and @user",
+		"escaped \\*star\\* and snake_case_name",
+		"> quote\nafter",
+	}
+
+	for _, input := range inputs {
+		blocks := MarkdownToRich(input).Blocks()
+		markdown := BlocksToMarkdown(blocks)
+		again := MarkdownToRich(markdown).Blocks()
+
+		if len(again) != len(blocks) {
+			t.Errorf("Round trip of %q changed blocks: %+v vs %+v", input, blocks, again)
+			continue
+		}
+		for i := range blocks {
+			if blocks[i] != again[i] {
+				t.Errorf("Round trip of %q changed block %d: %+v vs %+v", input, i, blocks[i], again[i])
+			}
+		}
+	}
+}
+
+func TestBlocksToMarkdownEscapesLineStarts(t *testing.T) {
+	text := " #1\n# not a heading\n> not a quote\n- not a list\n  + nor this\n12. not a list\n~~~"
+	blocks := []TextBlock{
+		{Type: BlockBold, Value: "note"},
+		{Type: BlockText, Value: text},
+	}
+
+	markdown := BlocksToMarkdown(blocks)
+	again := MarkdownToRich(markdown).Blocks()
+	if len(again) == 0 || again[0] != blocks[0] {
+		t.Fatalf("Expected the bold block first, got %+v", again)
+	}
+	var parsed strings.Builder
+	for _, block := range again[1:] {
+		if block.Type != BlockText {
+			t.Fatalf("Expected only text blocks, got %+v in %q", block, markdown)
+		}
+		parsed.WriteString(block.Value)
+	}
+	if parsed.String() != text {
+		t.Errorf("Round trip of %q changed the text to %q", markdown, parsed.String())
+	}
+}
+
+func TestMarkdownCodeSpanBackslashes(t *testing.T) {
+	blocks := MarkdownToRich("path `C:\\dir\\` here").Blocks()
+	if len(blocks) != 3 || blocks[1].Type != BlockCode || blocks[1].Value != "C:\\dir\\" {
+		t.Errorf("Expected backslashes kept in the code span, got %+v", blocks)
+	}
+}
+
+func TestMarkdownFenceClosing(t *testing.T) {
+	markdown := "````md\n```go\nfmt.Println()\n```\n```` \nafter"
+	blocks := MarkdownToRich(markdown).Blocks()
+	if len(blocks) == 0 || blocks[0].Type != BlockCodeBlock || blocks[0].Value != "```go\nfmt.Println()\n```" {
+		t.Fatalf("Expected the inner fences kept in the code block, got %+v", blocks)
+	}
+	if last := blocks[len(blocks)-1]; last.Value != "after" {
+		t.Errorf("Expected text after the block, got %+v", blocks)
+	}
+}
+
+func TestBotRequestMarkdown(t *testing.T) {
+	request := &BotRequest{
+		Text: "deploy *now*",
+		TextParsed: []TextBlock{
+			{Type: BlockText, Value: "deploy "},
+			{Type: BlockBold, Value: "now"},
+			{Type: BlockText, Value: " 2*2"},
+		},
+	}
+
+	if md := request.Markdown(); md != "deploy **now** 2\\*2" {
+		t.Errorf("Unexpected markdown '%s'", md)
+	}
+
+	request.TextParsed = nil
+	if md := request.Markdown(); md != "deploy *now*" {
+		t.Errorf("Expected plain text fallback, got '%s'", md)
+	}
+}
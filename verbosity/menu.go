@@ -0,0 +1,263 @@
+package verbosity
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Actions used by menu buttons.
+const (
+	MenuPageAction   = "menu.page"
+	MenuSelectAction = "menu.select"
+)
+
+// DefaultMenuPageSize is the number of items on a menu page.
+const DefaultMenuPageSize = 10
+
+const menuKeyPrefix = "menu:"
+
+// MenuItem is a selectable menu entry.
+type MenuItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Menu is the stored state of a shown menu.
+type Menu struct {
+	ID       string     `json:"id"`
+	Kind     string     `json:"kind"`
+	Title    string     `json:"title"`
+	ChatID   int64      `json:"chat_id"`
+	PostNo   int64      `json:"post_no"`
+	Items    []MenuItem `json:"items"`
+	Page     int        `json:"page"`
+	PageSize int        `json:"page_size"`
+}
+
+// Pages returns the number of menu pages.
+func (m *Menu) Pages() int {
+	if len(m.Items) == 0 || m.PageSize <= 0 {
+		return 1
+	}
+	return (len(m.Items) + m.PageSize - 1) / m.PageSize
+}
+
+// PageItems returns the items of the current page.
+func (m *Menu) PageItems() []MenuItem {
+	if m.PageSize <= 0 {
+		return m.Items
+	}
+	start := m.Page * m.PageSize
+	if start >= len(m.Items) {
+		return nil
+	}
+	end := start + m.PageSize
+	if end > len(m.Items) {
+		end = len(m.Items)
+	}
+	return m.Items[start:end]
+}
+
+// MenuSelectHandler is called when the user picks a menu item.
+type MenuSelectHandler func(req *ActionRequest, menu *Menu, item MenuItem) error
+
+// Menus shows paginated menus built from action buttons.
+//
+// Paging edits the menu post in place. The menu state is kept in the
+// store, so buttons keep working after a restart with a persistent store.
+//
+// Register the button handlers with Attach:
+//
+//	menus := verbosity.NewMenus(client, verbosity.NewMemoryStore())
+//	menus.OnSelect("chat", func(req *verbosity.ActionRequest, menu *verbosity.Menu, item verbosity.MenuItem) error {
+//		...
+//	})
+//	menus.Attach(router)
+type Menus struct {
+	// PageSize is the number of items on a page. Zero means DefaultMenuPageSize.
+	PageSize int
+	// PrevLabel and NextLabel are the titles of the paging buttons.
+	PrevLabel string
+	NextLabel string
+	// PageFormat formats the page counter from the page number and the page count.
+	PageFormat string
+
+	client *Client
+	store  Store
+
+	mu       sync.RWMutex
+	handlers map[string]MenuSelectHandler
+	// locks serializes the paging of each menu
+	locks keyLocks
+}
+
+// NewMenus creates a menu manager that keeps state in the store.
+func NewMenus(client *Client, store Store) *Menus {
+	return &Menus{
+		PrevLabel:  "« Prev",
+		NextLabel:  "Next »",
+		PageFormat: "Page %d of %d",
+		client:     client,
+		store:      store,
+		handlers:   make(map[string]MenuSelectHandler),
+	}
+}
+
+// OnSelect registers the handler for items picked in menus of the kind.
+func (m *Menus) OnSelect(kind string, handler MenuSelectHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers[kind] = handler
+}
+
+// Attach registers the menu button handlers in the router.
+func (m *Menus) Attach(router *Router) {
+	router.HandleAction(MenuPageAction, m.HandlePage)
+	router.HandleAction(MenuSelectAction, m.HandleSelect)
+}
+
+// Show sends the first page of a menu to the chat.
+func (m *Menus) Show(chatID int64, kind, title string, items []MenuItem) (*Menu, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("menu items cannot be empty")
+	}
+
+	menu := &Menu{
+		ID:       newID(),
+		Kind:     kind,
+		Title:    title,
+		ChatID:   chatID,
+		Items:    items,
+		PageSize: m.PageSize,
+	}
+	if menu.PageSize <= 0 {
+		menu.PageSize = DefaultMenuPageSize
+	}
+
+	response, err := m.client.SendRich(chatID, m.Render(menu))
+	if err != nil {
+		return nil, err
+	}
+	menu.PostNo = response.PostNo
+
+	if err := putJSON(m.store, menuKeyPrefix+menu.ID, menu); err != nil {
+		return nil, err
+	}
+	return menu, nil
+}
+
+// Get returns the stored menu.
+func (m *Menus) Get(id string) (*Menu, error) {
+	var menu Menu
+	if err := getJSON(m.store, menuKeyPrefix+id, &menu); err != nil {
+		return nil, err
+	}
+	return &menu, nil
+}
+
+// Close replaces the menu post with the text and forgets the menu.
+func (m *Menus) Close(id, text string) error {
+	menu, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	if _, err := m.client.editMessage(menu.ChatID, menu.PostNo, text); err != nil {
+		return err
+	}
+	return m.store.Delete(menuKeyPrefix + id)
+}
+
+// Render renders the current page of the menu.
+func (m *Menus) Render(menu *Menu) *RichMessage {
+	msg := NewRichMessage()
+	if menu.Title != "" {
+		msg.Bold(menu.Title).Text("\n")
+	}
+
+	offset := menu.Page * menu.PageSize
+	for i, item := range menu.PageItems() {
+		msg.Text(strconv.Itoa(offset+i+1) + ". ")
+		msg.Action(item.Title, MenuSelectAction, map[string]string{"menu": menu.ID, "item": item.ID})
+		msg.Text("\n")
+	}
+
+	if pages := menu.Pages(); pages > 1 {
+		if menu.Page > 0 {
+			msg.Action(m.PrevLabel, MenuPageAction, map[string]string{"menu": menu.ID, "page": strconv.Itoa(menu.Page - 1)})
+			msg.Text(" ")
+		}
+		msg.Text(fmt.Sprintf(m.PageFormat, menu.Page+1, pages))
+		if menu.Page < pages-1 {
+			msg.Text(" ")
+			msg.Action(m.NextLabel, MenuPageAction, map[string]string{"menu": menu.ID, "page": strconv.Itoa(menu.Page + 1)})
+		}
+	}
+
+	return msg
+}
+
+// HandlePage switches the menu page and edits the post in place.
+// Presses on the same menu are handled one at a time, so none is lost.
+func (m *Menus) HandlePage(req *ActionRequest) error {
+	unlock := m.locks.lock(req.Params["menu"])
+	defer unlock()
+
+	menu, err := m.load(req)
+	if err != nil || menu == nil {
+		return err
+	}
+
+	page, err := strconv.Atoi(req.Params["page"])
+	if err != nil || page < 0 || page >= menu.Pages() {
+		return nil
+	}
+	if page == menu.Page {
+		return nil
+	}
+	menu.Page = page
+
+	if _, err := m.client.UpdateRich(menu.ChatID, menu.PostNo, m.Render(menu)); err != nil {
+		return err
+	}
+	return putJSON(m.store, menuKeyPrefix+menu.ID, menu)
+}
+
+// HandleSelect calls the handler registered for the menu kind.
+func (m *Menus) HandleSelect(req *ActionRequest) error {
+	menu, err := m.load(req)
+	if err != nil || menu == nil {
+		return err
+	}
+
+	m.mu.RLock()
+	handler := m.handlers[menu.Kind]
+	m.mu.RUnlock()
+	if handler == nil {
+		return fmt.Errorf("no handler for menu kind '%s'", menu.Kind)
+	}
+
+	for _, item := range menu.Items {
+		if item.ID == req.Params["item"] {
+			return handler(req, menu, item)
+		}
+	}
+	return nil
+}
+
+// load returns the menu of the request, or nil for stale and foreign buttons.
+func (m *Menus) load(req *ActionRequest) (*Menu, error) {
+	menu, err := m.Get(req.Params["menu"])
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if menu.ChatID != req.ChatID || (req.PostNo != 0 && menu.PostNo != req.PostNo) {
+		return nil, nil
+	}
+	return menu, nil
+}
@@ -0,0 +1,140 @@
+package verbosity
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMenus(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	menus := NewMenus(client, NewMemoryStore())
+	menus.PageSize = 2
+
+	var picked []string
+	menus.OnSelect("chat", func(req *ActionRequest, menu *Menu, item MenuItem) error {
+		picked = append(picked, item.ID)
+		return nil
+	})
+
+	router := NewRouter("mybot")
+	menus.Attach(router)
+
+	items := []MenuItem{{ID: "1", Title: "General"}, {ID: "2", Title: "Dev"}, {ID: "3", Title: "Ops"}}
+	menu, err := menus.Show(10, "chat", "Pick a chat", items)
+	if err != nil {
+		t.Fatalf("Show should not return error: %v", err)
+	}
+
+	first := chat.post(menu.PostNo)
+	if !contains(first, "[General](bot://menu.select?") || contains(first, "Ops") {
+		t.Errorf("Unexpected first page:\n%s", first)
+	}
+	if !contains(first, "Page 1 of 2") || contains(first, "Prev") {
+		t.Errorf("Expected first page counter without prev button:\n%s", first)
+	}
+
+	page := &ActionRequest{ChatID: 10, PostNo: menu.PostNo, Action: MenuPageAction,
+		Params: map[string]string{"menu": menu.ID, "page": "1"}}
+	if err := router.HandleActionRequest(page); err != nil {
+		t.Fatalf("Paging should not return error: %v", err)
+	}
+
+	second := chat.post(menu.PostNo)
+	if !contains(second, "3. [Ops]") || !contains(second, "Prev") || contains(second, "Next") {
+		t.Errorf("Unexpected second page:\n%s", second)
+	}
+	if len(chat.sent) != 1 {
+		t.Errorf("Paging should edit the post in place, got %d sent posts", len(chat.sent))
+	}
+	if len(chat.parsed[menu.PostNo]) == 0 {
+		t.Error("Paging should keep the structured text")
+	}
+
+	stored, err := menus.Get(menu.ID)
+	if err != nil || stored.Page != 1 {
+		t.Errorf("Expected stored page 1, got %+v (%v)", stored, err)
+	}
+
+	selectReq := &ActionRequest{ChatID: 10, PostNo: menu.PostNo, Action: MenuSelectAction,
+		Params: map[string]string{"menu": menu.ID, "item": "3"}}
+	if err := router.HandleActionRequest(selectReq); err != nil {
+		t.Fatalf("Select should not return error: %v", err)
+	}
+	if len(picked) != 1 || picked[0] != "3" {
+		t.Errorf("Expected item 3 to be picked, got %v", picked)
+	}
+
+	// Buttons from another chat are ignored
+	selectReq.ChatID = 11
+	router.HandleActionRequest(selectReq)
+	if len(picked) != 1 {
+		t.Errorf("Foreign button should be ignored, got %v", picked)
+	}
+
+	if err := menus.Close(menu.ID, "Picked Ops"); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+	if chat.post(menu.PostNo) != "Picked Ops" {
+		t.Errorf("Expected closed menu text, got '%s'", chat.post(menu.PostNo))
+	}
+	if _, err := menus.Get(menu.ID); err != ErrNotFound {
+		t.Errorf("Expected closed menu to be forgotten, got %v", err)
+	}
+}
+
+func TestMenusConcurrentPaging(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	menus := NewMenus(client, NewMemoryStore())
+	menus.PageSize = 1
+	items := []MenuItem{{ID: "1", Title: "General"}, {ID: "2", Title: "Dev"}, {ID: "3", Title: "Ops"}}
+	menu, err := menus.Show(10, "chat", "Pick a chat", items)
+	if err != nil {
+		t.Fatalf("Show should not return error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(page int) {
+			defer wg.Done()
+			menus.HandlePage(&ActionRequest{ChatID: 10, PostNo: menu.PostNo, Action: MenuPageAction,
+				Params: map[string]string{"menu": menu.ID, "page": strconv.Itoa(page)}})
+		}(i % 3)
+	}
+	wg.Wait()
+
+	stored, err := menus.Get(menu.ID)
+	if err != nil {
+		t.Fatalf("Get should not return error: %v", err)
+	}
+	if counter := fmt.Sprintf("Page %d of 3", stored.Page+1); !contains(chat.post(menu.PostNo), counter) {
+		t.Errorf("Stored page %d does not match the post:\n%s", stored.Page, chat.post(menu.PostNo))
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.Put("menu:b", []byte("2"))
+	store.Put("menu:a", []byte("1"))
+	store.Put("poll:a", []byte("3"))
+
+	value, err := store.Get("menu:a")
+	if err != nil || string(value) != "1" {
+		t.Errorf("Expected value '1', got '%s' (%v)", value, err)
+	}
+
+	keys, _ := store.Keys("menu:")
+	if len(keys) != 2 || keys[0] != "menu:a" || keys[1] != "menu:b" {
+		t.Errorf("Expected sorted menu keys, got %v", keys)
+	}
+
+	store.Delete("menu:a")
+	if _, err := store.Get("menu:a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
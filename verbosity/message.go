@@ -17,6 +17,7 @@ type SendMessageRequest struct {
 }
 
 // SendMessage sends a message to a non-private chat.
+// Long text is split into several posts, see Config.MaxMessageLength.
 //
 // API: POST /bot/message
 func (c *Client) SendMessage(chatID int64, text string, replyNo *int64) (*MessageResponse, error) {
@@ -34,6 +35,47 @@ func (c *Client) SendMessage(chatID int64, text string, replyNo *int64) (*Messag
 		ReplyNo: replyNo,
 	}
 
+	return c.sendMessage(reqBody)
+}
+
+// sendMessage is a helper function to send messages to non-private chats.
+// Text longer than the maximum message length is sent as several posts,
+// the following parts are replies to the first one. Rich text is split
+// between blocks, see SplitRichMessage.
+func (c *Client) sendMessage(reqBody SendMessageRequest) (*MessageResponse, error) {
+	parts := SplitMessage(reqBody.Text, c.maxMessageLength())
+	var parsed [][]interface{}
+	if reqBody.TextParsed != nil {
+		parts, parsed = splitParsed(reqBody.Text, reqBody.TextParsed, c.maxMessageLength())
+		reqBody.TextParsed = parsed[0]
+	}
+
+	reqBody.Text = parts[0]
+	response, err := c.postMessage(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	response.PostNos = []int64{response.PostNo}
+
+	for i, part := range parts[1:] {
+		reqBody.Text = part
+		if parsed != nil {
+			reqBody.TextParsed = parsed[i+1]
+		}
+		reqBody.ReplyNo = &response.PostNo
+
+		partResponse, err := c.postMessage(reqBody)
+		if err != nil {
+			return response, fmt.Errorf("failed to send part %d of %d: %w", i+2, len(parts), err)
+		}
+		response.PostNos = append(response.PostNos, partResponse.PostNo)
+	}
+
+	return response, nil
+}
+
+// postMessage sends a single message request.
+func (c *Client) postMessage(reqBody SendMessageRequest) (*MessageResponse, error) {
 	body, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
@@ -60,14 +102,16 @@ func (c *Client) SendReply(chatID, postNo int64, text string) (*MessageResponse,
 
 // PrivateMessageRequest represents a request to send a private message.
 type PrivateMessageRequest struct {
-	Text           string `json:"text"`
-	UserID         *int64 `json:"user_id,omitempty"`
-	UserEmail      string `json:"user_email,omitempty"`
-	UserUniqueName string `json:"user_unique_name,omitempty"`
-	ReplyNo        *int64 `json:"reply_no,omitempty"`
+	Text           string        `json:"text"`
+	TextParsed     []interface{} `json:"text_parsed,omitempty"`
+	UserID         *int64        `json:"user_id,omitempty"`
+	UserEmail      string        `json:"user_email,omitempty"`
+	UserUniqueName string        `json:"user_unique_name,omitempty"`
+	ReplyNo        *int64        `json:"reply_no,omitempty"`
 }
 
 // SendPrivateMessageByID sends a private message to a user by their ID.
+// Long text is split into several posts, see Config.MaxMessageLength.
 //
 // API: POST /msg/post/private
 func (c *Client) SendPrivateMessageByID(userID int64, text string, replyNo *int64) (*PrivateMessageResponse, error) {
@@ -128,7 +172,43 @@ func (c *Client) SendPrivateMessageByUniqueName(uniqueName, text string, replyNo
 }
 
 // sendPrivateMessage is a helper function to send private messages.
+// Text longer than the maximum message length is sent as several posts,
+// the following parts are replies to the first one. Rich text is split
+// between blocks, see SplitRichMessage.
 func (c *Client) sendPrivateMessage(reqBody PrivateMessageRequest) (*PrivateMessageResponse, error) {
+	parts := SplitMessage(reqBody.Text, c.maxMessageLength())
+	var parsed [][]interface{}
+	if reqBody.TextParsed != nil {
+		parts, parsed = splitParsed(reqBody.Text, reqBody.TextParsed, c.maxMessageLength())
+		reqBody.TextParsed = parsed[0]
+	}
+
+	reqBody.Text = parts[0]
+	response, err := c.postPrivateMessage(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	response.PostNos = []int64{response.PostNo}
+
+	for i, part := range parts[1:] {
+		reqBody.Text = part
+		if parsed != nil {
+			reqBody.TextParsed = parsed[i+1]
+		}
+		reqBody.ReplyNo = &response.PostNo
+
+		partResponse, err := c.postPrivateMessage(reqBody)
+		if err != nil {
+			return response, fmt.Errorf("failed to send part %d of %d: %w", i+2, len(parts), err)
+		}
+		response.PostNos = append(response.PostNos, partResponse.PostNo)
+	}
+
+	return response, nil
+}
+
+// postPrivateMessage sends a single private message request.
+func (c *Client) postPrivateMessage(reqBody PrivateMessageRequest) (*PrivateMessageResponse, error) {
 	body, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
@@ -153,46 +233,16 @@ func (c *Client) SendPrivateReply(userID, replyPostNo int64, text string) (*Priv
 	return c.SendPrivateMessageByID(userID, text, &replyPostNo)
 }
 
-// BroadcastMessage sends a message to multiple chats.
-func (c *Client) BroadcastMessage(chatIDs []int64, text string) ([]MessageResponse, error) {
-	if len(chatIDs) == 0 {
-		return nil, fmt.Errorf("chat_ids slice cannot be empty")
-	}
-
-	var responses []MessageResponse
-	for _, chatID := range chatIDs {
-		response, err := c.SendMessage(chatID, text, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to send message to chat %d: %w", chatID, err)
-		}
-		responses = append(responses, *response)
-	}
-
-	return responses, nil
-}
-
 // SendMentionMessage sends a message with a mention to all members in a chat.
 func (c *Client) SendMentionMessage(chatID int64, text string) (*MessageResponse, error) {
 	return c.SendMessage(chatID, "@all "+text, nil)
 }
 
-// SendMessageToAllMyChats sends a message to all chats where the bot is a member.
-func (c *Client) SendMessageToAllMyChats(text string) ([]MessageResponse, error) {
-	chats, err := c.GetMyChats()
-	if err != nil {
-		return nil, err
-	}
-
-	chatIDs := make([]int64, len(chats.Chats))
-	for i, chat := range chats.Chats {
-		chatIDs[i] = chat.ID
-	}
-
-	return c.BroadcastMessage(chatIDs, text)
-}
-
 // UpdateMessage updates an existing message in a chat.
 //
+// If the text is longer than the maximum message length, the post is updated
+// with the first part and the rest is sent as replies to it.
+//
 // API: PUT /msg/post/{chat_id}/{post_no}
 func (c *Client) UpdateMessage(chatID, postNo int64, updateReq *UpdateMessageRequest) (*UpdateMessageResponse, error) {
 	if chatID == 0 {
@@ -208,6 +258,20 @@ func (c *Client) UpdateMessage(chatID, postNo int64, updateReq *UpdateMessageReq
 		return nil, fmt.Errorf("text cannot be empty")
 	}
 
+	parts := SplitMessage(updateReq.Text, c.maxMessageLength())
+	var parsed [][]interface{}
+	if updateReq.TextParsed != nil {
+		parts, parsed = splitParsed(updateReq.Text, updateReq.TextParsed, c.maxMessageLength())
+	}
+	if len(parts) > 1 {
+		firstPart := *updateReq
+		firstPart.Text = parts[0]
+		if parsed != nil {
+			firstPart.TextParsed = parsed[0]
+		}
+		updateReq = &firstPart
+	}
+
 	body, err := json.Marshal(updateReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
@@ -224,10 +288,36 @@ func (c *Client) UpdateMessage(chatID, postNo int64, updateReq *UpdateMessageReq
 	if err := c.do(req, &response); err != nil {
 		return nil, err
 	}
+	response.PostNos = []int64{postNo}
+
+	for i, part := range parts[1:] {
+		reply := SendMessageRequest{
+			Key:     c.BotToken(),
+			ChatID:  chatID,
+			Text:    part,
+			ReplyNo: &postNo,
+		}
+		if parsed != nil {
+			reply.TextParsed = parsed[i+1]
+		}
+		partResponse, err := c.postMessage(reply)
+		if err != nil {
+			return &response, fmt.Errorf("failed to send part %d of %d: %w", i+2, len(parts), err)
+		}
+		response.PostNos = append(response.PostNos, partResponse.PostNo)
+	}
 
 	return &response, nil
 }
 
+// editMessage updates a post that is edited repeatedly, such as a poll,
+// menu or live message. Text longer than the maximum message length is
+// truncated with an ellipsis instead of being split, so the edits do not
+// add replies to the chat.
+func (c *Client) editMessage(chatID, postNo int64, text string) (*UpdateMessageResponse, error) {
+	return c.UpdateMessage(chatID, postNo, &UpdateMessageRequest{Text: truncateMessage(text, c.maxMessageLength())})
+}
+
 // UpdateMessageWithAttachments updates a message with new attachments.
 func (c *Client) UpdateMessageWithAttachments(chatID, postNo int64, text string, attachments []string) (*UpdateMessageResponse, error) {
 	updateReq := &UpdateMessageRequest{
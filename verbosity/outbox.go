@@ -0,0 +1,742 @@
+package verbosity
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox file names.
+const (
+	OutboxLogFile  = "outbox.log"
+	OutboxDeadFile = "dead.log"
+)
+
+// Outbox defaults.
+const (
+	DefaultOutboxMaxAttempts   = 5
+	DefaultOutboxRetryDelay    = 5 * time.Second
+	DefaultOutboxMaxRetryDelay = 5 * time.Minute
+	DefaultOutboxCompactSize   = 1 << 20
+	// outboxIdleWait bounds the wait for new entries in Run.
+	outboxIdleWait = time.Minute
+)
+
+// OutboxKind is the kind of an outbox entry.
+type OutboxKind string
+
+// Outbox entry kinds.
+const (
+	OutboxMessage        OutboxKind = "message"
+	OutboxPrivateMessage OutboxKind = "private_message"
+)
+
+// OutboxStatus is the delivery status of an outbox entry.
+type OutboxStatus string
+
+// Outbox entry statuses.
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxSent    OutboxStatus = "sent"
+	OutboxDead    OutboxStatus = "dead"
+)
+
+// OutboxEntry is a message waiting for delivery.
+type OutboxEntry struct {
+	ID      string     `json:"id"`
+	Kind    OutboxKind `json:"kind"`
+	ChatID  int64      `json:"chat_id,omitempty"`
+	UserID  int64      `json:"user_id,omitempty"`
+	Text    string     `json:"text"`
+	ReplyNo *int64     `json:"reply_no,omitempty"`
+
+	Status      OutboxStatus `json:"status"`
+	Attempts    int          `json:"attempts,omitempty"`
+	NextAttempt time.Time    `json:"next_attempt,omitempty"`
+	LastError   string       `json:"last_error,omitempty"`
+	// APIError is the last error response of the API, if any.
+	APIError *APIError `json:"api_error,omitempty"`
+	// PostNos are the posts created by the entry. A long message is sent
+	// in parts; for a pending entry they are the parts already sent, and
+	// the next attempt resumes after them.
+	PostNos []int64   `json:"post_nos,omitempty"`
+	Created time.Time `json:"created"`
+	Sent    time.Time `json:"sent,omitempty"`
+}
+
+// target identifies the chat or user of the entry.
+func (e *OutboxEntry) target() string {
+	if e.Kind == OutboxPrivateMessage {
+		return fmt.Sprintf("user:%d", e.UserID)
+	}
+	return fmt.Sprintf("chat:%d", e.ChatID)
+}
+
+// Outbox guarantees delivery of messages across crashes and API outages.
+//
+// Enqueued messages are appended to a log file in the outbox directory
+// before they are sent. Run delivers them in order with retries and rate
+// limiting. Entries that fail permanently, or too many times, are moved
+// to the dead-letter file and can be replayed.
+//
+// New entries and their delivery status are synced to disk. Delivery is
+// still at least once: a message sent right before a crash, whose status
+// was not written yet, is sent again when the outbox is reopened.
+//
+//	outbox, err := verbosity.OpenOutbox(client, "/var/lib/bot/outbox")
+//	defer outbox.Close()
+//	go outbox.Run(ctx)
+//	outbox.Enqueue(chatID, "Build passed", nil)
+type Outbox struct {
+	// MaxAttempts is the number of attempts before an entry is dead.
+	// Zero means DefaultOutboxMaxAttempts.
+	MaxAttempts int
+	// RetryDelay is the delay after the first failure. It doubles with
+	// every attempt up to MaxRetryDelay. Zero means the defaults.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// CompactSize is the log size in bytes above which Run compacts the
+	// log, DefaultOutboxCompactSize if zero. A negative value disables
+	// automatic compaction.
+	CompactSize int64
+	// OnSent is called after an entry is delivered. It may be nil.
+	OnSent func(entry *OutboxEntry)
+	// OnError is called after a failed attempt, and with a nil entry for
+	// errors in Run such as failed writes of the log. It may be nil.
+	OnError func(entry *OutboxEntry, err error)
+
+	client  *Client
+	dir     string
+	limiter *rateLimiter
+	now     func() time.Time
+	wake    chan struct{}
+
+	mu      sync.Mutex
+	log     *os.File
+	entries map[string]*OutboxEntry
+	order   []string
+
+	// delivering serializes delivery passes
+	delivering sync.Mutex
+}
+
+// OpenOutbox opens the outbox in the directory, creating it if needed,
+// and loads entries left from the previous run.
+func OpenOutbox(client *Client, dir string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	o := &Outbox{
+		client:  client,
+		dir:     dir,
+		now:     time.Now,
+		wake:    make(chan struct{}, 1),
+		entries: make(map[string]*OutboxEntry),
+	}
+
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, OutboxLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox log: %w", err)
+	}
+	o.log = log
+
+	return o, nil
+}
+
+// load replays the log. The last record of an entry wins.
+func (o *Outbox) load() error {
+	entries, err := readOutboxFile(filepath.Join(o.dir, OutboxLogFile))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, ok := o.entries[entry.ID]; !ok {
+			o.order = append(o.order, entry.ID)
+		}
+		o.entries[entry.ID] = entry
+	}
+	o.prune()
+	return nil
+}
+
+// prune forgets dead entries, which live in the dead-letter file.
+func (o *Outbox) prune() {
+	order := o.order[:0]
+	for _, id := range o.order {
+		if o.entries[id].Status == OutboxDead {
+			delete(o.entries, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	o.order = order
+}
+
+// readOutboxFile reads JSON lines of entries. A torn last line left by a
+// crash is ignored.
+func readOutboxFile(path string) ([]*OutboxEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	defer file.Close()
+
+	var entries []*OutboxEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry OutboxEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.ID == "" {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return entries, nil
+}
+
+// SetRate limits deliveries to the number of messages per second.
+// Zero disables the limit.
+func (o *Outbox) SetRate(perSecond float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.limiter = newRateLimiter(perSecond)
+}
+
+// Enqueue adds a message to a chat to the outbox.
+func (o *Outbox) Enqueue(chatID int64, text string, replyNo *int64) (*OutboxEntry, error) {
+	if chatID == 0 {
+		return nil, fmt.Errorf("chat_id cannot be zero")
+	}
+	return o.enqueue(&OutboxEntry{Kind: OutboxMessage, ChatID: chatID, Text: text, ReplyNo: replyNo})
+}
+
+// EnqueuePrivate adds a private message to a user to the outbox.
+func (o *Outbox) EnqueuePrivate(userID int64, text string) (*OutboxEntry, error) {
+	if userID == 0 {
+		return nil, fmt.Errorf("user_id cannot be zero")
+	}
+	return o.enqueue(&OutboxEntry{Kind: OutboxPrivateMessage, UserID: userID, Text: text})
+}
+
+// EnqueueBroadcast adds a message to each of the chats to the outbox.
+func (o *Outbox) EnqueueBroadcast(chatIDs []int64, text string) ([]*OutboxEntry, error) {
+	entries := make([]*OutboxEntry, 0, len(chatIDs))
+	for _, chatID := range chatIDs {
+		entry, err := o.Enqueue(chatID, text, nil)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (o *Outbox) enqueue(entry *OutboxEntry) (*OutboxEntry, error) {
+	if entry.Text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry.ID = newID()
+	entry.Status = OutboxPending
+	entry.Created = o.now()
+
+	if err := o.append(entry); err != nil {
+		return nil, err
+	}
+	o.entries[entry.ID] = entry
+	o.order = append(o.order, entry.ID)
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	copied := *entry
+	return &copied, nil
+}
+
+// append writes the entry to the log and syncs it to disk.
+func (o *Outbox) append(entry *OutboxEntry) error {
+	if o.log == nil {
+		return fmt.Errorf("outbox is closed")
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox entry: %w", err)
+	}
+	if _, err := o.log.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write outbox log: %w", err)
+	}
+	if err := o.log.Sync(); err != nil {
+		return fmt.Errorf("failed to sync outbox log: %w", err)
+	}
+	return nil
+}
+
+// Get returns a pending or delivered entry.
+func (o *Outbox) Get(id string) (*OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.entries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *entry
+	return &copied, nil
+}
+
+// Pending returns the entries waiting for delivery in order.
+func (o *Outbox) Pending() []*OutboxEntry {
+	return o.list(OutboxPending)
+}
+
+// Sent returns the delivered entries kept since the last Compact.
+func (o *Outbox) Sent() []*OutboxEntry {
+	return o.list(OutboxSent)
+}
+
+func (o *Outbox) list(status OutboxStatus) []*OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var entries []*OutboxEntry
+	for _, id := range o.order {
+		if entry := o.entries[id]; entry.Status == status {
+			copied := *entry
+			entries = append(entries, &copied)
+		}
+	}
+	return entries
+}
+
+// DeadLetters returns the entries in the dead-letter file.
+func (o *Outbox) DeadLetters() ([]*OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return readOutboxFile(filepath.Join(o.dir, OutboxDeadFile))
+}
+
+// Replay moves a dead entry back to the outbox for another round of attempts.
+func (o *Outbox) Replay(id string) error {
+	return o.replay(func(entry *OutboxEntry) bool { return entry.ID == id }, true)
+}
+
+// ReplayAll moves all dead entries back to the outbox.
+func (o *Outbox) ReplayAll() error {
+	return o.replay(func(*OutboxEntry) bool { return true }, false)
+}
+
+func (o *Outbox) replay(match func(*OutboxEntry) bool, required bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path := filepath.Join(o.dir, OutboxDeadFile)
+	dead, err := readOutboxFile(path)
+	if err != nil {
+		return err
+	}
+
+	var keep, replay []*OutboxEntry
+	for _, entry := range dead {
+		if match(entry) {
+			replay = append(replay, entry)
+		} else {
+			keep = append(keep, entry)
+		}
+	}
+	if len(replay) == 0 {
+		if required {
+			return ErrNotFound
+		}
+		return nil
+	}
+
+	for _, entry := range replay {
+		entry.Status = OutboxPending
+		entry.Attempts = 0
+		entry.NextAttempt = time.Time{}
+		if err := o.append(entry); err != nil {
+			return err
+		}
+		if _, ok := o.entries[entry.ID]; !ok {
+			o.order = append(o.order, entry.ID)
+		}
+		o.entries[entry.ID] = entry
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return writeOutboxFile(path, keep)
+}
+
+// writeOutboxFile atomically replaces the file with the entries.
+func writeOutboxFile(path string, entries []*OutboxEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Base(path), err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to encode outbox entry: %w", err)
+		}
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// DeliverDue makes one delivery pass over the pending entries whose next
+// attempt is due. Entries to the same chat or user are delivered in order:
+// an entry waiting for a retry holds back the later ones.
+//
+// Failed attempts are reported to OnError and retried later; the returned
+// error is about the outbox itself, e.g. a failed write of the log.
+func (o *Outbox) DeliverDue(ctx context.Context) error {
+	o.delivering.Lock()
+	defer o.delivering.Unlock()
+
+	var errs []error
+	blocked := make(map[string]bool)
+	for _, entry := range o.Pending() {
+		target := entry.target()
+		if blocked[target] {
+			continue
+		}
+		if entry.NextAttempt.After(o.now()) {
+			blocked[target] = true
+			continue
+		}
+
+		o.mu.Lock()
+		limiter := o.limiter
+		o.mu.Unlock()
+		if err := limiter.Wait(ctx); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		delivered, err := o.deliver(entry)
+		if !delivered {
+			blocked[target] = true
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver sends the entry and records the result. It reports whether the
+// entry was delivered and returns the error of recording the result.
+func (o *Outbox) deliver(entry *OutboxEntry) (bool, error) {
+	postNos, err := o.send(entry)
+
+	o.mu.Lock()
+	entry.Attempts++
+	entry.PostNos = postNos
+	if err == nil {
+		entry.Status = OutboxSent
+		entry.Sent = o.now()
+		entry.LastError = ""
+		entry.APIError = nil
+	} else {
+		entry.LastError = err.Error()
+		entry.APIError = nil
+		var apiErr *APIError
+		permanent := false
+		if errors.As(err, &apiErr) {
+			entry.APIError = apiErr
+			permanent = !apiErr.Temporary()
+		}
+		if permanent || entry.Attempts >= o.maxAttempts() {
+			entry.Status = OutboxDead
+		} else {
+			entry.NextAttempt = o.now().Add(o.retryDelay(entry.Attempts))
+		}
+	}
+	recordErr := o.record(entry)
+	copied := *entry
+	o.mu.Unlock()
+
+	if err != nil {
+		if o.OnError != nil {
+			o.OnError(&copied, err)
+		}
+	} else if o.OnSent != nil {
+		o.OnSent(&copied)
+	}
+
+	if recordErr != nil {
+		recordErr = fmt.Errorf("failed to record outbox entry %s: %w", copied.ID, recordErr)
+	}
+	return err == nil, recordErr
+}
+
+// record stores the new state of the entry. Dead entries are moved to
+// the dead-letter file.
+func (o *Outbox) record(entry *OutboxEntry) error {
+	if entry.Status == OutboxDead {
+		dead, err := os.OpenFile(filepath.Join(o.dir, OutboxDeadFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open dead-letter file: %w", err)
+		}
+		data, _ := json.Marshal(entry)
+		_, err = dead.Write(append(data, '\n'))
+		if err == nil {
+			err = dead.Sync()
+		}
+		if closeErr := dead.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write dead-letter file: %w", err)
+		}
+	}
+
+	if err := o.append(entry); err != nil {
+		return err
+	}
+	o.entries[entry.ID] = entry
+	if entry.Status == OutboxDead {
+		o.prune()
+	}
+	return nil
+}
+
+// send delivers the parts of the message not sent yet and returns the
+// posts of all sent parts, also when a part fails.
+func (o *Outbox) send(entry *OutboxEntry) ([]int64, error) {
+	if entry.Kind != OutboxMessage && entry.Kind != OutboxPrivateMessage {
+		return entry.PostNos, fmt.Errorf("unknown outbox entry kind '%s'", entry.Kind)
+	}
+
+	parts := SplitMessage(entry.Text, o.client.maxMessageLength())
+	postNos := append([]int64(nil), entry.PostNos...)
+	for i := len(postNos); i < len(parts); i++ {
+		// Later parts reply to the first one
+		replyNo := entry.ReplyNo
+		if i > 0 {
+			replyNo = &postNos[0]
+		}
+
+		postNo, err := o.sendPart(entry, parts[i], replyNo)
+		if err != nil {
+			if len(parts) > 1 {
+				err = fmt.Errorf("failed to send part %d of %d: %w", i+1, len(parts), err)
+			}
+			return postNos, err
+		}
+		postNos = append(postNos, postNo)
+	}
+	return postNos, nil
+}
+
+// sendPart sends a single part of the message.
+func (o *Outbox) sendPart(entry *OutboxEntry, text string, replyNo *int64) (int64, error) {
+	if entry.Kind == OutboxPrivateMessage {
+		userID := entry.UserID
+		response, err := o.client.postPrivateMessage(PrivateMessageRequest{Text: text, UserID: &userID, ReplyNo: replyNo})
+		if err != nil {
+			return 0, err
+		}
+		return response.PostNo, nil
+	}
+
+	response, err := o.client.postMessage(SendMessageRequest{
+		Key:     o.client.BotToken(),
+		ChatID:  entry.ChatID,
+		Text:    text,
+		ReplyNo: replyNo,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return response.PostNo, nil
+}
+
+func (o *Outbox) maxAttempts() int {
+	if o.MaxAttempts > 0 {
+		return o.MaxAttempts
+	}
+	return DefaultOutboxMaxAttempts
+}
+
+// retryDelay returns the delay after the attempt with exponential backoff.
+func (o *Outbox) retryDelay(attempt int) time.Duration {
+	delay, maxDelay := o.RetryDelay, o.MaxRetryDelay
+	if delay <= 0 {
+		delay = DefaultOutboxRetryDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultOutboxMaxRetryDelay
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// Run delivers entries until the context is canceled. Errors are reported
+// to OnError. Sent entries are forgotten when the log grows beyond
+// CompactSize.
+func (o *Outbox) Run(ctx context.Context) error {
+	for {
+		err := o.DeliverDue(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			err = o.compactIfLarge()
+		}
+		if err != nil && o.OnError != nil {
+			o.OnError(nil, err)
+		}
+
+		timer := time.NewTimer(o.nextWait())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-o.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// compactIfLarge compacts the log if it is larger than CompactSize.
+func (o *Outbox) compactIfLarge() error {
+	limit := o.CompactSize
+	if limit == 0 {
+		limit = DefaultOutboxCompactSize
+	}
+	if limit < 0 {
+		return nil
+	}
+
+	o.mu.Lock()
+	log := o.log
+	o.mu.Unlock()
+	if log == nil {
+		return nil
+	}
+	info, err := log.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat outbox log: %w", err)
+	}
+	if info.Size() <= limit {
+		return nil
+	}
+	return o.Compact()
+}
+
+// nextWait returns the time until the earliest retry.
+func (o *Outbox) nextWait() time.Duration {
+	wait := outboxIdleWait
+	now := o.now()
+	for _, entry := range o.Pending() {
+		if d := entry.NextAttempt.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// Compact rewrites the log with the pending entries only, forgetting
+// delivered ones. It returns an error after Close.
+func (o *Outbox) Compact() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.log == nil {
+		return fmt.Errorf("outbox is closed")
+	}
+
+	var pending []*OutboxEntry
+	order := o.order[:0]
+	for _, id := range o.order {
+		entry := o.entries[id]
+		if entry.Status != OutboxPending {
+			delete(o.entries, id)
+			continue
+		}
+		pending = append(pending, entry)
+		order = append(order, id)
+	}
+	o.order = order
+
+	path := filepath.Join(o.dir, OutboxLogFile)
+	if err := writeOutboxFile(path, pending); err != nil {
+		return err
+	}
+
+	o.log.Close()
+	log, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		o.log = nil
+		return fmt.Errorf("failed to open outbox log: %w", err)
+	}
+	o.log = log
+	return nil
+}
+
+// Close closes the outbox log.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.log == nil {
+		return nil
+	}
+	err := o.log.Close()
+	o.log = nil
+	return err
+}
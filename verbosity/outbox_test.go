@@ -0,0 +1,303 @@
+package verbosity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"code":"access_deny","message":"no access"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+	_, err := client.SendMessage(1, "hello", nil)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %T: %v", err, err)
+	}
+	if apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "access_deny" || apiErr.Temporary() {
+		t.Errorf("Unexpected API error %+v", apiErr)
+	}
+	if err.Error() != "API error (code=access_deny): no access (status=403)" {
+		t.Errorf("Unexpected error message '%s'", err.Error())
+	}
+	if !IsAccessDeniedError(err) {
+		t.Error("IsAccessDeniedError should recognize APIError")
+	}
+}
+
+// flakyServer fails the first requests to each chat with the status.
+type flakyServer struct {
+	mu       sync.Mutex
+	failures map[int64]int
+	status   map[int64]int
+	sent     []string
+	lastNo   int64
+}
+
+func newFlakyServer(t *testing.T) (*flakyServer, *Client) {
+	flaky := &flakyServer{failures: make(map[int64]int), status: make(map[int64]int)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SendMessageRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		flaky.mu.Lock()
+		defer flaky.mu.Unlock()
+
+		if flaky.failures[req.ChatID] > 0 {
+			flaky.failures[req.ChatID]--
+			w.WriteHeader(flaky.status[req.ChatID])
+			w.Write([]byte(`{"code":"error","message":"failed"}`))
+			return
+		}
+		flaky.lastNo++
+		flaky.sent = append(flaky.sent, req.Text)
+		json.NewEncoder(w).Encode(MessageResponse{PostNo: flaky.lastNo})
+	}))
+	t.Cleanup(server.Close)
+
+	return flaky, NewClient(&Config{APIURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+}
+
+func TestOutboxRetries(t *testing.T) {
+	flaky, client := newFlakyServer(t)
+	flaky.failures[1], flaky.status[1] = 1, http.StatusServiceUnavailable
+	flaky.failures[2], flaky.status[2] = 1, http.StatusForbidden
+
+	dir := t.TempDir()
+	outbox, err := OpenOutbox(client, dir)
+	if err != nil {
+		t.Fatalf("OpenOutbox should not return error: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	outbox.now = func() time.Time { return now }
+
+	first, _ := outbox.Enqueue(1, "first", nil)
+	outbox.Enqueue(1, "second", nil)
+	forbidden, _ := outbox.Enqueue(2, "forbidden", nil)
+	outbox.EnqueuePrivate(7, "private")
+
+	if err := outbox.DeliverDue(context.Background()); err != nil {
+		t.Fatalf("DeliverDue should not return error: %v", err)
+	}
+
+	// The second message waits for the first one to preserve the order
+	if len(flaky.sent) != 1 || flaky.sent[0] != "private" {
+		t.Fatalf("Expected only the private message to be sent, got %v", flaky.sent)
+	}
+
+	entry, _ := outbox.Get(first.ID)
+	if entry.Attempts != 1 || entry.APIError == nil || entry.APIError.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a recorded temporary failure, got %+v", entry)
+	}
+	if !entry.NextAttempt.Equal(now.Add(DefaultOutboxRetryDelay)) {
+		t.Errorf("Expected retry at %v, got %v", now.Add(DefaultOutboxRetryDelay), entry.NextAttempt)
+	}
+
+	dead, err := outbox.DeadLetters()
+	if err != nil || len(dead) != 1 || dead[0].ID != forbidden.ID || dead[0].APIError.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected the forbidden message in dead letters, got %+v (%v)", dead, err)
+	}
+
+	// Reopen the outbox as after a crash
+	outbox.Close()
+	outbox, err = OpenOutbox(client, dir)
+	if err != nil {
+		t.Fatalf("OpenOutbox should not return error: %v", err)
+	}
+	defer outbox.Close()
+	now = now.Add(time.Minute)
+	outbox.now = func() time.Time { return now }
+
+	if pending := outbox.Pending(); len(pending) != 2 {
+		t.Fatalf("Expected 2 pending entries after reopening, got %d", len(pending))
+	}
+
+	outbox.DeliverDue(context.Background())
+	if len(flaky.sent) != 3 || flaky.sent[1] != "first" || flaky.sent[2] != "second" {
+		t.Fatalf("Expected messages in order, got %v", flaky.sent)
+	}
+	if entry, _ := outbox.Get(first.ID); entry.Status != OutboxSent || len(entry.PostNos) != 1 || entry.PostNos[0] != 2 {
+		t.Errorf("Expected delivered entry with post 2, got %+v", entry)
+	}
+
+	if err := outbox.Replay(forbidden.ID); err != nil {
+		t.Fatalf("Replay should not return error: %v", err)
+	}
+	if dead, _ := outbox.DeadLetters(); len(dead) != 0 {
+		t.Errorf("Replayed entry should leave the dead letters, got %d", len(dead))
+	}
+	outbox.DeliverDue(context.Background())
+	if len(flaky.sent) != 4 || flaky.sent[3] != "forbidden" {
+		t.Errorf("Expected replayed message to be sent, got %v", flaky.sent)
+	}
+
+	if err := outbox.Compact(); err != nil {
+		t.Fatalf("Compact should not return error: %v", err)
+	}
+	if len(outbox.Sent()) != 0 || len(outbox.Pending()) != 0 {
+		t.Errorf("Compact should forget delivered entries")
+	}
+	if err := outbox.Replay("unknown"); err != ErrNotFound {
+		t.Errorf("Replay of unknown entry should return ErrNotFound, got %v", err)
+	}
+	outbox.Close()
+	if err := outbox.Compact(); err == nil {
+		t.Error("Compact should return error after Close")
+	}
+	if outbox.log != nil {
+		t.Error("Compact should not reopen the log of a closed outbox")
+	}
+}
+
+func TestOutboxMaxAttempts(t *testing.T) {
+	flaky, client := newFlakyServer(t)
+	flaky.failures[1], flaky.status[1] = 10, http.StatusInternalServerError
+
+	outbox, err := OpenOutbox(client, t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenOutbox should not return error: %v", err)
+	}
+	defer outbox.Close()
+	outbox.MaxAttempts = 2
+	outbox.RetryDelay = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go outbox.Run(ctx)
+
+	outbox.Enqueue(1, "doomed", nil)
+	for ctx.Err() == nil {
+		if dead, _ := outbox.DeadLetters(); len(dead) == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	dead, _ := outbox.DeadLetters()
+	if len(dead) != 1 || dead[0].Attempts != 2 {
+		t.Fatalf("Expected entry dead after 2 attempts, got %+v", dead)
+	}
+	if len(outbox.Pending()) != 0 {
+		t.Errorf("Dead entry should not be pending")
+	}
+}
+
+func TestOutboxResumesSplitMessage(t *testing.T) {
+	var mu sync.Mutex
+	var sent []SendMessageRequest
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SendMessageRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"code":"error","message":"failed"}`))
+			return
+		}
+		sent = append(sent, req)
+		json.NewEncoder(w).Encode(MessageResponse{PostNo: int64(100 + len(sent))})
+	}))
+	defer server.Close()
+	client := NewClient(&Config{APIURL: server.URL, APIToken: "test_token_1234567890123456789012", MaxMessageLength: 40})
+
+	outbox, err := OpenOutbox(client, t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenOutbox should not return error: %v", err)
+	}
+	defer outbox.Close()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	outbox.now = func() time.Time { return now }
+
+	text := strings.Repeat("first part ", 3) + "\n\n" + strings.Repeat("second part ", 3) + "\n\n" + strings.Repeat("third part ", 3)
+	entry, _ := outbox.Enqueue(1, text, nil)
+
+	outbox.DeliverDue(context.Background())
+	if pending, _ := outbox.Get(entry.ID); pending.Status != OutboxPending || len(pending.PostNos) != 1 {
+		t.Fatalf("Expected the first part to be recorded, got %+v", pending)
+	}
+
+	now = now.Add(time.Minute)
+	outbox.DeliverDue(context.Background())
+
+	delivered, _ := outbox.Get(entry.ID)
+	if delivered.Status != OutboxSent || len(delivered.PostNos) != 3 {
+		t.Fatalf("Expected all parts to be delivered, got %+v", delivered)
+	}
+	if len(sent) != 3 || !strings.HasPrefix(sent[1].Text, "second") || !strings.HasPrefix(sent[2].Text, "third") {
+		t.Fatalf("Expected each part to be sent once, got %+v", sent)
+	}
+	if sent[2].ReplyNo == nil || *sent[2].ReplyNo != 101 {
+		t.Errorf("Expected later parts to reply to the first post, got %v", sent[2].ReplyNo)
+	}
+}
+
+func TestOutboxRunReportsErrorsAndCompacts(t *testing.T) {
+	_, client := newFlakyServer(t)
+
+	outbox, err := OpenOutbox(client, t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenOutbox should not return error: %v", err)
+	}
+	defer outbox.Close()
+	outbox.CompactSize = 1
+
+	errs := make(chan error, 10)
+	outbox.OnError = func(entry *OutboxEntry, err error) {
+		if entry == nil {
+			errs <- err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- outbox.Run(ctx) }()
+
+	entry, _ := outbox.Enqueue(1, "hello", nil)
+	deadline := time.Now().Add(time.Second)
+	for len(outbox.Sent()) > 0 || len(outbox.Pending()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the delivered entry to be compacted away")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := outbox.Get(entry.ID); err != ErrNotFound {
+		t.Errorf("Expected the entry to be forgotten, got %v", err)
+	}
+
+	// Break the log so that recording a delivery fails
+	outbox.mu.Lock()
+	outbox.log.Close()
+	outbox.entries["broken"] = &OutboxEntry{ID: "broken", Kind: OutboxMessage, ChatID: 1, Text: "x", Status: OutboxPending}
+	outbox.order = append(outbox.order, "broken")
+	outbox.mu.Unlock()
+	outbox.wake <- struct{}{}
+
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "failed to record outbox entry broken") {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the log write error to be reported")
+	}
+
+	cancel()
+	<-done
+}
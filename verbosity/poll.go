@@ -0,0 +1,480 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PollVoteAction is the action used by poll option buttons.
+const PollVoteAction = "poll.vote"
+
+// pollBarWidth is the width of a tally bar in characters.
+const pollBarWidth = 10
+
+const pollKeyPrefix = "poll:"
+
+// DefaultPollRetention is how long closed polls are kept when
+// Polls.Retention is zero.
+const DefaultPollRetention = 24 * time.Hour
+
+// PollRequest describes a poll to create.
+type PollRequest struct {
+	ChatID   int64
+	Question string
+	Options  []string
+	// Changeable allows users to change their vote.
+	Changeable bool
+	// Anonymous hides who voted for which option.
+	Anonymous bool
+	// Deadline after which the poll closes. Zero means the poll is
+	// closed manually with Close.
+	Deadline time.Time
+}
+
+// Poll is the stored state of a poll.
+type Poll struct {
+	ID         string           `json:"id"`
+	ChatID     int64            `json:"chat_id"`
+	PostNo     int64            `json:"post_no"`
+	Question   string           `json:"question"`
+	Options    []string         `json:"options"`
+	Changeable bool             `json:"changeable,omitempty"`
+	Anonymous  bool             `json:"anonymous,omitempty"`
+	Deadline   time.Time        `json:"deadline,omitempty"`
+	Votes      map[int64]int    `json:"votes"`
+	Voters     map[int64]string `json:"voters,omitempty"`
+	Closed     bool             `json:"closed,omitempty"`
+	Created    time.Time        `json:"created"`
+	ClosedAt   time.Time        `json:"closed_at,omitempty"`
+	// SummaryNo is the post with the results, sent after the poll is closed.
+	SummaryNo int64 `json:"summary_no,omitempty"`
+	// Announced is set once the post shows the results, the summary is
+	// sent and OnClose has been called.
+	Announced bool `json:"announced,omitempty"`
+}
+
+// Tally returns the number of votes for each option.
+func (p *Poll) Tally() []int {
+	tally := make([]int, len(p.Options))
+	for _, option := range p.Votes {
+		if option >= 0 && option < len(tally) {
+			tally[option]++
+		}
+	}
+	return tally
+}
+
+// Polls runs polls with option buttons.
+//
+// Register the button handler with Attach and call Run to close polls
+// at their deadline, retry failed announcements of the results and delete
+// old closed polls:
+//
+//	polls := verbosity.NewPolls(client, verbosity.NewMemoryStore())
+//	polls.Attach(router)
+//	go polls.Run(ctx, time.Minute)
+type Polls struct {
+	// OnClose is called after the results of a closed poll are sent.
+	// It may be nil.
+	OnClose func(poll *Poll)
+	// Retention is how long closed polls are kept, DefaultPollRetention if zero.
+	Retention time.Duration
+	// OnError is called for errors in Run. It may be nil.
+	OnError func(err error)
+
+	client *Client
+	store  Store
+	now    func() time.Time
+
+	// mu serializes state changes of polls. It is not held during API
+	// calls.
+	mu sync.Mutex
+	// expiry announces the results, reserving each announcement under mu
+	expiry expiryLoop
+	// posts serializes the post updates of each poll
+	posts keyLocks
+}
+
+// NewPolls creates a poll manager that keeps state in the store.
+func NewPolls(client *Client, store Store) *Polls {
+	p := &Polls{
+		client: client,
+		store:  store,
+		now:    time.Now,
+	}
+	p.expiry = expiryLoop{
+		store:   store,
+		prefix:  pollKeyPrefix,
+		newItem: func() expirable { return &Poll{} },
+		finish: func(item expirable) error {
+			poll := item.(*Poll)
+			if err := p.close(poll); err != nil {
+				return fmt.Errorf("failed to close poll %s: %w", poll.ID, err)
+			}
+			return nil
+		},
+		followUp: func(item expirable) error {
+			poll := item.(*Poll)
+			if err := p.announce(poll); err != nil {
+				return fmt.Errorf("failed to close poll %s: %w", poll.ID, err)
+			}
+			return nil
+		},
+		mu: &p.mu,
+	}
+	return p
+}
+
+// Attach registers the vote button handler in the router.
+func (p *Polls) Attach(router *Router) {
+	router.HandleAction(PollVoteAction, p.HandleVote)
+}
+
+// Create posts a poll to the chat.
+func (p *Polls) Create(req PollRequest) (*Poll, error) {
+	if req.Question == "" {
+		return nil, fmt.Errorf("question cannot be empty")
+	}
+	if len(req.Options) < 2 {
+		return nil, fmt.Errorf("poll needs at least two options")
+	}
+
+	poll := &Poll{
+		ID:         newID(),
+		ChatID:     req.ChatID,
+		Question:   req.Question,
+		Options:    req.Options,
+		Changeable: req.Changeable,
+		Anonymous:  req.Anonymous,
+		Deadline:   req.Deadline,
+		Votes:      make(map[int64]int),
+		Created:    p.now(),
+	}
+
+	response, err := p.client.SendRich(req.ChatID, p.Render(poll))
+	if err != nil {
+		return nil, err
+	}
+	poll.PostNo = response.PostNo
+
+	if err := putJSON(p.store, pollKeyPrefix+poll.ID, poll); err != nil {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// Get returns the stored poll.
+func (p *Polls) Get(id string) (*Poll, error) {
+	var poll Poll
+	if err := getJSON(p.store, pollKeyPrefix+id, &poll); err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// Render renders the poll post with tallies.
+func (p *Polls) Render(poll *Poll) *RichMessage {
+	msg := NewRichMessage().Bold(poll.Question).Text("\n")
+
+	tally := poll.Tally()
+	for i, option := range poll.Options {
+		msg.Text("\n")
+		if poll.Closed {
+			msg.Text(option)
+		} else {
+			msg.Action(option, PollVoteAction, map[string]string{"poll": poll.ID, "option": strconv.Itoa(i)})
+		}
+		msg.Text(" " + pollBar(tally[i], len(poll.Votes)))
+
+		if !poll.Anonymous {
+			for _, userID := range pollVoters(poll, i) {
+				msg.Text(" ")
+				msg.Mention(userID, poll.Voters[userID])
+			}
+		}
+	}
+
+	msg.Text(fmt.Sprintf("\n\nVotes: %d", len(poll.Votes)))
+	switch {
+	case poll.Closed:
+		msg.Text(", poll closed")
+	case !poll.Deadline.IsZero():
+		msg.Text(", until " + poll.Deadline.Format("02.01.2006 15:04"))
+	}
+
+	return msg
+}
+
+// pollBar renders a tally bar with the vote count and percentage.
+func pollBar(votes, total int) string {
+	filled, percent := 0, 0
+	if total > 0 {
+		filled = votes * pollBarWidth / total
+		percent = votes * 100 / total
+	}
+	return strings.Repeat("█", filled) + strings.Repeat("░", pollBarWidth-filled) +
+		fmt.Sprintf(" %d (%d%%)", votes, percent)
+}
+
+// pollVoters returns the sorted IDs of users who voted for the option.
+func pollVoters(poll *Poll, option int) []int64 {
+	var voters []int64
+	for userID, vote := range poll.Votes {
+		if vote == option {
+			voters = append(voters, userID)
+		}
+	}
+	sort.Slice(voters, func(i, j int) bool { return voters[i] < voters[j] })
+	return voters
+}
+
+func (p *Poll) expiryState() expiryState {
+	return expiryState{
+		ID:       p.ID,
+		Open:     !p.Closed,
+		Deadline: p.Deadline,
+		Finished: p.ClosedAt,
+		Done:     p.Announced,
+	}
+}
+
+// HandleVote records the vote of the user and updates the post.
+// Votes for closed polls and repeated votes in unchangeable polls are ignored.
+func (p *Polls) HandleVote(req *ActionRequest) error {
+	closed, err := p.vote(req)
+	if err != nil || closed == nil {
+		return err
+	}
+	return p.announce(closed)
+}
+
+// vote records the vote and returns the poll if it is past its deadline
+// and has been closed instead. The voter name is looked up and the post is
+// updated without holding p.mu.
+func (p *Polls) vote(req *ActionRequest) (*Poll, error) {
+	id := req.Params["poll"]
+	poll, err := p.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if poll.ChatID != req.ChatID || poll.Closed {
+		return nil, nil
+	}
+
+	option, err := strconv.Atoi(req.Params["option"])
+	if err != nil || option < 0 || option >= len(poll.Options) {
+		return nil, nil
+	}
+	if previous, voted := poll.Votes[req.UserID]; voted && (!poll.Changeable || previous == option) {
+		return nil, nil
+	}
+
+	var name string
+	if !poll.Anonymous {
+		if user, err := p.client.GetUserByID(req.UserID); err == nil {
+			name = user.UniqueName
+		}
+	}
+
+	poll, closed, err := p.applyVote(id, req, option, name)
+	if err != nil || poll == nil {
+		return nil, err
+	}
+	if closed {
+		return poll, nil
+	}
+	return nil, p.refresh(id)
+}
+
+// applyVote records the vote in the stored poll, or closes it if the
+// deadline has passed. It returns the poll and whether it has been closed,
+// or nil if the vote no longer applies.
+func (p *Polls) applyVote(id string, req *ActionRequest, option int, name string) (*Poll, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	poll, err := p.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if poll.ChatID != req.ChatID || poll.Closed {
+		return nil, false, nil
+	}
+	if !poll.Deadline.IsZero() && !p.now().Before(poll.Deadline) {
+		return poll, true, p.close(poll)
+	}
+	if previous, voted := poll.Votes[req.UserID]; voted && (!poll.Changeable || previous == option) {
+		return nil, false, nil
+	}
+
+	poll.Votes[req.UserID] = option
+	if name != "" {
+		if poll.Voters == nil {
+			poll.Voters = make(map[int64]string)
+		}
+		poll.Voters[req.UserID] = name
+	}
+	if err := putJSON(p.store, pollKeyPrefix+poll.ID, poll); err != nil {
+		return nil, false, err
+	}
+	return poll, false, nil
+}
+
+// refresh updates the post of an open poll with its stored state. Updates
+// of one poll run one at a time, so the post never goes back to an older
+// state.
+func (p *Polls) refresh(id string) error {
+	unlock := p.posts.lock(id)
+	defer unlock()
+
+	p.mu.Lock()
+	poll, err := p.Get(id)
+	p.mu.Unlock()
+	if err != nil || poll.Closed {
+		return err
+	}
+
+	if _, err := p.client.editMessage(poll.ChatID, poll.PostNo, p.Render(poll).String()); err != nil {
+		return fmt.Errorf("failed to update poll post: %w", err)
+	}
+	return nil
+}
+
+// Close closes the poll and replies with the results.
+func (p *Polls) Close(id string) error {
+	poll, err := p.closeByID(id)
+	if err != nil || poll == nil {
+		return err
+	}
+	return p.announce(poll)
+}
+
+func (p *Polls) closeByID(id string) (*Poll, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	poll, err := p.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if poll.Closed {
+		return nil, nil
+	}
+	return poll, p.close(poll)
+}
+
+// close saves the poll as closed and reserves the announcement of the
+// results for the caller. The caller holds p.mu and calls announce after
+// releasing it.
+func (p *Polls) close(poll *Poll) error {
+	poll.Closed = true
+	poll.ClosedAt = p.now()
+
+	if err := putJSON(p.store, pollKeyPrefix+poll.ID, poll); err != nil {
+		return err
+	}
+	p.expiry.reserve(poll.ID)
+	return nil
+}
+
+// announce updates the post of a closed poll, sends the summary and calls
+// OnClose. The poll is marked announced only when all of them succeed, so
+// that CloseDue retries a failed announcement; the summary is sent once.
+// The caller must have reserved the announcement and must not hold p.mu.
+func (p *Polls) announce(poll *Poll) error {
+	err := p.sendResults(poll)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expiry.release(poll.ID)
+	if err != nil {
+		return err
+	}
+	poll.Announced = true
+	return putJSON(p.store, pollKeyPrefix+poll.ID, poll)
+}
+
+func (p *Polls) sendResults(poll *Poll) error {
+	if _, err := p.client.editMessage(poll.ChatID, poll.PostNo, p.Render(poll).String()); err != nil {
+		return fmt.Errorf("failed to update poll post: %w", err)
+	}
+
+	if poll.SummaryNo == 0 {
+		response, err := p.client.SendReply(poll.ChatID, poll.PostNo, pollSummary(poll))
+		if err != nil {
+			return fmt.Errorf("failed to send poll results: %w", err)
+		}
+		poll.SummaryNo = response.PostNo
+
+		p.mu.Lock()
+		err = putJSON(p.store, pollKeyPrefix+poll.ID, poll)
+		p.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.OnClose != nil {
+		p.OnClose(poll)
+	}
+	return nil
+}
+
+// pollSummary renders the final results of the poll.
+func pollSummary(poll *Poll) string {
+	tally := poll.Tally()
+
+	best := 0
+	for _, votes := range tally {
+		if votes > best {
+			best = votes
+		}
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("Poll closed: %s\n", poll.Question))
+	if best == 0 {
+		summary.WriteString("No votes")
+		return summary.String()
+	}
+
+	var winners []string
+	for i, votes := range tally {
+		if votes == best {
+			winners = append(winners, poll.Options[i])
+		}
+	}
+	summary.WriteString(fmt.Sprintf("Result: %s with %d of %d votes", strings.Join(winners, ", "), best, len(poll.Votes)))
+	return summary.String()
+}
+
+// CloseDue closes open polls past their deadline, retries the failed
+// announcements of results and deletes closed polls older than Retention.
+func (p *Polls) CloseDue() error {
+	retention := p.Retention
+	if retention <= 0 {
+		retention = DefaultPollRetention
+	}
+	return p.expiry.process(p.now(), retention)
+}
+
+// Run calls CloseDue every interval until the context is canceled.
+func (p *Polls) Run(ctx context.Context, interval time.Duration) error {
+	return runEvery(ctx, interval, p.CloseDue, func(err error) {
+		if p.OnError != nil {
+			p.OnError(err)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package verbosity
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPolls(t *testing.T) {
+	chat, client := newFakeChat(t)
+	chat.users[1] = User{ID: 1, UniqueName: "alice"}
+	chat.users[2] = User{ID: 2, UniqueName: "bob"}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	polls := NewPolls(client, NewMemoryStore())
+	polls.now = func() time.Time { return now }
+
+	var closed *Poll
+	polls.OnClose = func(poll *Poll) { closed = poll }
+
+	router := NewRouter("mybot")
+	polls.Attach(router)
+
+	poll, err := polls.Create(PollRequest{
+		ChatID:   10,
+		Question: "Lunch?",
+		Options:  []string{"Pizza", "Sushi"},
+		Deadline: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+
+	vote := func(userID int64, option string) {
+		err := router.HandleActionRequest(&ActionRequest{UserID: userID, ChatID: 10, PostNo: poll.PostNo,
+			Action: PollVoteAction, Params: map[string]string{"poll": poll.ID, "option": option}})
+		if err != nil {
+			t.Fatalf("Vote should not return error: %v", err)
+		}
+	}
+
+	vote(1, "0")
+	vote(2, "1")
+	vote(1, "1") // votes are not changeable
+
+	post := chat.post(poll.PostNo)
+	if !contains(post, "[Pizza](bot://poll.vote?") || !contains(post, "█████░░░░░ 1 (50%) @alice") {
+		t.Errorf("Unexpected poll post:\n%s", post)
+	}
+	if !contains(post, "Votes: 2") {
+		t.Errorf("Expected two votes:\n%s", post)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := polls.CloseDue(); err != nil {
+		t.Fatalf("CloseDue should not return error: %v", err)
+	}
+	if closed == nil || !closed.Closed {
+		t.Fatal("Expected poll to be closed")
+	}
+
+	post = chat.post(poll.PostNo)
+	if contains(post, "bot://") || !contains(post, "poll closed") {
+		t.Errorf("Closed poll should have no buttons:\n%s", post)
+	}
+
+	summary := chat.sent[len(chat.sent)-1]
+	if summary != "Poll closed: Lunch?\nResult: Pizza, Sushi with 1 of 2 votes" {
+		t.Errorf("Unexpected summary '%s'", summary)
+	}
+	if chat.replies[chat.lastNo] != poll.PostNo {
+		t.Errorf("Summary should reply to the poll post")
+	}
+
+	vote(2, "0")
+	if stored, _ := polls.Get(poll.ID); stored.Votes[2] != 1 {
+		t.Errorf("Closed poll should ignore votes, got %v", stored.Votes)
+	}
+}
+
+func TestPollsChangeableAnonymous(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	polls := NewPolls(client, NewMemoryStore())
+	poll, err := polls.Create(PollRequest{
+		ChatID:     10,
+		Question:   "Release today?",
+		Options:    []string{"Yes", "No"},
+		Changeable: true,
+		Anonymous:  true,
+	})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+
+	vote := func(option string) {
+		polls.HandleVote(&ActionRequest{UserID: 7, ChatID: 10, PostNo: poll.PostNo,
+			Action: PollVoteAction, Params: map[string]string{"poll": poll.ID, "option": option}})
+	}
+	vote("0")
+	vote("1")
+
+	stored, _ := polls.Get(poll.ID)
+	if tally := stored.Tally(); tally[0] != 0 || tally[1] != 1 {
+		t.Errorf("Expected changed vote, got %v", tally)
+	}
+	if post := chat.post(poll.PostNo); contains(post, "@7") {
+		t.Errorf("Anonymous poll should not show voters:\n%s", post)
+	}
+
+	if err := polls.Close(poll.ID); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+	if summary := chat.sent[len(chat.sent)-1]; summary != "Poll closed: Release today?\nResult: No with 1 of 1 votes" {
+		t.Errorf("Unexpected summary '%s'", summary)
+	}
+}
+
+func TestPollsRetryFailedClose(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	polls := NewPolls(client, NewMemoryStore())
+	polls.now = func() time.Time { return now }
+
+	closed := 0
+	polls.OnClose = func(poll *Poll) { closed++ }
+
+	poll, err := polls.Create(PollRequest{ChatID: 10, Question: "Lunch?", Options: []string{"Pizza", "Sushi"}})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+
+	chat.setFailing(true)
+	if err := polls.Close(poll.ID); err == nil {
+		t.Fatal("Expected error when the results cannot be sent")
+	}
+	chat.setFailing(false)
+	if closed != 0 {
+		t.Fatalf("OnClose should wait for the results, got %d calls", closed)
+	}
+
+	sent := len(chat.sent)
+	if err := polls.CloseDue(); err != nil {
+		t.Fatalf("CloseDue should not return error: %v", err)
+	}
+	if closed != 1 || len(chat.sent) != sent+1 || !contains(chat.sent[sent], "Poll closed: Lunch?") {
+		t.Fatalf("Expected the results to be sent on retry, got %d calls and %q", closed, chat.sent[sent:])
+	}
+
+	polls.CloseDue()
+	if closed != 1 || len(chat.sent) != sent+1 {
+		t.Errorf("Announced poll should not be retried")
+	}
+
+	now = now.Add(DefaultPollRetention)
+	polls.CloseDue()
+	if _, err := polls.Get(poll.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the old poll to be deleted, got %v", err)
+	}
+}
+
+func TestPollsConcurrentVotes(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	polls := NewPolls(client, NewMemoryStore())
+	poll, err := polls.Create(PollRequest{ChatID: 10, Question: "Lunch?", Options: []string{"Pizza", "Sushi"}, Anonymous: true})
+	if err != nil {
+		t.Fatalf("Create should not return error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for userID := int64(1); userID <= 20; userID++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			polls.HandleVote(&ActionRequest{UserID: userID, ChatID: 10, PostNo: poll.PostNo, Action: PollVoteAction,
+				Params: map[string]string{"poll": poll.ID, "option": strconv.Itoa(int(userID % 2))}})
+		}(userID)
+	}
+	wg.Wait()
+
+	stored, err := polls.Get(poll.ID)
+	if err != nil || len(stored.Votes) != 20 {
+		t.Fatalf("Expected 20 stored votes, got %+v (%v)", stored, err)
+	}
+	if post := chat.post(poll.PostNo); !contains(post, "Votes: 20") {
+		t.Errorf("Post should show the stored votes:\n%s", post)
+	}
+}
@@ -0,0 +1,679 @@
+package verbosity
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ReminderDeleteAction is the action used by reminder delete buttons.
+const ReminderDeleteAction = "reminder.delete"
+
+// defaultReminderHour is used when a reminder has a day but no time.
+const defaultReminderHour = 9
+
+var (
+	compactDurationPattern = regexp.MustCompile(`^(\d+)(\pL+)$`)
+	clockPattern           = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	isoDatePattern         = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	dotDatePattern         = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})(?:\.(\d{4}))?$`)
+
+	reminderUnits = map[string]time.Duration{
+		"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+		"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+		"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+
+		"м": time.Minute, "мин": time.Minute, "минута": time.Minute, "минуту": time.Minute, "минуты": time.Minute, "минут": time.Minute,
+		"ч": time.Hour, "час": time.Hour, "часа": time.Hour, "часов": time.Hour,
+		"д": 24 * time.Hour, "дн": 24 * time.Hour, "день": 24 * time.Hour, "дня": 24 * time.Hour, "дней": 24 * time.Hour,
+		"нед": 7 * 24 * time.Hour, "неделя": 7 * 24 * time.Hour, "неделю": 7 * 24 * time.Hour, "недели": 7 * 24 * time.Hour, "недель": 7 * 24 * time.Hour,
+		"полчаса": 30 * time.Minute,
+	}
+
+	reminderWeekdays = map[string]time.Weekday{
+		"sunday": time.Sunday, "sun": time.Sunday, "воскресенье": time.Sunday, "вс": time.Sunday,
+		"monday": time.Monday, "mon": time.Monday, "понедельник": time.Monday, "пн": time.Monday,
+		"tuesday": time.Tuesday, "tue": time.Tuesday, "вторник": time.Tuesday, "вт": time.Tuesday,
+		"wednesday": time.Wednesday, "wed": time.Wednesday, "среда": time.Wednesday, "среду": time.Wednesday, "ср": time.Wednesday,
+		"thursday": time.Thursday, "thu": time.Thursday, "четверг": time.Thursday, "чт": time.Thursday,
+		"friday": time.Friday, "fri": time.Friday, "пятница": time.Friday, "пятницу": time.Friday, "пт": time.Friday,
+		"saturday": time.Saturday, "sat": time.Saturday, "суббота": time.Saturday, "субботу": time.Saturday, "сб": time.Saturday,
+	}
+
+	reminderEvery = map[string]bool{
+		"every": true, "each": true,
+		"каждый": true, "каждую": true, "каждое": true, "каждые": true, "каждого": true,
+	}
+
+	reminderFillers = map[string]bool{
+		"to": true, "that": true, "about": true,
+		"что": true, "чтобы": true, "о": true, "об": true, "про": true,
+	}
+)
+
+// ReminderSpec is a parsed reminder expression.
+//
+// Exactly one of At, Cron and Interval is set.
+type ReminderSpec struct {
+	At       time.Time
+	Cron     string
+	Interval time.Duration
+	Text     string
+	// Lang is "ru" for reminders in Russian and "en" otherwise.
+	Lang string
+}
+
+// ParseReminder parses a reminder time expression followed by the text,
+// in English or Russian, relative to now. Supported expressions:
+//
+//	in 2h, in 30 minutes, через 2 часа, через полчаса
+//	at 15:00, tomorrow 9:00, завтра в 9:00, monday 10:00, в пятницу в 18:00
+//	2025-01-31 18:00, 31.01.2025 18:00, 31.01
+//	every monday 10:00, every day 9:00, every weekday 10:00, every 2h
+//	каждый понедельник в 10:00, каждый день в 9:00, по будням в 10:00, каждые 2 часа
+//
+// A day without a time means 9:00. Words like "to" and "что" before the
+// text are skipped.
+func ParseReminder(text string, now time.Time) (*ReminderSpec, error) {
+	p := &reminderParser{words: strings.Fields(text), now: now}
+	p.lower = make([]string, len(p.words))
+	for i, word := range p.words {
+		p.lower[i] = strings.ToLower(strings.TrimRight(word, ","))
+	}
+
+	spec, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek(0) != "" && reminderFillers[p.peek(0)] {
+		p.pos++
+	}
+	spec.Text = strings.Join(p.words[p.pos:], " ")
+	if spec.Text == "" {
+		return nil, fmt.Errorf("reminder text is empty")
+	}
+
+	spec.Lang = detectLang(p.words)
+	return spec, nil
+}
+
+// reminderParser consumes the words of a reminder expression.
+type reminderParser struct {
+	words []string
+	lower []string
+	pos   int
+	now   time.Time
+}
+
+func (p *reminderParser) peek(offset int) string {
+	if p.pos+offset < len(p.lower) {
+		return p.lower[p.pos+offset]
+	}
+	return ""
+}
+
+func (p *reminderParser) parse() (*ReminderSpec, error) {
+	switch word := p.peek(0); {
+	case word == "in" || word == "через":
+		p.pos++
+		d, ok := p.duration()
+		if !ok {
+			return nil, fmt.Errorf("expected a duration after '%s'", word)
+		}
+		return &ReminderSpec{At: p.now.Add(d)}, nil
+
+	case reminderEvery[word]:
+		p.pos++
+		return p.recurring()
+
+	case word == "по" && (p.peek(1) == "будням" || p.peek(1) == "выходным"):
+		return p.recurring()
+
+	default:
+		return p.oneShot()
+	}
+}
+
+// recurring parses the part of an expression after "every".
+func (p *reminderParser) recurring() (*ReminderSpec, error) {
+	days := ""
+	switch word := p.peek(0); word {
+	case "day", "день":
+		days = "*"
+	case "weekday", "weekdays", "будний", "будням":
+		days = "1-5"
+	case "weekend", "выходные", "выходным":
+		days = "0,6"
+	case "по":
+		p.pos++
+		return p.recurring()
+	default:
+		if weekday, ok := reminderWeekdays[word]; ok {
+			days = strconv.Itoa(int(weekday))
+		}
+	}
+
+	if days == "" {
+		d, ok := p.duration()
+		if !ok {
+			return nil, fmt.Errorf("expected a day or an interval after 'every'")
+		}
+		if d < time.Minute {
+			return nil, fmt.Errorf("interval must be at least one minute")
+		}
+		return &ReminderSpec{Interval: d}, nil
+	}
+
+	p.pos++
+	hour, minute, ok := p.clock()
+	if !ok {
+		hour, minute = defaultReminderHour, 0
+	}
+	return &ReminderSpec{Cron: fmt.Sprintf("%d %d * * %s", minute, hour, days)}, nil
+}
+
+// oneShot parses a day and a time of a one-shot reminder.
+func (p *reminderParser) oneShot() (*ReminderSpec, error) {
+	if word := p.peek(0); (word == "on" || word == "в" || word == "во") && p.isDay(p.peek(1)) {
+		p.pos++
+	}
+
+	today := time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, p.now.Location())
+	var day time.Time
+	weekday := time.Weekday(-1)
+	rollYear := false
+
+	word := p.peek(0)
+	switch {
+	case word == "today" || word == "сегодня":
+		day = today
+	case word == "tomorrow" || word == "завтра":
+		day = today.AddDate(0, 0, 1)
+	case word == "послезавтра":
+		day = today.AddDate(0, 0, 2)
+	default:
+		if wd, ok := reminderWeekdays[word]; ok {
+			weekday = wd
+		} else if date, hasYear, ok := parseReminderDate(word, p.now); ok {
+			day = date
+			rollYear = !hasYear
+		}
+	}
+	dayFound := !day.IsZero() || weekday >= 0
+	if dayFound {
+		p.pos++
+	}
+
+	hour, minute, clockFound := p.clock()
+	if !dayFound && !clockFound {
+		return nil, fmt.Errorf("expected a time like 'in 2h', 'tomorrow 9:00' or 'every monday 10:00'")
+	}
+	if !clockFound {
+		hour, minute = defaultReminderHour, 0
+	}
+	at := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	}
+
+	switch {
+	case weekday >= 0:
+		for i := 0; i <= 7; i++ {
+			candidate := today.AddDate(0, 0, i)
+			if candidate.Weekday() == weekday && at(candidate).After(p.now) {
+				return &ReminderSpec{At: at(candidate)}, nil
+			}
+		}
+	case !day.IsZero():
+		result := at(day)
+		if !result.After(p.now) && rollYear {
+			result = result.AddDate(1, 0, 0)
+		}
+		if !result.After(p.now) {
+			return nil, fmt.Errorf("reminder time %s is in the past", result.Format("02.01.2006 15:04"))
+		}
+		return &ReminderSpec{At: result}, nil
+	}
+
+	result := at(today)
+	if !result.After(p.now) {
+		result = result.AddDate(0, 0, 1)
+	}
+	return &ReminderSpec{At: result}, nil
+}
+
+// isDay checks if the word starts a day expression.
+func (p *reminderParser) isDay(word string) bool {
+	if _, ok := reminderWeekdays[word]; ok {
+		return true
+	}
+	switch word {
+	case "today", "tomorrow", "сегодня", "завтра", "послезавтра":
+		return true
+	}
+	_, _, ok := parseReminderDate(word, p.now)
+	return ok
+}
+
+// duration parses a sequence like "2h", "2 hours 30 minutes" or "полчаса".
+func (p *reminderParser) duration() (time.Duration, bool) {
+	var total time.Duration
+	found := false
+
+	for {
+		word := p.peek(0)
+		if word == "a" || word == "an" || word == "one" {
+			if unit, ok := reminderUnits[p.peek(1)]; ok {
+				total += unit
+				p.pos += 2
+				found = true
+				continue
+			}
+		}
+		if d, err := time.ParseDuration(word); err == nil && d > 0 {
+			total += d
+			p.pos++
+			found = true
+			continue
+		}
+		if match := compactDurationPattern.FindStringSubmatch(word); match != nil {
+			if unit, ok := reminderUnits[match[2]]; ok {
+				n, _ := strconv.Atoi(match[1])
+				total += time.Duration(n) * unit
+				p.pos++
+				found = true
+				continue
+			}
+		}
+		if n, err := strconv.Atoi(word); err == nil && n > 0 {
+			if unit, ok := reminderUnits[p.peek(1)]; ok {
+				total += time.Duration(n) * unit
+				p.pos += 2
+				found = true
+				continue
+			}
+		}
+		if unit, ok := reminderUnits[word]; ok && len([]rune(word)) > 2 {
+			total += unit
+			p.pos++
+			found = true
+			continue
+		}
+		if (word == "and" || word == "и") && found {
+			save := p.pos
+			p.pos++
+			if d, ok := p.duration(); ok {
+				total += d
+				continue
+			}
+			p.pos = save
+		}
+		return total, found
+	}
+}
+
+// clock parses an optional "at"/"в" followed by a time like 15:00 or 3pm.
+func (p *reminderParser) clock() (int, int, bool) {
+	offset := 0
+	if word := p.peek(0); word == "at" || word == "в" || word == "во" {
+		offset = 1
+	}
+
+	match := clockPattern.FindStringSubmatch(p.peek(offset))
+	// A bare number is a time only after "at" or with am/pm
+	if match == nil || (match[2] == "" && match[3] == "" && offset == 0) {
+		return 0, 0, false
+	}
+
+	hour, _ := strconv.Atoi(match[1])
+	minute, _ := strconv.Atoi(match[2])
+	switch match[3] {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+
+	p.pos += offset + 1
+	return hour, minute, true
+}
+
+// parseReminderDate parses 2025-01-31, 31.01.2025 and 31.01.
+func parseReminderDate(word string, now time.Time) (time.Time, bool, bool) {
+	var year, month, day int
+	hasYear := true
+
+	if match := isoDatePattern.FindStringSubmatch(word); match != nil {
+		year, _ = strconv.Atoi(match[1])
+		month, _ = strconv.Atoi(match[2])
+		day, _ = strconv.Atoi(match[3])
+	} else if match := dotDatePattern.FindStringSubmatch(word); match != nil {
+		day, _ = strconv.Atoi(match[1])
+		month, _ = strconv.Atoi(match[2])
+		if match[3] != "" {
+			year, _ = strconv.Atoi(match[3])
+		} else {
+			year = now.Year()
+			hasYear = false
+		}
+	} else {
+		return time.Time{}, false, false
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, now.Location())
+	if date.Day() != day || int(date.Month()) != month {
+		return time.Time{}, false, false
+	}
+	return date, hasYear, true
+}
+
+// reminderMessages are the replies of the reminder commands.
+type reminderMessages struct {
+	prefix, usage, set, recurring, list, empty, deleted, notFound, parseError, deleteLabel string
+	notMember, botNotMember                                                                string
+}
+
+var reminderTexts = map[string]reminderMessages{
+	"en": {
+		prefix:       "Reminder: ",
+		usage:        "Usage: /remind me in 2h to check the release, /remind here every monday 10:00 standup",
+		set:          "Reminder %s set for %s",
+		recurring:    "Reminder %s set: %s, next at %s",
+		list:         "Your reminders:",
+		empty:        "You have no reminders",
+		deleted:      "Reminder %s deleted",
+		notFound:     "Reminder %s not found",
+		parseError:   "Could not understand the time: %v",
+		deleteLabel:  "Delete",
+		notMember:    "You can only set reminders in chats you are a member of",
+		botNotMember: "The bot is not a member of the chat",
+	},
+	"ru": {
+		prefix:       "Напоминание: ",
+		usage:        "Использование: /remind мне через 2 часа проверить релиз, /remind здесь каждый понедельник в 10:00 стендап",
+		set:          "Напоминание %s установлено на %s",
+		recurring:    "Напоминание %s установлено: %s, следующее %s",
+		list:         "Ваши напоминания:",
+		empty:        "У вас нет напоминаний",
+		deleted:      "Напоминание %s удалено",
+		notFound:     "Напоминание %s не найдено",
+		parseError:   "Не удалось разобрать время: %v",
+		deleteLabel:  "Удалить",
+		notMember:    "Напоминания можно ставить только в чатах, где вы состоите",
+		botNotMember: "Бот не состоит в этом чате",
+	},
+}
+
+// Reminders provides the /remind and /reminders bot commands on top of
+// the scheduler.
+//
+//	/remind me in 2h to check the release
+//	/remind here every monday 10:00 standup
+//	/remind #123 tomorrow 9:00 deploy
+//	/remind #"release team" in 1h deploy
+//	/reminders
+//	/reminders delete <id>
+//
+// Reminders for "me" are delivered as private messages, reminders for
+// "here" or another chat are sent to the chat. "#<id>" and "#<title>"
+// select a chat by ID or title, a title with spaces is quoted; the user
+// must be a member of that chat.
+type Reminders struct {
+	// Lang is the language of replies: "en" or "ru". Empty means the
+	// language of the reminder expression, or English for /reminders.
+	Lang string
+	// BotUserID is the user ID of the bot. If set, reminders can only be
+	// set in chats where the bot is a member. Otherwise the chat only has
+	// to be visible to the bot.
+	BotUserID int64
+
+	client    *Client
+	scheduler *Scheduler
+}
+
+// NewReminders creates the reminder commands for the scheduler.
+func NewReminders(client *Client, scheduler *Scheduler) *Reminders {
+	return &Reminders{client: client, scheduler: scheduler}
+}
+
+// Attach registers the /remind and /reminders commands and the delete
+// button handler in the router.
+func (r *Reminders) Attach(router *Router) {
+	router.Handle("remind", r.HandleRemind)
+	router.Handle("reminders", r.HandleList)
+	router.HandleAction(ReminderDeleteAction, r.HandleDelete)
+}
+
+// messages returns the replies in the language.
+func (r *Reminders) messages(lang string) reminderMessages {
+	if r.Lang != "" {
+		lang = r.Lang
+	}
+	if texts, ok := reminderTexts[lang]; ok {
+		return texts
+	}
+	return reminderTexts["en"]
+}
+
+// HandleRemind handles the /remind command.
+func (r *Reminders) HandleRemind(req *BotRequest, args []string) error {
+	if len(args) == 0 {
+		_, err := r.client.SendReply(req.ChatID, req.PostNo, r.messages("en").usage)
+		return err
+	}
+
+	job := Job{Owner: req.UserID, Kind: JobPrivateMessage, UserID: req.UserID}
+	switch target := strings.ToLower(args[0]); {
+	case target == "me" || target == "мне" || target == "меня":
+		args = args[1:]
+	case target == "here" || target == "здесь" || target == "сюда":
+		job.Kind, job.ChatID, job.UserID = JobMessage, req.ChatID, 0
+		args = args[1:]
+	case strings.HasPrefix(target, "#") && len(target) > 1:
+		name, rest, ok := chatTarget(args)
+		if !ok {
+			_, err := r.client.SendReply(req.ChatID, req.PostNo, r.messages(detectLang(args)).usage)
+			return err
+		}
+		chat, err := r.resolveChat(name)
+		if err != nil {
+			_, replyErr := r.client.SendReply(req.ChatID, req.PostNo, err.Error())
+			return replyErr
+		}
+		if reply := r.checkMembers(chat, req.UserID, r.messages(detectLang(args))); reply != "" {
+			_, err := r.client.SendReply(req.ChatID, req.PostNo, reply)
+			return err
+		}
+		job.Kind, job.ChatID, job.UserID = JobMessage, chat.ID, 0
+		args = rest
+	}
+
+	spec, err := ParseReminder(strings.Join(args, " "), r.scheduler.localNow())
+	if err != nil {
+		texts := r.messages(detectLang(args))
+		_, replyErr := r.client.SendReply(req.ChatID, req.PostNo, fmt.Sprintf(texts.parseError, err)+"\n"+texts.usage)
+		return replyErr
+	}
+
+	texts := r.messages(spec.Lang)
+	job.Text = texts.prefix + spec.Text
+	job.At, job.Cron, job.Interval = spec.At, spec.Cron, spec.Interval
+
+	scheduled, err := r.scheduler.Schedule(job)
+	if err != nil {
+		return err
+	}
+
+	reply := fmt.Sprintf(texts.set, scheduled.ID, formatReminderTime(scheduled.Next))
+	if !scheduled.OneShot() {
+		reply = fmt.Sprintf(texts.recurring, scheduled.ID, describeSchedule(scheduled), formatReminderTime(scheduled.Next))
+	}
+	_, err = r.client.SendReply(req.ChatID, req.PostNo, reply)
+	return err
+}
+
+// HandleList handles the /reminders command and its delete subcommand.
+func (r *Reminders) HandleList(req *BotRequest, args []string) error {
+	lang := detectLang(args)
+	texts := r.messages(lang)
+
+	if len(args) >= 2 {
+		switch strings.ToLower(args[0]) {
+		case "delete", "remove", "cancel", "rm", "удалить", "отменить":
+			reply := fmt.Sprintf(texts.deleted, args[1])
+			if err := r.Delete(req.UserID, args[1]); err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					return err
+				}
+				reply = fmt.Sprintf(texts.notFound, args[1])
+			}
+			_, err := r.client.SendReply(req.ChatID, req.PostNo, reply)
+			return err
+		}
+	}
+
+	jobs, err := r.List(req.UserID)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		_, err := r.client.SendReply(req.ChatID, req.PostNo, texts.empty)
+		return err
+	}
+
+	msg := NewRichMessage().Bold(texts.list)
+	for _, job := range jobs {
+		msg.Text(fmt.Sprintf("\n%s — %s", formatReminderTime(job.Next), job.Text))
+		if !job.OneShot() {
+			msg.Text(" (" + describeSchedule(job) + ")")
+		}
+		msg.Text(" ")
+		msg.Action(texts.deleteLabel, ReminderDeleteAction, map[string]string{"id": job.ID, "lang": lang})
+	}
+	_, err = r.client.SendRich(req.ChatID, msg)
+	return err
+}
+
+// HandleDelete handles the reminder delete button. It replies in the
+// language of the list the button belongs to.
+func (r *Reminders) HandleDelete(req *ActionRequest) error {
+	texts := r.messages(req.Params["lang"])
+	id := req.Params["id"]
+
+	reply := fmt.Sprintf(texts.deleted, id)
+	if err := r.Delete(req.UserID, id); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		reply = fmt.Sprintf(texts.notFound, id)
+	}
+	_, err := r.client.SendReply(req.ChatID, req.PostNo, reply)
+	return err
+}
+
+// List returns the reminders of the user ordered by the next run.
+func (r *Reminders) List(userID int64) ([]*Job, error) {
+	jobs, err := r.scheduler.List()
+	if err != nil {
+		return nil, err
+	}
+
+	owned := jobs[:0]
+	for _, job := range jobs {
+		if job.Owner == userID {
+			owned = append(owned, job)
+		}
+	}
+	return owned, nil
+}
+
+// Delete cancels a reminder of the user. ErrNotFound is returned for
+// unknown reminders and reminders of other users.
+func (r *Reminders) Delete(userID int64, id string) error {
+	job, err := r.scheduler.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.Owner != userID {
+		return ErrNotFound
+	}
+	return r.scheduler.Cancel(id)
+}
+
+// resolveChat finds a chat by ID or title.
+func (r *Reminders) resolveChat(name string) (*Chat, error) {
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return r.client.GetChatByID(id)
+	}
+	return r.client.FindChatByTitle(name)
+}
+
+// checkMembers returns the reply rejecting the reminder if the user or the
+// bot is not a member of the chat, or an empty string.
+func (r *Reminders) checkMembers(chat *Chat, userID int64, texts reminderMessages) string {
+	members := int64Set(chat.MemberIDs)
+	if !members[userID] {
+		return texts.notMember
+	}
+	if r.BotUserID != 0 && !members[r.BotUserID] {
+		return texts.botNotMember
+	}
+	return ""
+}
+
+// chatTarget parses the chat target "#<id>", "#<title>" or
+// "#\"<title with spaces>\"" at the start of the arguments. It returns the
+// chat name and the remaining arguments, or false for an unclosed quote.
+func chatTarget(args []string) (string, []string, bool) {
+	if !strings.HasPrefix(args[0], `#"`) {
+		return args[0][1:], args[1:], true
+	}
+
+	var words []string
+	for i, word := range args {
+		if i == 0 {
+			word = word[2:]
+		}
+		if strings.HasSuffix(word, `"`) {
+			words = append(words, strings.TrimSuffix(word, `"`))
+			name := strings.Join(words, " ")
+			return name, args[i+1:], name != ""
+		}
+		words = append(words, word)
+	}
+	return "", nil, false
+}
+
+// describeSchedule renders the schedule of a recurring job.
+func describeSchedule(job *Job) string {
+	if job.Cron != "" {
+		return "cron " + job.Cron
+	}
+	return "every " + job.Interval.String()
+}
+
+func formatReminderTime(t time.Time) string {
+	return t.Format("02.01.2006 15:04")
+}
+
+// detectLang returns "ru" if any of the words is in Cyrillic.
+func detectLang(words []string) string {
+	for _, word := range words {
+		if strings.IndexFunc(word, func(r rune) bool { return unicode.Is(unicode.Cyrillic, r) }) >= 0 {
+			return "ru"
+		}
+	}
+	return "en"
+}
@@ -0,0 +1,179 @@
+package verbosity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReminder(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC) // Wednesday
+
+	tests := []struct {
+		input    string
+		at       time.Time
+		cron     string
+		interval time.Duration
+		text     string
+		lang     string
+	}{
+		{input: "in 2h to check the release", at: now.Add(2 * time.Hour), text: "check the release", lang: "en"},
+		{input: "in 1 hour 30 minutes call Bob", at: now.Add(90 * time.Minute), text: "call Bob", lang: "en"},
+		{input: "через 2 часа проверить релиз", at: now.Add(2 * time.Hour), text: "проверить релиз", lang: "ru"},
+		{input: "через полчаса позвонить", at: now.Add(30 * time.Minute), text: "позвонить", lang: "ru"},
+		{input: "at 10:00 standup", at: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC), text: "standup", lang: "en"},
+		{input: "at 3pm coffee", at: time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC), text: "coffee", lang: "en"},
+		{input: "завтра в 9:15 что сдать отчёт", at: time.Date(2024, 5, 2, 9, 15, 0, 0, time.UTC), text: "сдать отчёт", lang: "ru"},
+		{input: "в пятницу в 18:00 пятничный релиз", at: time.Date(2024, 5, 3, 18, 0, 0, 0, time.UTC), text: "пятничный релиз", lang: "ru"},
+		{input: "on wednesday 10:00 retro", at: time.Date(2024, 5, 8, 10, 0, 0, 0, time.UTC), text: "retro", lang: "en"},
+		{input: "2024-06-01 renew cert", at: time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC), text: "renew cert", lang: "en"},
+		{input: "01.02 18:00 годовщина", at: time.Date(2025, 2, 1, 18, 0, 0, 0, time.UTC), text: "годовщина", lang: "ru"},
+		{input: "every monday 10:00 standup", cron: "0 10 * * 1", text: "standup", lang: "en"},
+		{input: "every weekday at 9:30 daily", cron: "30 9 * * 1-5", text: "daily", lang: "en"},
+		{input: "каждый день в 9:00 зарядка", cron: "0 9 * * *", text: "зарядка", lang: "ru"},
+		{input: "по будням в 10:00 стендап", cron: "0 10 * * 1-5", text: "стендап", lang: "ru"},
+		{input: "каждые 2 часа размяться", interval: 2 * time.Hour, text: "размяться", lang: "ru"},
+		{input: "every 30m drink water", interval: 30 * time.Minute, text: "drink water", lang: "en"},
+	}
+
+	for _, tt := range tests {
+		spec, err := ParseReminder(tt.input, now)
+		if err != nil {
+			t.Errorf("ParseReminder(%q) returned error: %v", tt.input, err)
+			continue
+		}
+		if !spec.At.Equal(tt.at) || spec.Cron != tt.cron || spec.Interval != tt.interval {
+			t.Errorf("ParseReminder(%q) = at %v cron %q interval %v, expected at %v cron %q interval %v",
+				tt.input, spec.At, spec.Cron, spec.Interval, tt.at, tt.cron, tt.interval)
+		}
+		if spec.Text != tt.text || spec.Lang != tt.lang {
+			t.Errorf("ParseReminder(%q) text %q lang %s, expected %q %s", tt.input, spec.Text, spec.Lang, tt.text, tt.lang)
+		}
+	}
+}
+
+func TestParseReminderInvalid(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	for _, input := range []string{"", "check the release", "in 2h", "in soon check", "2024-01-01 10:00 past", "every 10s spam"} {
+		if _, err := ParseReminder(input, now); err == nil {
+			t.Errorf("ParseReminder(%q) should return error", input)
+		}
+	}
+}
+
+func TestReminders(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	scheduler := NewScheduler(client, NewMemoryStore())
+	scheduler.Location = time.UTC
+	scheduler.now = func() time.Time { return now }
+
+	reminders := NewReminders(client, scheduler)
+	router := NewRouter("mybot")
+	reminders.Attach(router)
+
+	if err := router.HandleMessage(&BotRequest{UserID: 7, ChatID: 10, PostNo: 1, Text: "/remind me in 2h to check the release"}); err != nil {
+		t.Fatalf("Remind should not return error: %v", err)
+	}
+	if err := router.HandleMessage(&BotRequest{UserID: 7, ChatID: 10, PostNo: 2, Text: "/remind здесь каждый понедельник в 10:00 стендап"}); err != nil {
+		t.Fatalf("Remind should not return error: %v", err)
+	}
+	router.HandleMessage(&BotRequest{UserID: 8, ChatID: 10, PostNo: 3, Text: "/remind me tomorrow 9:00 other user"})
+
+	if len(chat.sent) != 3 || !contains(chat.sent[0], "set for 01.05.2024 14:30") || !hasPrefix(chat.sent[1], "Напоминание") {
+		t.Fatalf("Unexpected confirmations %q", chat.sent)
+	}
+
+	jobs, err := reminders.List(7)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("Expected 2 reminders of user 7, got %d (%v)", len(jobs), err)
+	}
+	if jobs[0].Kind != JobPrivateMessage || jobs[0].UserID != 7 || jobs[0].Text != "Reminder: check the release" {
+		t.Errorf("Unexpected private reminder %+v", jobs[0])
+	}
+	if jobs[1].Kind != JobMessage || jobs[1].ChatID != 10 || jobs[1].Cron != "0 10 * * 1" {
+		t.Errorf("Unexpected chat reminder %+v", jobs[1])
+	}
+
+	router.HandleMessage(&BotRequest{UserID: 7, ChatID: 10, PostNo: 4, Text: "/reminders"})
+	list := chat.sent[len(chat.sent)-1]
+	if !contains(list, "Reminder: check the release") || !contains(list, "bot://reminder.delete?") || contains(list, "other user") {
+		t.Errorf("Unexpected reminder list:\n%s", list)
+	}
+
+	// Other users cannot delete the reminder
+	router.HandleActionRequest(&ActionRequest{UserID: 8, ChatID: 10, Action: ReminderDeleteAction, Params: map[string]string{"id": jobs[0].ID}})
+	if _, err := scheduler.Get(jobs[0].ID); err != nil {
+		t.Errorf("Reminder of another user should not be deleted: %v", err)
+	}
+
+	router.HandleMessage(&BotRequest{UserID: 7, ChatID: 10, PostNo: 5, Text: "/reminders delete " + jobs[0].ID})
+	if _, err := scheduler.Get(jobs[0].ID); err != ErrNotFound {
+		t.Errorf("Reminder should be deleted, got %v", err)
+	}
+
+	now = now.Add(3 * time.Hour)
+	scheduler.RunDue()
+	if last := chat.sent[len(chat.sent)-1]; contains(last, "check the release") {
+		t.Errorf("Deleted reminder should not be delivered")
+	}
+}
+
+func TestRemindersRequireChatMembership(t *testing.T) {
+	chat, client := newFakeChat(t)
+	chat.chats[20] = Chat{ID: 20, Title: "ops", MemberIDs: []int64{7, 99}}
+	chat.chats[30] = Chat{ID: 30, Title: "sales", MemberIDs: []int64{7}}
+
+	scheduler := NewScheduler(client, NewMemoryStore())
+	reminders := NewReminders(client, scheduler)
+	reminders.BotUserID = 99
+	router := NewRouter("mybot")
+	reminders.Attach(router)
+
+	remind := func(userID int64, text string) string {
+		t.Helper()
+		if err := router.HandleMessage(&BotRequest{UserID: userID, ChatID: 10, PostNo: 1, Text: text}); err != nil {
+			t.Fatalf("Remind should not return error: %v", err)
+		}
+		return chat.sent[len(chat.sent)-1]
+	}
+
+	if reply := remind(8, "/remind #20 in 1h deploy"); reply != "You can only set reminders in chats you are a member of" {
+		t.Errorf("Expected a non-member to be rejected, got %q", reply)
+	}
+	if reply := remind(7, "/remind #sales in 1h call"); reply != "The bot is not a member of the chat" {
+		t.Errorf("Expected a chat without the bot to be rejected, got %q", reply)
+	}
+	if jobs, _ := scheduler.List(); len(jobs) != 0 {
+		t.Fatalf("Rejected reminders should not be scheduled, got %d", len(jobs))
+	}
+
+	remind(7, "/remind #ops in 1h deploy")
+	jobs, err := scheduler.List()
+	if err != nil || len(jobs) != 1 || jobs[0].ChatID != 20 {
+		t.Fatalf("Expected a reminder in chat 20, got %+v (%v)", jobs, err)
+	}
+
+	chat.chats[40] = Chat{ID: 40, Title: "release team", MemberIDs: []int64{7, 99}}
+	remind(7, `/remind #"release team" in 1h ship it`)
+	jobs, err = scheduler.List()
+	var quoted *Job
+	for _, job := range jobs {
+		if job.ChatID == 40 {
+			quoted = job
+		}
+	}
+	if err != nil || quoted == nil || quoted.Text != "Reminder: ship it" {
+		t.Fatalf("Expected a reminder in chat 40, got %+v (%v)", jobs, err)
+	}
+	if reply := remind(7, `/remind #"release team in 1h ship it`); !contains(reply, "/remind") {
+		t.Errorf("Expected usage for an unclosed quote, got %q", reply)
+	}
+
+	router.HandleActionRequest(&ActionRequest{UserID: 7, ChatID: 10, Action: ReminderDeleteAction,
+		Params: map[string]string{"id": quoted.ID, "lang": "ru"}})
+	if reply := chat.sent[len(chat.sent)-1]; reply != "Напоминание "+quoted.ID+" удалено" {
+		t.Errorf("Expected the reply in the language of the list, got %q", reply)
+	}
+}
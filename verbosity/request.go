@@ -1,8 +1,8 @@
 package verbosity
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -31,7 +31,7 @@ func (c *Client) newRequest(method, path string, params url.Values, body io.Read
 }
 
 // newFileRequest creates a new HTTP request for file uploads.
-func (c *Client) newFileRequest(path string, body *bytes.Buffer) (*http.Request, error) {
+func (c *Client) newFileRequest(path string, body io.Reader) (*http.Request, error) {
 	requestURL := c.config.FileURL + path
 
 	req, err := http.NewRequest(http.MethodPost, requestURL, body)
@@ -48,7 +48,12 @@ func (c *Client) newFileRequest(path string, body *bytes.Buffer) (*http.Request,
 
 // do executes the request and handles the response.
 func (c *Client) do(req *http.Request, v interface{}) error {
-	resp, err := c.httpClient.Do(req)
+	return c.doWith(c.httpClient, req, v)
+}
+
+// doWith executes the request with the HTTP client and handles the response.
+func (c *Client) doWith(httpClient *http.Client, req *http.Request, v interface{}) error {
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -87,22 +92,49 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 	return nil
 }
 
+// APIError is an error response of the API.
+type APIError struct {
+	StatusCode int    `json:"status_code"`
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message"`
+	// Validation is set for validation errors.
+	Validation bool `json:"validation,omitempty"`
+}
+
+// Error returns the error message.
+func (e *APIError) Error() string {
+	switch {
+	case e.Code != "":
+		return fmt.Sprintf("API error (code=%s): %s (status=%d)", e.Code, e.Message, e.StatusCode)
+	case e.Validation:
+		return fmt.Sprintf("validation error: %s (status=%d)", e.Message, e.StatusCode)
+	default:
+		return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Message)
+	}
+}
+
+// Temporary checks if the request may succeed when retried:
+// the API is rate limiting or failing with a server error.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
 // handleError handles error responses from the API.
 func (c *Client) handleError(statusCode int, body []byte) error {
 	// Try to parse as JSON error response
 	var errorResp ErrorResponse
 	if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Code != "" {
-		return fmt.Errorf("API error (code=%s): %s (status=%d)", errorResp.Code, errorResp.Message, statusCode)
+		return &APIError{StatusCode: statusCode, Code: errorResp.Code, Message: errorResp.Message}
 	}
 
 	// Check for validation errors
 	var validationResp ValidationErrorResponse
 	if err := json.Unmarshal(body, &validationResp); err == nil && validationResp.TamtamResponseAPI {
-		return fmt.Errorf("validation error: %s (status=%d)", validationResp.Error, statusCode)
+		return &APIError{StatusCode: statusCode, Message: validationResp.Error, Validation: true}
 	}
 
 	// Return generic error
-	return fmt.Errorf("API request failed with status %d: %s", statusCode, string(body))
+	return &APIError{StatusCode: statusCode, Message: string(body)}
 }
 
 // IsAccessDeniedError checks if the error is an access denied error.
@@ -126,5 +158,9 @@ func IsNotFoundError(err error) bool {
 	if err == nil {
 		return false
 	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return true
+	}
 	return strings.Contains(err.Error(), "not found")
 }
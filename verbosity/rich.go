@@ -0,0 +1,224 @@
+package verbosity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Text block types used in text_parsed.
+const (
+	BlockText      = "text"
+	BlockBold      = "bold"
+	BlockItalic    = "italic"
+	BlockCode      = "code"
+	BlockCodeBlock = "code_block"
+	BlockLink      = "link"
+	BlockMention   = "mention"
+	BlockAction    = "action"
+	BlockQuote     = "quote"
+)
+
+// RichMessage builds a formatted message.
+//
+// It renders both the plain text and the structured text_parsed payload.
+type RichMessage struct {
+	blocks []TextBlock
+}
+
+// NewRichMessage creates an empty rich message.
+func NewRichMessage() *RichMessage {
+	return &RichMessage{}
+}
+
+// Text appends plain text.
+func (m *RichMessage) Text(text string) *RichMessage {
+	return m.add(TextBlock{Type: BlockText, Value: text})
+}
+
+// Line appends text followed by a line break.
+func (m *RichMessage) Line(text string) *RichMessage {
+	return m.Text(text + "\n")
+}
+
+// Bold appends bold text.
+func (m *RichMessage) Bold(text string) *RichMessage {
+	return m.add(TextBlock{Type: BlockBold, Value: text})
+}
+
+// Italic appends italic text.
+func (m *RichMessage) Italic(text string) *RichMessage {
+	return m.add(TextBlock{Type: BlockItalic, Value: text})
+}
+
+// Code appends inline code.
+func (m *RichMessage) Code(code string) *RichMessage {
+	return m.add(TextBlock{Type: BlockCode, Value: code})
+}
+
+// CodeBlock appends a code block with an optional language.
+func (m *RichMessage) CodeBlock(lang, code string) *RichMessage {
+	return m.add(TextBlock{Type: BlockCodeBlock, Value: code, Lang: lang})
+}
+
+// Link appends a link with a title.
+func (m *RichMessage) Link(title, url string) *RichMessage {
+	return m.add(TextBlock{Type: BlockLink, Value: title, URL: url})
+}
+
+// Mention appends a mention of the user with the given ID and unique name.
+func (m *RichMessage) Mention(userID int64, uniqueName string) *RichMessage {
+	return m.add(TextBlock{Type: BlockMention, Value: uniqueName, UserID: userID})
+}
+
+// MentionName appends a mention of the user by unique name.
+func (m *RichMessage) MentionName(uniqueName string) *RichMessage {
+	return m.add(TextBlock{Type: BlockMention, Value: uniqueName})
+}
+
+// Action appends an action button created with CreateActionURL.
+func (m *RichMessage) Action(title, action string, params map[string]string) *RichMessage {
+	return m.add(TextBlock{Type: BlockAction, Value: title, URL: CreateActionURL(action, title, params)})
+}
+
+// Quote appends quoted text.
+func (m *RichMessage) Quote(text string) *RichMessage {
+	return m.add(TextBlock{Type: BlockQuote, Value: text})
+}
+
+// Append appends all blocks of another message.
+func (m *RichMessage) Append(other *RichMessage) *RichMessage {
+	if other != nil {
+		m.blocks = append(m.blocks, other.blocks...)
+	}
+	return m
+}
+
+// Blocks returns the message blocks.
+func (m *RichMessage) Blocks() []TextBlock {
+	return m.blocks
+}
+
+// IsEmpty checks if the message has no content.
+func (m *RichMessage) IsEmpty() bool {
+	return strings.TrimSpace(m.String()) == ""
+}
+
+// TextParsed returns the structured text_parsed payload.
+func (m *RichMessage) TextParsed() []interface{} {
+	parsed := make([]interface{}, len(m.blocks))
+	for i, block := range m.blocks {
+		parsed[i] = block
+	}
+	return parsed
+}
+
+// String renders the plain text of the message.
+func (m *RichMessage) String() string {
+	var result strings.Builder
+	for _, block := range m.blocks {
+		renderBlock(&result, block)
+	}
+	return result.String()
+}
+
+func renderBlock(result *strings.Builder, block TextBlock) {
+	switch block.Type {
+	case BlockBold:
+		result.WriteString("**" + block.Value + "**")
+	case BlockItalic:
+		result.WriteString("*" + block.Value + "*")
+	case BlockCode:
+		result.WriteString("`" + block.Value + "`")
+	case BlockCodeBlock:
+		startLine(result)
+		result.WriteString("```" + block.Lang + "\n")
+		result.WriteString(strings.TrimSuffix(block.Value, "\n"))
+		result.WriteString("\n```\n")
+	case BlockLink, BlockAction:
+		if block.Value == "" || block.Value == block.URL {
+			result.WriteString(block.URL)
+		} else {
+			result.WriteString(fmt.Sprintf("[%s](%s)", block.Value, block.URL))
+		}
+	case BlockMention:
+		if block.Value != "" {
+			result.WriteString("@" + block.Value)
+		} else {
+			result.WriteString(fmt.Sprintf("@%d", block.UserID))
+		}
+	case BlockQuote:
+		startLine(result)
+		for _, line := range strings.Split(strings.TrimSuffix(block.Value, "\n"), "\n") {
+			result.WriteString("> " + line + "\n")
+		}
+	default:
+		result.WriteString(block.Value)
+	}
+}
+
+// startLine writes a line break unless the builder is empty or ends with one.
+func startLine(result *strings.Builder) {
+	text := result.String()
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		result.WriteString("\n")
+	}
+}
+
+func (m *RichMessage) add(block TextBlock) *RichMessage {
+	m.blocks = append(m.blocks, block)
+	return m
+}
+
+// SendRich sends a formatted message to a non-private chat.
+//
+// API: POST /bot/message
+func (c *Client) SendRich(chatID int64, msg *RichMessage) (*MessageResponse, error) {
+	if chatID == 0 {
+		return nil, fmt.Errorf("chat_id cannot be zero")
+	}
+	if msg == nil || msg.IsEmpty() {
+		return nil, fmt.Errorf("message cannot be empty")
+	}
+
+	reqBody := SendMessageRequest{
+		Key:        c.BotToken(),
+		ChatID:     chatID,
+		Text:       msg.String(),
+		TextParsed: msg.TextParsed(),
+	}
+
+	return c.sendMessage(reqBody)
+}
+
+// UpdateRich replaces the text of a post with a formatted message.
+//
+// API: PUT /msg/post/{chat_id}/{post_no}
+func (c *Client) UpdateRich(chatID, postNo int64, msg *RichMessage) (*UpdateMessageResponse, error) {
+	if msg == nil || msg.IsEmpty() {
+		return nil, fmt.Errorf("message cannot be empty")
+	}
+	return c.UpdateMessage(chatID, postNo, &UpdateMessageRequest{
+		Text:       msg.String(),
+		TextParsed: msg.TextParsed(),
+	})
+}
+
+// SendPrivateRichByID sends a formatted private message to a user by their ID.
+//
+// API: POST /msg/post/private
+func (c *Client) SendPrivateRichByID(userID int64, msg *RichMessage) (*PrivateMessageResponse, error) {
+	if userID == 0 {
+		return nil, fmt.Errorf("user_id cannot be zero")
+	}
+	if msg == nil || msg.IsEmpty() {
+		return nil, fmt.Errorf("message cannot be empty")
+	}
+
+	reqBody := PrivateMessageRequest{
+		Text:       msg.String(),
+		TextParsed: msg.TextParsed(),
+		UserID:     &userID,
+	}
+
+	return c.sendPrivateMessage(reqBody)
+}
@@ -0,0 +1,92 @@
+package verbosity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRichMessageString(t *testing.T) {
+	msg := NewRichMessage().
+		Text("Deploy ").
+		Bold("finished").
+		Text(" by ").
+		Mention(42, "john").
+		Text(", see ").
+		Link("logs", "https://ci.example.com/1").
+		CodeBlock("sh", "make deploy").
+		Quote("all green").
+		Italic("done").
+		Text(" ").
+		Code("v1.2.3")
+
+	expected := "Deploy **finished** by @john, see [logs](https://ci.example.com/1)\n" +
+		"```sh\nmake deploy\n```\n" +
+		"> all green\n" +
+		"*done* `v1.2.3`"
+	if msg.String() != expected {
+		t.Errorf("Expected text:\n%s\ngot:\n%s", expected, msg.String())
+	}
+
+	blocks := msg.Blocks()
+	if blocks[3].Type != BlockMention || blocks[3].UserID != 42 {
+		t.Errorf("Expected mention block with user 42, got %+v", blocks[3])
+	}
+}
+
+func TestRichMessageAction(t *testing.T) {
+	msg := NewRichMessage().Action("Approve", "approve", nil)
+
+	block := msg.Blocks()[0]
+	if block.Type != BlockAction {
+		t.Errorf("Expected action block, got '%s'", block.Type)
+	}
+	if block.URL != "bot://approve?title=Approve" {
+		t.Errorf("Expected action URL, got '%s'", block.URL)
+	}
+	if msg.String() != "[Approve](bot://approve?title=Approve)" {
+		t.Errorf("Unexpected text '%s'", msg.String())
+	}
+}
+
+func TestSendRich(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot/message" {
+			t.Errorf("Expected URL /bot/message, got %s", r.URL.Path)
+		}
+
+		var req struct {
+			ChatID     int64       `json:"chat_id"`
+			Text       string      `json:"text"`
+			TextParsed []TextBlock `json:"text_parsed"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+
+		if req.Text != "Hello **world**" {
+			t.Errorf("Expected text 'Hello **world**', got '%s'", req.Text)
+		}
+		if len(req.TextParsed) != 2 || req.TextParsed[1].Type != BlockBold {
+			t.Errorf("Expected two parsed blocks, got %+v", req.TextParsed)
+		}
+
+		json.NewEncoder(w).Encode(MessageResponse{PostNo: 77})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+
+	response, err := client.SendRich(123, NewRichMessage().Text("Hello ").Bold("world"))
+	if err != nil {
+		t.Fatalf("SendRich should not return error: %v", err)
+	}
+	if response.PostNo != 77 {
+		t.Errorf("Expected PostNo 77, got %d", response.PostNo)
+	}
+
+	if _, err := client.SendRich(123, NewRichMessage()); err == nil {
+		t.Error("SendRich should return error for empty message")
+	}
+}
@@ -0,0 +1,115 @@
+package verbosity
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CommandHandler handles a bot command with its arguments.
+type CommandHandler func(req *BotRequest, args []string) error
+
+// ActionHandler handles an action button callback.
+type ActionHandler func(req *ActionRequest) error
+
+// Router dispatches incoming requests to command and action handlers.
+//
+// Messages starting with a mention of the bot are routed like commands,
+// so "@mybot deploy" is handled the same way as "/deploy".
+//
+// Use HandleMessage and HandleActionRequest as WebhookHandler callbacks:
+//
+//	handler.OnMessage = router.HandleMessage
+//	handler.OnAction = router.HandleActionRequest
+type Router struct {
+	// BotName is the unique name of the bot.
+	BotName string
+	// NotFound is called for messages without a matching command. It may be nil.
+	NotFound func(req *BotRequest) error
+	// ActionNotFound is called for unknown actions. It may be nil.
+	ActionNotFound func(req *ActionRequest) error
+
+	mu       sync.RWMutex
+	commands map[string]CommandHandler
+	actions  map[string]ActionHandler
+}
+
+// NewRouter creates a router for the bot with the given unique name.
+func NewRouter(botName string) *Router {
+	return &Router{
+		BotName:  botName,
+		commands: make(map[string]CommandHandler),
+		actions:  make(map[string]ActionHandler),
+	}
+}
+
+// Handle registers a handler for the command. The leading '/' is optional.
+func (r *Router) Handle(command string, handler CommandHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.commands[normalizeCommand(command)] = handler
+}
+
+// HandleAction registers a handler for the action.
+func (r *Router) HandleAction(action string, handler ActionHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.actions[action] = handler
+}
+
+// Commands returns the registered commands in sorted order.
+func (r *Router) Commands() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	commands := make([]string, 0, len(r.commands))
+	for command := range r.commands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// HandleMessage routes an incoming message to the command handler.
+func (r *Router) HandleMessage(req *BotRequest) error {
+	command, args := req.CommandFor(r.BotName)
+
+	r.mu.RLock()
+	handler, ok := r.commands[normalizeCommand(command)]
+	r.mu.RUnlock()
+
+	if command == "" || !ok {
+		if r.NotFound != nil {
+			return r.NotFound(req)
+		}
+		return nil
+	}
+
+	return handler(req, args)
+}
+
+// HandleActionRequest routes an action callback to the action handler.
+func (r *Router) HandleActionRequest(req *ActionRequest) error {
+	r.mu.RLock()
+	handler, ok := r.actions[req.Action]
+	r.mu.RUnlock()
+
+	if !ok {
+		if r.ActionNotFound != nil {
+			return r.ActionNotFound(req)
+		}
+		return nil
+	}
+
+	return handler(req)
+}
+
+func normalizeCommand(command string) string {
+	command = strings.ToLower(strings.TrimSpace(command))
+	if command == "" {
+		return ""
+	}
+	return "/" + strings.TrimPrefix(command, "/")
+}
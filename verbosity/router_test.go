@@ -0,0 +1,45 @@
+package verbosity
+
+import "testing"
+
+func TestRouter(t *testing.T) {
+	router := NewRouter("mybot")
+
+	var got []string
+	router.Handle("deploy", func(req *BotRequest, args []string) error {
+		got = append(got, "deploy:"+args[0])
+		return nil
+	})
+	router.HandleAction("approve", func(req *ActionRequest) error {
+		got = append(got, "approve:"+req.Params["id"])
+		return nil
+	})
+	router.NotFound = func(req *BotRequest) error {
+		got = append(got, "not found")
+		return nil
+	}
+
+	router.HandleMessage(&BotRequest{Text: "/Deploy prod"})
+	router.HandleMessage(&BotRequest{Text: "@mybot deploy stage"})
+	router.HandleMessage(&BotRequest{Text: "just chatting"})
+	router.HandleActionRequest(&ActionRequest{Action: "approve", Params: map[string]string{"id": "1"}})
+
+	if err := router.HandleActionRequest(&ActionRequest{Action: "unknown"}); err != nil {
+		t.Errorf("Unknown actions should be ignored, got %v", err)
+	}
+
+	expected := []string{"deploy:prod", "deploy:stage", "not found", "approve:1"}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, got)
+			break
+		}
+	}
+
+	if commands := router.Commands(); len(commands) != 1 || commands[0] != "/deploy" {
+		t.Errorf("Unexpected commands %v", commands)
+	}
+}
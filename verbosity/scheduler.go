@@ -0,0 +1,462 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const jobKeyPrefix = "job:"
+
+// maxMissedRuns bounds the catch-up of MissedRunAll jobs.
+const maxMissedRuns = 100
+
+// JobKind is the kind of a scheduled job.
+type JobKind string
+
+// Job kinds.
+const (
+	// JobMessage sends Text to ChatID.
+	JobMessage JobKind = "message"
+	// JobPrivateMessage sends Text to UserID as a private message.
+	JobPrivateMessage JobKind = "private_message"
+	// JobTemplate renders Template with Data and sends it to ChatID,
+	// or to UserID as a private message if ChatID is zero.
+	JobTemplate JobKind = "template"
+)
+
+// MissedRunPolicy defines what to do with runs missed while the scheduler
+// was not running.
+type MissedRunPolicy string
+
+// Missed run policies.
+const (
+	// MissedRunOnce runs the job once for all missed runs. It is the default.
+	MissedRunOnce MissedRunPolicy = "once"
+	// MissedSkip skips missed runs. Missed one-shot jobs are dropped.
+	MissedSkip MissedRunPolicy = "skip"
+	// MissedRunAll runs the job for every missed run, up to 100 times.
+	MissedRunAll MissedRunPolicy = "all"
+)
+
+// Job is a scheduled message.
+//
+// Exactly one of At, Cron and Interval must be set.
+type Job struct {
+	ID       string                 `json:"id"`
+	Kind     JobKind                `json:"kind"`
+	ChatID   int64                  `json:"chat_id,omitempty"`
+	UserID   int64                  `json:"user_id,omitempty"`
+	Text     string                 `json:"text,omitempty"`
+	Template string                 `json:"template,omitempty"`
+	Locale   string                 `json:"locale,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	// Owner is the user who created the job, if any.
+	Owner int64 `json:"owner,omitempty"`
+
+	// At is the time of a one-shot job.
+	At time.Time `json:"at,omitempty"`
+	// Cron is a cron expression of a recurring job, see ParseCron.
+	Cron string `json:"cron,omitempty"`
+	// Interval is the period of a recurring job.
+	Interval time.Duration `json:"interval,omitempty"`
+	// Missed is the policy for missed runs. Empty means MissedRunOnce.
+	Missed MissedRunPolicy `json:"missed,omitempty"`
+
+	Next      time.Time `json:"next"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Runs      int       `json:"runs,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// OneShot checks if the job runs only once.
+func (j *Job) OneShot() bool {
+	return j.Cron == "" && j.Interval == 0
+}
+
+// next returns the first run of a recurring job after t.
+func (j *Job) next(t time.Time) (time.Time, error) {
+	switch {
+	case j.Cron != "":
+		schedule, err := ParseCron(j.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return schedule.Next(t), nil
+	case j.Interval > 0:
+		next := j.Next
+		if next.IsZero() {
+			next = t
+		}
+		// Keep the phase of the interval
+		if !next.After(t) {
+			next = next.Add((t.Sub(next)/j.Interval + 1) * j.Interval)
+		}
+		return next, nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+// Scheduler sends delayed and recurring messages.
+//
+// Jobs are kept in the store; use a FileStore so they survive restarts.
+// Run catches up missed runs according to the job policy and then checks
+// for due jobs every interval:
+//
+//	store, _ := verbosity.NewFileStore("jobs.json")
+//	scheduler := verbosity.NewScheduler(client, store)
+//	scheduler.Schedule(verbosity.Job{Kind: verbosity.JobMessage, ChatID: 123, Text: "Standup", Cron: "0 10 * * mon-fri"})
+//	go scheduler.Run(ctx, time.Minute)
+type Scheduler struct {
+	// Location is used for cron expressions. Nil means time.Local.
+	Location *time.Location
+	// OnError is called when a job fails, with a nil job for store
+	// errors in Run. It may be nil.
+	OnError func(job *Job, err error)
+
+	client *Client
+	store  Store
+	now    func() time.Time
+
+	// mu serializes job changes. It is not held while messages are sent.
+	mu sync.Mutex
+	// running holds the IDs of jobs being run
+	running map[string]bool
+}
+
+// NewScheduler creates a scheduler that keeps jobs in the store.
+func NewScheduler(client *Client, store Store) *Scheduler {
+	return &Scheduler{
+		client:  client,
+		store:   store,
+		now:     time.Now,
+		running: make(map[string]bool),
+	}
+}
+
+// Schedule validates and stores a job. The job ID is generated if empty.
+func (s *Scheduler) Schedule(job Job) (*Job, error) {
+	if err := validateJob(&job); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.localNow()
+	if job.ID == "" {
+		job.ID = newID()
+	}
+	job.Created = now
+	job.Next = time.Time{}
+
+	if job.OneShot() {
+		job.Next = job.At
+	} else {
+		next, err := job.next(now)
+		if err != nil {
+			return nil, err
+		}
+		if next.IsZero() {
+			return nil, fmt.Errorf("cron expression %q never matches", job.Cron)
+		}
+		job.Next = next
+	}
+
+	if err := putJSON(s.store, jobKeyPrefix+job.ID, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// validateJob checks the job kind, target and schedule.
+func validateJob(job *Job) error {
+	switch job.Kind {
+	case JobMessage:
+		if job.ChatID == 0 || job.Text == "" {
+			return fmt.Errorf("message job requires chat_id and text")
+		}
+	case JobPrivateMessage:
+		if job.UserID == 0 || job.Text == "" {
+			return fmt.Errorf("private message job requires user_id and text")
+		}
+	case JobTemplate:
+		if job.Template == "" || (job.ChatID == 0 && job.UserID == 0) {
+			return fmt.Errorf("template job requires template and chat_id or user_id")
+		}
+	default:
+		return fmt.Errorf("unknown job kind '%s'", job.Kind)
+	}
+
+	schedules := 0
+	if !job.At.IsZero() {
+		schedules++
+	}
+	if job.Cron != "" {
+		schedules++
+		if _, err := ParseCron(job.Cron); err != nil {
+			return err
+		}
+	}
+	if job.Interval != 0 {
+		schedules++
+		if job.Interval < time.Second {
+			return fmt.Errorf("interval must be at least one second")
+		}
+	}
+	if schedules != 1 {
+		return fmt.Errorf("job requires exactly one of at, cron and interval")
+	}
+
+	switch job.Missed {
+	case "", MissedRunOnce, MissedSkip, MissedRunAll:
+	default:
+		return fmt.Errorf("unknown missed run policy '%s'", job.Missed)
+	}
+	return nil
+}
+
+// Get returns the stored job.
+func (s *Scheduler) Get(id string) (*Job, error) {
+	var job Job
+	if err := getJSON(s.store, jobKeyPrefix+id, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// List returns all jobs ordered by the next run.
+func (s *Scheduler) List() ([]*Job, error) {
+	keys, err := s.store.Keys(jobKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(keys))
+	for _, key := range keys {
+		var job Job
+		if err := getJSON(s.store, key, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Next.Before(jobs[j].Next)
+	})
+	return jobs, nil
+}
+
+// Cancel removes the job. ErrNotFound is returned for unknown jobs.
+func (s *Scheduler) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.store.Get(jobKeyPrefix + id); err != nil {
+		return err
+	}
+	return s.store.Delete(jobKeyPrefix + id)
+}
+
+// CatchUp handles runs missed while the scheduler was stopped according
+// to the policy of each job. Run calls it on start.
+func (s *Scheduler) CatchUp() error {
+	return s.runDue(true)
+}
+
+// missedRuns counts the runs of the job from its next run up to now.
+func (s *Scheduler) missedRuns(job *Job, now time.Time) int {
+	if job.OneShot() {
+		return 1
+	}
+
+	runs := 0
+	probe := *job
+	for !probe.Next.After(now) && runs < maxMissedRuns {
+		runs++
+		next, err := probe.next(s.in(probe.Next))
+		if err != nil || next.IsZero() {
+			break
+		}
+		probe.Next = next
+	}
+	return runs
+}
+
+// RunDue runs all jobs whose time has come.
+func (s *Scheduler) RunDue() error {
+	return s.runDue(false)
+}
+
+// runDue runs the due jobs, applying the missed run policy if catchUp is
+// set. The jobs are reserved under s.mu and sent without holding it, so
+// that a slow chat API does not block job changes or other runs.
+func (s *Scheduler) runDue(catchUp bool) error {
+	jobs, now, err := s.reserveDue()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		runs := 1
+		if catchUp {
+			switch job.Missed {
+			case MissedSkip:
+				runs = 0
+			case MissedRunAll:
+				runs = s.missedRuns(job, now)
+			}
+		}
+		for i := 0; i < runs; i++ {
+			s.execute(job)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, job := range jobs {
+		delete(s.running, job.ID)
+		// The job may have been canceled while it was running
+		if _, err := s.store.Get(jobKeyPrefix + job.ID); errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err := s.advance(job, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reserveDue returns the due jobs that are not already running and marks
+// them as running.
+func (s *Scheduler) reserveDue() ([]*Job, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs, err := s.dueJobs()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	reserved := jobs[:0]
+	for _, job := range jobs {
+		if !s.running[job.ID] {
+			s.running[job.ID] = true
+			reserved = append(reserved, job)
+		}
+	}
+	return reserved, s.localNow(), nil
+}
+
+// Run catches up missed runs and then runs due jobs every interval
+// until the context is canceled.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) error {
+	if err := s.CatchUp(); err != nil && s.OnError != nil {
+		s.OnError(nil, err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.RunDue(); err != nil && s.OnError != nil {
+				s.OnError(nil, err)
+			}
+		}
+	}
+}
+
+// dueJobs returns the jobs whose next run is not after now.
+func (s *Scheduler) dueJobs() ([]*Job, error) {
+	jobs, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.localNow()
+	due := jobs[:0]
+	for _, job := range jobs {
+		if !job.Next.IsZero() && !job.Next.After(now) {
+			due = append(due, job)
+		}
+	}
+	return due, nil
+}
+
+// execute sends the job message and records the result.
+func (s *Scheduler) execute(job *Job) {
+	err := s.send(job)
+
+	job.LastRun = s.localNow()
+	job.Runs++
+	job.LastError = ""
+	if err != nil {
+		job.LastError = err.Error()
+		if s.OnError != nil {
+			s.OnError(job, err)
+		}
+	}
+}
+
+// send delivers the job message.
+func (s *Scheduler) send(job *Job) error {
+	var err error
+	switch job.Kind {
+	case JobMessage:
+		_, err = s.client.SendMessage(job.ChatID, job.Text, nil)
+	case JobPrivateMessage:
+		_, err = s.client.SendPrivateMessageByID(job.UserID, job.Text, nil)
+	case JobTemplate:
+		if job.ChatID != 0 {
+			_, err = s.client.SendTemplate(job.ChatID, job.Template, job.Data, job.Locale)
+		} else {
+			_, err = s.client.SendPrivateTemplate(job.UserID, job.Template, job.Data, job.Locale)
+		}
+	default:
+		err = fmt.Errorf("unknown job kind '%s'", job.Kind)
+	}
+	return err
+}
+
+// advance schedules the next run of the job after now, or removes a
+// finished one-shot job. Failed one-shot jobs are removed too; the
+// failure is reported to OnError.
+func (s *Scheduler) advance(job *Job, now time.Time) error {
+	if job.OneShot() {
+		return s.store.Delete(jobKeyPrefix + job.ID)
+	}
+
+	next, err := job.next(now)
+	if err != nil {
+		return err
+	}
+	if next.IsZero() {
+		return s.store.Delete(jobKeyPrefix + job.ID)
+	}
+	job.Next = next
+	return putJSON(s.store, jobKeyPrefix+job.ID, job)
+}
+
+// localNow returns the current time in the scheduler location.
+func (s *Scheduler) localNow() time.Time {
+	return s.in(s.now())
+}
+
+// in converts the time to the scheduler location.
+func (s *Scheduler) in(t time.Time) time.Time {
+	if s.Location != nil {
+		return t.In(s.Location)
+	}
+	return t.Local()
+}
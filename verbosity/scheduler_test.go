@@ -0,0 +1,155 @@
+package verbosity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchedulerRunDue(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	scheduler := NewScheduler(client, NewMemoryStore())
+	scheduler.Location = time.UTC
+	scheduler.now = func() time.Time { return now }
+
+	once, err := scheduler.Schedule(Job{Kind: JobMessage, ChatID: 10, Text: "once", At: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("Schedule should not return error: %v", err)
+	}
+	every, err := scheduler.Schedule(Job{Kind: JobPrivateMessage, UserID: 7, Text: "every", Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("Schedule should not return error: %v", err)
+	}
+
+	if _, err := scheduler.Schedule(Job{Kind: JobMessage, ChatID: 10, Text: "bad", Cron: "* * * * *", Interval: time.Hour}); err == nil {
+		t.Error("Schedule should reject a job with two schedules")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := scheduler.RunDue(); err != nil {
+		t.Fatalf("RunDue should not return error: %v", err)
+	}
+	if len(chat.sent) != 1 || chat.sent[0] != "once" {
+		t.Errorf("Expected one-shot job to run, got %v", chat.sent)
+	}
+	if _, err := scheduler.Get(once.ID); err != ErrNotFound {
+		t.Errorf("One-shot job should be removed after the run, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	scheduler.RunDue()
+	if len(chat.sent) != 2 || chat.sent[1] != "every" {
+		t.Errorf("Expected interval job to run, got %v", chat.sent)
+	}
+
+	job, err := scheduler.Get(every.ID)
+	if err != nil {
+		t.Fatalf("Interval job should stay scheduled: %v", err)
+	}
+	if expected := every.Next.Add(time.Hour); !job.Next.Equal(expected) || job.Runs != 1 {
+		t.Errorf("Expected next run %v after one run, got %v (%d runs)", expected, job.Next, job.Runs)
+	}
+
+	if err := scheduler.Cancel(every.ID); err != nil {
+		t.Errorf("Cancel should not return error: %v", err)
+	}
+	if err := scheduler.Cancel(every.ID); err != ErrNotFound {
+		t.Errorf("Cancel of unknown job should return ErrNotFound, got %v", err)
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore should not return error: %v", err)
+	}
+	scheduler := NewScheduler(client, store)
+	scheduler.Location = time.UTC
+	scheduler.now = func() time.Time { return now }
+
+	scheduler.Schedule(Job{Kind: JobMessage, ChatID: 10, Text: "all", Cron: "0 * * * *", Missed: MissedRunAll})
+	scheduler.Schedule(Job{Kind: JobMessage, ChatID: 10, Text: "once", Cron: "0 * * * *"})
+	scheduler.Schedule(Job{Kind: JobMessage, ChatID: 10, Text: "skip", Cron: "0 * * * *", Missed: MissedSkip})
+
+	// Restart three hours later with the same file
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore should not return error: %v", err)
+	}
+	scheduler = NewScheduler(client, store)
+	scheduler.Location = time.UTC
+	now = now.Add(3*time.Hour + 30*time.Minute)
+	scheduler.now = func() time.Time { return now }
+
+	jobs, err := scheduler.List()
+	if err != nil || len(jobs) != 3 {
+		t.Fatalf("Expected 3 persisted jobs, got %d (%v)", len(jobs), err)
+	}
+
+	if err := scheduler.CatchUp(); err != nil {
+		t.Fatalf("CatchUp should not return error: %v", err)
+	}
+
+	counts := map[string]int{}
+	for _, text := range chat.sent {
+		counts[text]++
+	}
+	if counts["all"] != 3 || counts["once"] != 1 || counts["skip"] != 0 {
+		t.Errorf("Unexpected catch-up runs %v", counts)
+	}
+
+	jobs, _ = scheduler.List()
+	expected := time.Date(2024, 5, 1, 16, 0, 0, 0, time.UTC)
+	for _, job := range jobs {
+		if !job.Next.Equal(expected) {
+			t.Errorf("Expected job %s to run next at %v, got %v", job.Text, expected, job.Next)
+		}
+	}
+}
+
+func TestSchedulerCancelWhileSending(t *testing.T) {
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(sending)
+		<-release
+		json.NewEncoder(w).Encode(MessageResponse{PostNo: 1})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	scheduler := NewScheduler(client, NewMemoryStore())
+	scheduler.now = func() time.Time { return now }
+
+	job, err := scheduler.Schedule(Job{Kind: JobMessage, ChatID: 10, Text: "every", Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("Schedule should not return error: %v", err)
+	}
+	now = now.Add(time.Hour)
+
+	done := make(chan error)
+	go func() { done <- scheduler.RunDue() }()
+	<-sending
+
+	// Job changes are not blocked by the send
+	if err := scheduler.Cancel(job.ID); err != nil {
+		t.Errorf("Cancel should not return error: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("RunDue should not return error: %v", err)
+	}
+	if _, err := scheduler.Get(job.ID); err != ErrNotFound {
+		t.Errorf("Canceled job should not be rescheduled, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package verbosity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// signingKeyLength is the number of leading token characters forming the signing key.
+const signingKeyLength = 20
+
+// Verifier signs and verifies X-Signature headers of bot requests.
+//
+// It only needs the bot API token, so webhook servers can verify requests
+// without creating a full Client.
+type Verifier struct {
+	key []byte
+}
+
+// NewVerifier creates a Verifier from the bot API token.
+func NewVerifier(token string) (*Verifier, error) {
+	key, err := signingKey(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{key: key}, nil
+}
+
+// Sign returns the X-Signature value for the body.
+func (v *Verifier) Sign(body []byte) string {
+	h := hmac.New(sha256.New, v.key)
+	h.Write(body)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Verify reports whether the signature matches the body.
+// The comparison is done in constant time.
+func (v *Verifier) Verify(body []byte, signature string) bool {
+	expected := v.Sign(body)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// SignBody returns the X-Signature value of the body for the signing key,
+// the first 20 hex characters of the bot API token. A full token is accepted
+// as well. It is useful for tests and local webhook simulators.
+func SignBody(key string, body []byte) (string, error) {
+	verifier, err := NewVerifier(key)
+	if err != nil {
+		return "", err
+	}
+	return verifier.Sign(body), nil
+}
+
+// Verifier returns a Verifier for the client API token.
+func (c *Client) Verifier() (*Verifier, error) {
+	return NewVerifier(c.config.APIToken)
+}
+
+// signingKey converts the hex key at the start of the token to bytes.
+//
+//	bkey = to_bytes(int(key, 16))
+func signingKey(token string) ([]byte, error) {
+	if len(token) < signingKeyLength {
+		return nil, fmt.Errorf("API token is too short")
+	}
+
+	bkey, ok := new(big.Int).SetString(token[:signingKeyLength], 16)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse API token key")
+	}
+
+	return bkey.Bytes(), nil
+}
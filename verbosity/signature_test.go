@@ -0,0 +1,82 @@
+package verbosity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func TestSignBody(t *testing.T) {
+	body := []byte(`{"chat_id": 1, "text": "hello"}`)
+
+	// Key "0123456789abcdef0123" as an integer, without leading zero bytes
+	key := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23}
+	h := hmac.New(sha256.New, key)
+	h.Write(body)
+	expected := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	signature, err := SignBody(testWebhookToken[:signingKeyLength], body)
+	if err != nil {
+		t.Fatalf("SignBody should not return error: %v", err)
+	}
+	if signature != expected {
+		t.Errorf("Expected signature '%s', got '%s'", expected, signature)
+	}
+
+	if _, err := SignBody("short", body); err == nil {
+		t.Error("Expected error for an invalid key")
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	verifier, err := NewVerifier(testWebhookToken)
+	if err != nil {
+		t.Fatalf("NewVerifier should not return error: %v", err)
+	}
+
+	body := []byte(`{"chat_id": 1}`)
+	signature := verifier.Sign(body)
+
+	if !verifier.Verify(body, signature) {
+		t.Error("Expected signature to be valid")
+	}
+	if verifier.Verify([]byte(`{"chat_id": 2}`), signature) {
+		t.Error("Expected signature of another body to be invalid")
+	}
+	if verifier.Verify(body, "") {
+		t.Error("Expected empty signature to be invalid")
+	}
+
+	if _, err := NewVerifier("not_a_hex_token_at_all_123"); err == nil {
+		t.Error("Expected error for non-hex token")
+	}
+}
+
+func TestClientVerifySignatureBytes(t *testing.T) {
+	client := NewClient(&Config{APIToken: testWebhookToken})
+	body := []byte(`{"chat_id": 1}`)
+
+	valid, err := client.VerifySignatureBytes(body, signBody(t, body))
+	if err != nil {
+		t.Errorf("VerifySignatureBytes should not return error: %v", err)
+	}
+	if !valid {
+		t.Error("Expected signature to be valid")
+	}
+
+	valid, err = client.VerifySignature(string(body), signBody(t, body))
+	if err != nil || !valid {
+		t.Errorf("Expected VerifySignature to accept the signature, got %t, %v", valid, err)
+	}
+}
+
+// signBody signs the body with the test webhook token.
+func signBody(t *testing.T, body []byte) string {
+	t.Helper()
+	signature, err := SignBody(testWebhookToken, body)
+	if err != nil {
+		t.Fatalf("SignBody should not return error: %v", err)
+	}
+	return signature
+}
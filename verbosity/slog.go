@@ -0,0 +1,362 @@
+package verbosity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLogQueueSize is the default number of log records waiting to be sent.
+const DefaultLogQueueSize = 100
+
+// logLevelMarks are the marks of the log levels in messages.
+var logLevelMarks = map[slog.Level]string{
+	slog.LevelDebug: "⚪",
+	slog.LevelInfo:  "🔵",
+	slog.LevelWarn:  "🟡",
+	slog.LevelError: "🔴",
+}
+
+// LogRoute sends the matching records to a chat.
+type LogRoute struct {
+	// MinLevel is the minimum level of the records. It may be below
+	// LogHandlerOptions.Level.
+	MinLevel slog.Level
+	// Attr and Value select records with the attribute. An empty Attr
+	// matches any record; an empty Value matches any value of Attr.
+	// Attributes in groups are named "group.key".
+	Attr  string
+	Value string
+	// ChatID is the chat for the matching records.
+	ChatID int64
+}
+
+// LogHandlerOptions configures a LogHandler.
+type LogHandlerOptions struct {
+	// ChatID is the chat for the records that match no route.
+	// Zero drops them.
+	ChatID int64
+	// Level is the minimum level of the records that match no route,
+	// slog.LevelInfo if nil. Routes have their own MinLevel.
+	Level slog.Leveler
+	// Routes are checked in order; the first matching route wins.
+	Routes []LogRoute
+	// AddSource adds the source file and line to the messages.
+	AddSource bool
+	// DedupWindow suppresses identical records sent to the same chat within
+	// the window. The next message after the window tells how many were
+	// suppressed, or Close sends the count if the record does not recur.
+	// Zero disables deduplication.
+	DedupWindow time.Duration
+	// RatePerSecond limits the messages. Records over the limit are dropped
+	// and counted in the next message. Zero means no limit.
+	RatePerSecond float64
+	// QueueSize is the number of records waiting to be sent,
+	// DefaultLogQueueSize if zero. Records over it are dropped and counted
+	// in the next message.
+	QueueSize int
+	// Format formats the record, FormatLogRecord if nil.
+	Format func(record slog.Record, attrs []slog.Attr, source string) string
+	// OnError is called when a message cannot be sent. It may be nil.
+	OnError func(err error)
+}
+
+// LogHandler is a slog.Handler that sends log records to chats.
+//
+// Records are sent in the background, so a slow chat API does not block
+// logging. Call Close on shutdown to send the queued records.
+//
+//	handler := verbosity.NewLogHandler(client, &verbosity.LogHandlerOptions{
+//		ChatID: opsChatID,
+//		Level:  slog.LevelError,
+//	})
+//	defer handler.Close(context.Background())
+//	logger := slog.New(handler)
+type LogHandler struct {
+	client *Client
+	opts   LogHandlerOptions
+	state  *logState
+	attrs  []slog.Attr
+	groups []string
+}
+
+// logState is shared by a handler and the handlers derived from it.
+type logState struct {
+	limiter *rateLimiter
+	queue   *Dispatcher
+	now     func() time.Time
+
+	mu      sync.Mutex
+	seen    map[string]*logSeen
+	dropped int
+}
+
+// logSeen tracks a record for deduplication.
+type logSeen struct {
+	chatID     int64
+	text       string
+	sent       time.Time
+	suppressed int
+}
+
+// NewLogHandler creates a handler sending log records to chats.
+func NewLogHandler(client *Client, opts *LogHandlerOptions) *LogHandler {
+	h := &LogHandler{client: client}
+	if opts != nil {
+		h.opts = *opts
+	}
+	queueSize := h.opts.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultLogQueueSize
+	}
+	h.state = &logState{
+		limiter: newRateLimiter(h.opts.RatePerSecond),
+		queue:   NewDispatcher(1, queueSize, OverflowReject),
+		now:     time.Now,
+		seen:    make(map[string]*logSeen),
+	}
+	h.state.queue.OnError = h.opts.OnError
+	return h
+}
+
+// Close sends the counts of the suppressed duplicates that did not recur,
+// stops accepting records and waits until the queued ones are sent or the
+// context is done. It closes the handlers derived from h as well.
+func (h *LogHandler) Close(ctx context.Context) error {
+	for _, seen := range h.state.suppressed() {
+		text := seen.text + "\n" + repeatedNote(seen.suppressed)
+		h.submit(seen.chatID, text)
+	}
+	return h.state.queue.Close(ctx)
+}
+
+// Enabled reports whether the handler handles records at the level:
+// the level is at least Level or the MinLevel of a route.
+func (h *LogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	min := h.level()
+	for _, route := range h.opts.Routes {
+		if route.ChatID != 0 && route.MinLevel < min {
+			min = route.MinLevel
+		}
+	}
+	return level >= min
+}
+
+// level returns the minimum level of the records that match no route.
+func (h *LogHandler) level() slog.Level {
+	if h.opts.Level != nil {
+		return h.opts.Level.Level()
+	}
+	return slog.LevelInfo
+}
+
+// WithAttrs returns a handler that adds the attributes to the records.
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := *h
+	derived.attrs = append(append([]slog.Attr(nil), h.attrs...), qualifyAttrs(h.groups, attrs)...)
+	return &derived
+}
+
+// WithGroup returns a handler that puts the following attributes in the group.
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	derived := *h
+	derived.groups = append(append([]string(nil), h.groups...), name)
+	return &derived
+}
+
+// Handle queues the record for the chat of the first matching route.
+// It returns an error only after Close.
+func (h *LogHandler) Handle(_ context.Context, record slog.Record) error {
+	attrs := append([]slog.Attr(nil), h.attrs...)
+	var recordAttrs []slog.Attr
+	record.Attrs(func(attr slog.Attr) bool {
+		recordAttrs = append(recordAttrs, attr)
+		return true
+	})
+	attrs = append(attrs, qualifyAttrs(h.groups, recordAttrs)...)
+
+	chatID := h.route(record.Level, attrs)
+	if chatID == 0 {
+		return nil
+	}
+
+	var source string
+	if h.opts.AddSource && record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		source = fmt.Sprintf("%s:%d", frame.File, frame.Line)
+	}
+
+	format := h.opts.Format
+	if format == nil {
+		format = FormatLogRecord
+	}
+	text := format(record, attrs, source)
+
+	notes, ok := h.state.admit(chatID, fmt.Sprintf("%d\x00%s\x00%s", chatID, record.Level, text), text, h.opts.DedupWindow)
+	if !ok {
+		return nil
+	}
+	if notes != "" {
+		text += "\n" + notes
+	}
+	return h.submit(chatID, text)
+}
+
+// submit queues the message. A message over the queue size is dropped
+// and counted.
+func (h *LogHandler) submit(chatID int64, text string) error {
+	err := h.state.queue.Submit(chatID, func() error {
+		if _, err := h.client.SendMessage(chatID, text, nil); err != nil {
+			return fmt.Errorf("failed to send log record: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrQueueFull) {
+		h.state.drop()
+		return nil
+	}
+	return err
+}
+
+// route returns the chat of the record.
+func (h *LogHandler) route(level slog.Level, attrs []slog.Attr) int64 {
+	for _, route := range h.opts.Routes {
+		if level < route.MinLevel || route.ChatID == 0 {
+			continue
+		}
+		if route.Attr == "" {
+			return route.ChatID
+		}
+		for _, attr := range attrs {
+			if attr.Key == route.Attr && (route.Value == "" || attr.Value.String() == route.Value) {
+				return route.ChatID
+			}
+		}
+	}
+	if level < h.level() {
+		return 0
+	}
+	return h.opts.ChatID
+}
+
+// admit applies deduplication and the rate limit to the record with the key.
+// It returns the notes about suppressed and dropped records to add to the message.
+func (s *logState) admit(chatID int64, key, text string, window time.Duration) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var seen *logSeen
+	if window > 0 {
+		seen = s.seen[key]
+		if seen != nil && now.Sub(seen.sent) < window {
+			seen.suppressed++
+			return "", false
+		}
+		if len(s.seen) >= 1000 {
+			for k, v := range s.seen {
+				if now.Sub(v.sent) >= window {
+					delete(s.seen, k)
+				}
+			}
+		}
+	}
+
+	if !s.limiter.Allow() {
+		s.dropped++
+		return "", false
+	}
+
+	var notes []string
+	if seen != nil && seen.suppressed > 0 {
+		notes = append(notes, repeatedNote(seen.suppressed))
+	}
+	if s.dropped > 0 {
+		notes = append(notes, fmt.Sprintf("(%d %s dropped by the rate limit or a full queue)", s.dropped, PluralEn(s.dropped, "record", "records")))
+		s.dropped = 0
+	}
+	if window > 0 {
+		s.seen[key] = &logSeen{chatID: chatID, text: text, sent: now}
+	}
+	return strings.Join(notes, "\n"), true
+}
+
+// suppressed returns the records with suppressed duplicates and resets
+// their counts.
+func (s *logState) suppressed() []logSeen {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []logSeen
+	for _, seen := range s.seen {
+		if seen.suppressed > 0 {
+			result = append(result, *seen)
+			seen.suppressed = 0
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].sent.Before(result[j].sent) })
+	return result
+}
+
+// repeatedNote tells how many duplicates of a record were suppressed.
+func repeatedNote(n int) string {
+	return fmt.Sprintf("(repeated %d more %s)", n, PluralEn(n, "time", "times"))
+}
+
+// drop counts a record dropped because the queue is full.
+func (s *logState) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped++
+}
+
+// FormatLogRecord formats a log record as a message: the level, the
+// message, an attribute per line and the source.
+func FormatLogRecord(record slog.Record, attrs []slog.Attr, source string) string {
+	var b strings.Builder
+	mark := logLevelMarks[record.Level]
+	if mark == "" {
+		mark = "⚫"
+	}
+	fmt.Fprintf(&b, "%s **%s** %s", mark, record.Level, record.Message)
+	for _, attr := range attrs {
+		fmt.Fprintf(&b, "\n`%s`: %s", attr.Key, attr.Value)
+	}
+	if source != "" {
+		fmt.Fprintf(&b, "\n`source`: %s", source)
+	}
+	return b.String()
+}
+
+// qualifyAttrs flattens the attributes, prefixing the keys with the groups.
+func qualifyAttrs(groups []string, attrs []slog.Attr) []slog.Attr {
+	var flat []slog.Attr
+	for _, attr := range attrs {
+		attr.Value = attr.Value.Resolve()
+		if attr.Equal(slog.Attr{}) {
+			continue
+		}
+		if attr.Value.Kind() == slog.KindGroup {
+			prefix := groups
+			if attr.Key != "" {
+				prefix = append(append([]string(nil), groups...), attr.Key)
+			}
+			flat = append(flat, qualifyAttrs(prefix, attr.Value.Group())...)
+			continue
+		}
+		if len(groups) > 0 {
+			attr.Key = strings.Join(groups, ".") + "." + attr.Key
+		}
+		flat = append(flat, attr)
+	}
+	return flat
+}
@@ -0,0 +1,159 @@
+package verbosity
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogHandler(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	handler := NewLogHandler(client, &LogHandlerOptions{
+		ChatID: 10,
+		Level:  slog.LevelWarn,
+		Routes: []LogRoute{
+			{Attr: "component", Value: "billing", ChatID: 20},
+			{MinLevel: slog.LevelError, ChatID: 30},
+		},
+		DedupWindow: time.Minute,
+	})
+	handler.state.now = func() time.Time { return now }
+	logger := slog.New(handler)
+
+	logger.Info("ignored")
+	logger.Warn("disk is almost full", "free", "5%")
+	logger.With("component", "billing").Error("payment failed", slog.Group("order", "id", 42))
+	logger.Error("database is down")
+	logger.Error("database is down")
+	logger.Error("database is down")
+	waitLogged(t, chat, 3)
+
+	expected := []int64{10, 20, 30}
+	if len(chat.targets) != 3 || chat.targets[0] != 10 || chat.targets[1] != 20 || chat.targets[2] != 30 {
+		t.Fatalf("Expected messages to chats %v, got %v %q", expected, chat.targets, chat.sent)
+	}
+	if chat.sent[0] != "🟡 **WARN** disk is almost full\n`free`: 5%" {
+		t.Errorf("Unexpected message %q", chat.sent[0])
+	}
+	if chat.sent[1] != "🔴 **ERROR** payment failed\n`component`: billing\n`order.id`: 42" {
+		t.Errorf("Unexpected message %q", chat.sent[1])
+	}
+
+	now = now.Add(time.Minute)
+	logger.Error("database is down")
+	if err := handler.Close(context.Background()); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+	if last := chat.sent[len(chat.sent)-1]; !strings.HasSuffix(last, "(repeated 2 more times)") {
+		t.Errorf("Expected the suppressed count after the window, got %q", last)
+	}
+}
+
+func TestLogHandlerRouteBelowLevel(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	handler := NewLogHandler(client, &LogHandlerOptions{
+		ChatID:      10,
+		Level:       slog.LevelError,
+		Routes:      []LogRoute{{MinLevel: slog.LevelDebug, Attr: "component", Value: "auth", ChatID: 20}},
+		DedupWindow: time.Minute,
+	})
+	logger := slog.New(handler)
+
+	logger.Debug("token refreshed", "component", "auth")
+	logger.Info("cache warmed")
+	logger.Error("database is down")
+	logger.Error("database is down")
+	logger.Error("database is down")
+	if err := handler.Close(context.Background()); err != nil {
+		t.Fatalf("Close should not return error: %v", err)
+	}
+
+	if len(chat.targets) != 3 || chat.targets[0] != 20 || chat.targets[1] != 10 || chat.targets[2] != 10 {
+		t.Fatalf("Expected the debug record in chat 20 and the errors in chat 10, got %v %q", chat.targets, chat.sent)
+	}
+	if last := chat.sent[2]; !strings.HasPrefix(last, "🔴 **ERROR** database is down") || !strings.HasSuffix(last, "(repeated 2 more times)") {
+		t.Errorf("Expected the suppressed count on Close, got %q", last)
+	}
+}
+
+func TestLogHandlerRateLimit(t *testing.T) {
+	chat, client := newFakeChat(t)
+
+	handler := NewLogHandler(client, &LogHandlerOptions{ChatID: 10, RatePerSecond: 0.001, AddSource: true})
+	logger := slog.New(handler)
+	logger.Info("first")
+	logger.Info("second")
+	logger.Info("third")
+	handler.Close(context.Background())
+
+	if len(chat.sent) != 1 || !strings.Contains(chat.sent[0], "`source`: ") || !strings.Contains(chat.sent[0], "slog_test.go:") {
+		t.Fatalf("Expected a single message with the source, got %q", chat.sent)
+	}
+	if state := logger.Handler().(*LogHandler).state; state.dropped != 2 {
+		t.Errorf("Expected 2 dropped records, got %d", state.dropped)
+	}
+}
+
+func TestLogHandlerDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(MessageResponse{PostNo: 1})
+	}))
+	defer server.Close()
+	defer close(release)
+	client := NewClient(&Config{APIURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+
+	handler := NewLogHandler(client, &LogHandlerOptions{ChatID: 10, QueueSize: 2})
+	logger := slog.New(handler)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			logger.Error("database is down", "attempt", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Logging should not wait for the chat API")
+	}
+
+	handler.state.mu.Lock()
+	dropped := handler.state.dropped
+	handler.state.mu.Unlock()
+	if dropped == 0 {
+		t.Error("Records over the queue size should be dropped")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := handler.Close(ctx); err == nil {
+		t.Error("Close should stop waiting when the context is done")
+	}
+}
+
+// waitLogged waits until the chat has received n messages.
+func waitLogged(t *testing.T, chat *fakeChat, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		chat.mu.Lock()
+		sent := len(chat.sent)
+		chat.mu.Unlock()
+		if sent >= n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d messages", n)
+}
@@ -0,0 +1,297 @@
+package verbosity
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxMessageLength is the maximum message length in characters used
+// when Config.MaxMessageLength is zero.
+const DefaultMaxMessageLength = 4000
+
+// maxMessageLength returns the configured maximum length, or 0 if splitting is disabled.
+func (c *Client) maxMessageLength() int {
+	switch {
+	case c.config.MaxMessageLength < 0:
+		return 0
+	case c.config.MaxMessageLength == 0:
+		return DefaultMaxMessageLength
+	default:
+		return c.config.MaxMessageLength
+	}
+}
+
+// splitLine is a line of text with the code fence opened after it, if any.
+type splitLine struct {
+	text  string
+	fence string
+}
+
+// SplitMessage splits text into parts of at most maxLength characters.
+// Blank parts are dropped.
+//
+// Parts are split at paragraph boundaries when possible, then at line
+// boundaries, and only then inside a line. Code fences are kept balanced:
+// a code block cut between parts is closed at the end of one part and
+// reopened at the start of the next one. If maxLength is too small to
+// reopen a code block, the part is cut without balancing the fences.
+func SplitMessage(text string, maxLength int) []string {
+	if maxLength <= 0 || utf8.RuneCountInString(text) <= maxLength {
+		return []string{text}
+	}
+
+	var parts []string
+	var current []splitLine
+	fence := ""
+
+	flush := func(keep int) {
+		part := current[:keep]
+		rest := current[keep:]
+
+		parts = appendSplitPart(parts, renderSplitPart(part), maxLength)
+
+		next := []splitLine{}
+		if opener := part[len(part)-1].fence; opener != "" {
+			next = append(next, splitLine{text: opener, fence: opener})
+		} else {
+			// Blank lines at a part boundary are dropped
+			for len(rest) > 0 && strings.TrimSpace(rest[0].text) == "" {
+				rest = rest[1:]
+			}
+		}
+		current = append(next, rest...)
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		for _, piece := range splitLongLine(line, maxLength-fenceOverhead(fence)) {
+			fence = nextFence(fence, piece)
+			current = append(current, splitLine{text: piece, fence: fence})
+
+			for len(current) > 1 && splitPartLength(current) > maxLength {
+				before := len(current)
+				flush(chooseSplit(current, maxLength))
+				if len(current) >= before {
+					// The reopened fence alone does not leave room for the line
+					break
+				}
+			}
+		}
+	}
+
+	if len(current) > 0 {
+		parts = appendSplitPart(parts, renderSplitPart(current), maxLength)
+	}
+
+	return parts
+}
+
+// appendSplitPart appends a non-blank part, cutting it if the code fences
+// made it longer than maxLength.
+func appendSplitPart(parts []string, part string, maxLength int) []string {
+	if strings.TrimSpace(part) == "" {
+		return parts
+	}
+	if utf8.RuneCountInString(part) <= maxLength {
+		return append(parts, part)
+	}
+	for _, piece := range splitLongLine(part, maxLength) {
+		if strings.TrimSpace(piece) != "" {
+			parts = append(parts, piece)
+		}
+	}
+	return parts
+}
+
+// truncateMessage cuts text to at most maxLength characters, keeping the
+// code fences balanced and marking the cut with an ellipsis.
+func truncateMessage(text string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+	const marker = "\n…"
+	if maxLength <= len([]rune(marker)) {
+		return string([]rune(text)[:maxLength])
+	}
+	parts := SplitMessage(text, maxLength-len([]rune(marker)))
+	if len(parts) == 0 {
+		return string([]rune(text)[:maxLength])
+	}
+	return parts[0] + marker
+}
+
+// chooseSplit returns the number of lines to keep in the current part.
+func chooseSplit(lines []splitLine, maxLength int) int {
+	fits := 0
+	closed := 0
+	paragraph := 0
+	for keep := 1; keep < len(lines); keep++ {
+		if splitPartLength(lines[:keep]) > maxLength {
+			break
+		}
+		fits = keep
+		if lines[keep-1].fence == "" {
+			closed = keep
+			if strings.TrimSpace(lines[keep-1].text) == "" {
+				paragraph = keep
+			}
+		}
+	}
+
+	// Prefer a paragraph break, then a break outside of a code block,
+	// unless it leaves the part less than half full
+	if paragraph > 0 && splitPartLength(lines[:paragraph]) >= maxLength/2 {
+		return paragraph
+	}
+	if closed > 0 && splitPartLength(lines[:closed]) >= maxLength/2 {
+		return closed
+	}
+	if fits > 0 {
+		return fits
+	}
+	return 1
+}
+
+// splitPartLength returns the rendered length of the lines in characters.
+func splitPartLength(lines []splitLine) int {
+	return utf8.RuneCountInString(renderSplitPart(lines))
+}
+
+// renderSplitPart joins the lines and closes an unterminated code fence.
+func renderSplitPart(lines []splitLine) string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.text
+	}
+	part := strings.TrimRight(strings.Join(texts, "\n"), "\n")
+	if opener := lines[len(lines)-1].fence; opener != "" {
+		part += "\n" + opener[:3]
+	}
+	return part
+}
+
+// splitLongLine cuts a line into pieces of at most limit characters,
+// preferring to cut at spaces.
+func splitLongLine(line string, limit int) []string {
+	if limit < 1 {
+		limit = 1
+	}
+
+	var pieces []string
+	runes := []rune(line)
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		pieces = append(pieces, strings.TrimRight(string(runes[:cut]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(pieces, string(runes))
+}
+
+// nextFence returns the code fence state after the line.
+func nextFence(fence, line string) string {
+	trimmed := strings.TrimSpace(line)
+	if fence == "" {
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			return trimmed
+		}
+		return ""
+	}
+	if strings.HasPrefix(trimmed, fence[:3]) {
+		return ""
+	}
+	return fence
+}
+
+// fenceOverhead returns the characters needed to reopen and close the fence.
+func fenceOverhead(fence string) int {
+	if fence == "" {
+		return 0
+	}
+	return utf8.RuneCountInString(fence) + 1 + 4
+}
+
+// SplitRichMessage splits a rich message into messages whose plain text
+// is at most maxLength characters. Blocks are kept whole when possible;
+// a text, formatted, quote or code block longer than maxLength is split
+// into several blocks of the same type.
+func SplitRichMessage(msg *RichMessage, maxLength int) []*RichMessage {
+	if msg == nil || maxLength <= 0 || utf8.RuneCountInString(msg.String()) <= maxLength {
+		return []*RichMessage{msg}
+	}
+
+	var parts []*RichMessage
+	current := NewRichMessage()
+	for _, block := range msg.blocks {
+		for _, piece := range splitBlock(block, maxLength) {
+			candidate := &RichMessage{blocks: append(append([]TextBlock(nil), current.blocks...), piece)}
+			if len(current.blocks) > 0 && utf8.RuneCountInString(candidate.String()) > maxLength {
+				parts = append(parts, current)
+				candidate = NewRichMessage().add(piece)
+			}
+			current = candidate
+		}
+	}
+	if len(current.blocks) > 0 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// splitBlock splits a block whose rendering is longer than maxLength.
+func splitBlock(block TextBlock, maxLength int) []TextBlock {
+	length := utf8.RuneCountInString(NewRichMessage().add(block).String())
+	if length <= maxLength {
+		return []TextBlock{block}
+	}
+	switch block.Type {
+	case BlockText, BlockBold, BlockItalic, BlockCode, BlockCodeBlock, BlockQuote:
+	default:
+		return []TextBlock{block}
+	}
+
+	overhead := length - utf8.RuneCountInString(block.Value)
+	if maxLength-overhead <= 0 {
+		return []TextBlock{block}
+	}
+	var pieces []TextBlock
+	for _, value := range SplitMessage(block.Value, maxLength-overhead) {
+		piece := block
+		piece.Value = value
+		pieces = append(pieces, piece)
+	}
+	return pieces
+}
+
+// splitParsed splits a message with text_parsed into parts of at most
+// maxLength characters. It returns a single part if the payload is not
+// made of TextBlock values.
+func splitParsed(text string, parsed []interface{}, maxLength int) ([]string, [][]interface{}) {
+	whole := func() ([]string, [][]interface{}) {
+		return []string{text}, [][]interface{}{parsed}
+	}
+	if maxLength <= 0 || utf8.RuneCountInString(text) <= maxLength {
+		return whole()
+	}
+
+	msg := NewRichMessage()
+	for _, item := range parsed {
+		block, ok := item.(TextBlock)
+		if !ok {
+			return whole()
+		}
+		msg.add(block)
+	}
+
+	var texts []string
+	var parts [][]interface{}
+	for _, part := range SplitRichMessage(msg, maxLength) {
+		texts = append(texts, part.String())
+		parts = append(parts, part.TextParsed())
+	}
+	return texts, parts
+}
@@ -0,0 +1,231 @@
+package verbosity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessageShortText(t *testing.T) {
+	parts := SplitMessage("short text", 100)
+	if len(parts) != 1 || parts[0] != "short text" {
+		t.Errorf("Expected text to stay intact, got %q", parts)
+	}
+}
+
+func TestSplitMessagePrefersParagraphs(t *testing.T) {
+	text := strings.Repeat("a", 30) + "\n" + strings.Repeat("b", 30) + "\n\n" +
+		strings.Repeat("c", 30) + "\n" + strings.Repeat("d", 30)
+
+	parts := SplitMessage(text, 80)
+	if len(parts) != 2 {
+		t.Fatalf("Expected 2 parts, got %d: %q", len(parts), parts)
+	}
+	if parts[0] != strings.Repeat("a", 30)+"\n"+strings.Repeat("b", 30) {
+		t.Errorf("Expected first paragraph in the first part, got %q", parts[0])
+	}
+	if !strings.HasPrefix(parts[1], "ccc") {
+		t.Errorf("Expected second paragraph in the second part, got %q", parts[1])
+	}
+}
+
+func TestSplitMessageKeepsCodeFencesBalanced(t *testing.T) {
+	var lines []string
+	lines = append(lines, "Test output:", "```text")
+	for i := 0; i < 20; i++ {
+		lines = append(lines, "line of test output number")
+	}
+	lines = append(lines, "```", "Done")
+	text := strings.Join(lines, "\n")
+
+	parts := SplitMessage(text, 120)
+	if len(parts) < 2 {
+		t.Fatalf("Expected several parts, got %d", len(parts))
+	}
+
+	for i, part := range parts {
+		if n := utf8.RuneCountInString(part); n > 120 {
+			t.Errorf("Part %d is %d characters long", i, n)
+		}
+		if strings.Count(part, "```")%2 != 0 {
+			t.Errorf("Part %d has unbalanced code fences: %q", i, part)
+		}
+	}
+	if !strings.HasPrefix(parts[1], "```text\n") {
+		t.Errorf("Expected second part to reopen the code block, got %q", parts[1])
+	}
+}
+
+func TestSplitMessageLongLine(t *testing.T) {
+	text := strings.Repeat("word ", 50)
+
+	parts := SplitMessage(text, 40)
+	for i, part := range parts {
+		if n := utf8.RuneCountInString(part); n > 40 {
+			t.Errorf("Part %d is %d characters long", i, n)
+		}
+	}
+	if joined := strings.Join(parts, " "); strings.Fields(joined)[49] != "word" || len(strings.Fields(joined)) != 50 {
+		t.Errorf("Expected all words to be kept, got %q", parts)
+	}
+}
+
+func TestSendMessageSplitsLongText(t *testing.T) {
+	var requests []SendMessageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SendMessageRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		json.NewEncoder(w).Encode(MessageResponse{PostNo: int64(100 + len(requests))})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{
+		APIURL:           server.URL,
+		APIToken:         "test_token_1234567890123456789012",
+		MaxMessageLength: 50,
+	})
+
+	text := strings.Repeat("first paragraph ", 3) + "\n\n" + strings.Repeat("second paragraph ", 3)
+	response, err := client.SendMessage(123, text, nil)
+	if err != nil {
+		t.Fatalf("SendMessage should not return error: %v", err)
+	}
+
+	if len(response.PostNos) != len(requests) || len(requests) < 2 {
+		t.Fatalf("Expected post numbers of all %d parts, got %v", len(requests), response.PostNos)
+	}
+	if response.PostNo != 101 {
+		t.Errorf("Expected PostNo of the first part, got %d", response.PostNo)
+	}
+	for _, req := range requests[1:] {
+		if req.ReplyNo == nil || *req.ReplyNo != 101 {
+			t.Errorf("Expected parts to reply to the first post, got %v", req.ReplyNo)
+		}
+	}
+}
+
+func TestSplitMessageDropsBlankParts(t *testing.T) {
+	parts := SplitMessage("\n"+strings.Repeat("w", 4500), 4000)
+	if len(parts) != 2 {
+		t.Fatalf("Expected 2 parts, got %d", len(parts))
+	}
+	for i, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			t.Errorf("Part %d is blank", i)
+		}
+	}
+}
+
+func TestSplitMessageRespectsSmallLimits(t *testing.T) {
+	text := "```golang\n" + strings.Repeat("line of code\n", 5) + "```"
+
+	for _, limit := range []int{5, 10, 16} {
+		parts := SplitMessage(text, limit)
+		if len(parts) == 0 {
+			t.Errorf("Expected parts for limit %d", limit)
+		}
+		for i, part := range parts {
+			if n := utf8.RuneCountInString(part); n > limit {
+				t.Errorf("Part %d is %d characters long with limit %d: %q", i, n, limit, part)
+			}
+		}
+	}
+}
+
+func TestUpdateMessageSplitsLongText(t *testing.T) {
+	var updates []UpdateMessageRequest
+	var replies []SendMessageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			var req SendMessageRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			replies = append(replies, req)
+			json.NewEncoder(w).Encode(MessageResponse{PostNo: int64(100 + len(replies))})
+			return
+		}
+		var req UpdateMessageRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		updates = append(updates, req)
+		json.NewEncoder(w).Encode(UpdateMessageResponse{})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{
+		APIURL:           server.URL,
+		APIToken:         "test_token_1234567890123456789012",
+		MaxMessageLength: 50,
+	})
+
+	text := "```\n" + strings.Repeat("output line\n", 10) + "```"
+	response, err := client.UpdateMessage(123, 100, &UpdateMessageRequest{Text: text})
+	if err != nil {
+		t.Fatalf("UpdateMessage should not return error: %v", err)
+	}
+	if len(response.PostNos) < 2 || response.PostNos[0] != 100 || len(replies) != len(response.PostNos)-1 {
+		t.Fatalf("Expected the rest sent as replies, got %v", response.PostNos)
+	}
+	for _, reply := range replies {
+		if reply.ReplyNo == nil || *reply.ReplyNo != 100 {
+			t.Errorf("Expected a reply to the updated post, got %+v", reply)
+		}
+	}
+	if got := strings.Count(updates[0].Text, "output line"); got+len(replies) < 4 {
+		t.Errorf("Expected no text lost, got %q", updates[0].Text)
+	}
+
+	// Posts edited repeatedly are truncated instead
+	updates, replies = nil, nil
+	if _, err := client.editMessage(123, 100, text); err != nil {
+		t.Fatalf("editMessage should not return error: %v", err)
+	}
+	if len(replies) != 0 {
+		t.Errorf("Expected no replies for an edit, got %d", len(replies))
+	}
+	edited := updates[0].Text
+	if utf8.RuneCountInString(edited) > 50 || !strings.HasSuffix(edited, "```\n…") {
+		t.Errorf("Expected the text truncated with balanced fences, got %q", edited)
+	}
+}
+
+func TestSendRichSplitsLongMessage(t *testing.T) {
+	var requests []SendMessageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SendMessageRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		json.NewEncoder(w).Encode(MessageResponse{PostNo: int64(len(requests))})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{
+		APIURL:           server.URL,
+		APIToken:         "test_token_1234567890123456789012",
+		MaxMessageLength: 40,
+	})
+
+	msg := NewRichMessage().Bold("Report").Line("").Text(strings.Repeat("all systems are fine\n", 4)).Code("done")
+	response, err := client.SendRich(10, msg)
+	if err != nil {
+		t.Fatalf("SendRich should not return error: %v", err)
+	}
+	if len(requests) < 2 || len(response.PostNos) != len(requests) {
+		t.Fatalf("Expected the rich message split, got %d posts", len(requests))
+	}
+	var text string
+	for i, req := range requests {
+		if utf8.RuneCountInString(req.Text) > 40 || len(req.TextParsed) == 0 {
+			t.Errorf("Unexpected part %d: %q with %d blocks", i, req.Text, len(req.TextParsed))
+		}
+		if i > 0 && (req.ReplyNo == nil || *req.ReplyNo != 1) {
+			t.Errorf("Expected part %d to reply to the first post", i)
+		}
+		text += req.Text
+	}
+	if !strings.HasPrefix(text, "**Report**") || !strings.HasSuffix(text, "`done`") || strings.Count(text, "fine") != 4 {
+		t.Errorf("Expected all blocks sent, got %q", text)
+	}
+}
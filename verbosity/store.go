@@ -0,0 +1,116 @@
+package verbosity
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store when the key does not exist.
+var ErrNotFound = errors.New("key not found")
+
+// Store is a key-value storage for the state of bot components
+// such as menus, approvals and polls.
+//
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the value of the key or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// Put stores the value under the key.
+	Put(key string, value []byte) error
+	// Delete removes the key. Deleting a missing key is not an error.
+	Delete(key string) error
+	// Keys returns all keys with the prefix in sorted order.
+	Keys(prefix string) ([]string, error)
+}
+
+// MemoryStore is an in-process Store.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+// Get returns the value of the key or ErrNotFound.
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// Put stores the value under the key.
+func (s *MemoryStore) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete removes the key.
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data, key)
+	return nil
+}
+
+// Keys returns all keys with the prefix in sorted order.
+func (s *MemoryStore) Keys(prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	for key := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// getJSON loads a JSON value from the store.
+func getJSON(store Store, key string, v interface{}) error {
+	data, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return nil
+}
+
+// putJSON saves a JSON value to the store.
+func putJSON(store Store, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	return store.Put(key, data)
+}
+
+// newID returns a random identifier.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("verbosity: failed to generate id: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
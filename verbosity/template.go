@@ -0,0 +1,398 @@
+package verbosity
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// localePattern matches a two-letter language code with an optional region,
+// e.g. "ru" or "pt-BR".
+var localePattern = regexp.MustCompile(`^([a-zA-Z]{2})([-_]([a-zA-Z]{2}|[0-9]{3}))?$`)
+
+// languageCodes are the ISO 639-1 language codes accepted as template locales.
+var languageCodes = map[string]bool{
+	"aa": true, "ab": true, "ae": true, "af": true, "ak": true, "am": true,
+	"an": true, "ar": true, "as": true, "av": true, "ay": true, "az": true,
+	"ba": true, "be": true, "bg": true, "bi": true, "bm": true, "bn": true,
+	"bo": true, "br": true, "bs": true, "ca": true, "ce": true, "ch": true,
+	"co": true, "cr": true, "cs": true, "cu": true, "cv": true, "cy": true,
+	"da": true, "de": true, "dv": true, "dz": true, "ee": true, "el": true,
+	"en": true, "eo": true, "es": true, "et": true, "eu": true, "fa": true,
+	"ff": true, "fi": true, "fj": true, "fo": true, "fr": true, "fy": true,
+	"ga": true, "gd": true, "gl": true, "gn": true, "gu": true, "gv": true,
+	"ha": true, "he": true, "hi": true, "ho": true, "hr": true, "ht": true,
+	"hu": true, "hy": true, "hz": true, "ia": true, "id": true, "ie": true,
+	"ig": true, "ii": true, "ik": true, "io": true, "is": true, "it": true,
+	"iu": true, "ja": true, "jv": true, "ka": true, "kg": true, "ki": true,
+	"kj": true, "kk": true, "kl": true, "km": true, "kn": true, "ko": true,
+	"kr": true, "ks": true, "ku": true, "kv": true, "kw": true, "ky": true,
+	"la": true, "lb": true, "lg": true, "li": true, "ln": true, "lo": true,
+	"lt": true, "lu": true, "lv": true, "mg": true, "mh": true, "mi": true,
+	"mk": true, "ml": true, "mn": true, "mr": true, "ms": true, "mt": true,
+	"my": true, "na": true, "nb": true, "nd": true, "ne": true, "ng": true,
+	"nl": true, "nn": true, "no": true, "nr": true, "nv": true, "ny": true,
+	"oc": true, "oj": true, "om": true, "or": true, "os": true, "pa": true,
+	"pi": true, "pl": true, "ps": true, "pt": true, "qu": true, "rm": true,
+	"rn": true, "ro": true, "ru": true, "rw": true, "sa": true, "sc": true,
+	"sd": true, "se": true, "sg": true, "si": true, "sk": true, "sl": true,
+	"sm": true, "sn": true, "so": true, "sq": true, "sr": true, "ss": true,
+	"st": true, "su": true, "sv": true, "sw": true, "ta": true, "te": true,
+	"tg": true, "th": true, "ti": true, "tk": true, "tl": true, "tn": true,
+	"to": true, "tr": true, "ts": true, "tt": true, "tw": true, "ty": true,
+	"ug": true, "uk": true, "ur": true, "uz": true, "ve": true, "vi": true,
+	"vo": true, "wa": true, "wo": true, "xh": true, "yi": true, "yo": true,
+	"za": true, "zh": true, "zu": true,
+}
+
+// DefaultTemplateLocale is the locale used when a template has no variant for the requested one.
+const DefaultTemplateLocale = "en"
+
+// TemplateExt is the extension of template files.
+const TemplateExt = ".tmpl"
+
+// Templates is a set of named message templates with per-locale variants.
+//
+// Template files are named "<name>.<locale>.tmpl", e.g. "greeting.ru.tmpl".
+// A file without a locale ("greeting.tmpl") is used as the last fallback.
+// The locale is the last dotted segment before ".tmpl" and must be an
+// ISO 639-1 language code with an optional region, so "alert.new.tmpl" and
+// "status.ok.tmpl" are the fallback variants of "alert.new" and "status.ok".
+// Files in subdirectories are named by their path, e.g. "billing/status".
+// Locales fall back from "ru-RU" to "ru", then to DefaultLocale.
+type Templates struct {
+	// DefaultLocale is the fallback locale.
+	DefaultLocale string
+	// ChatLinkFormat formats chat links from the chat ID (%[1]d) and title (%[2]s).
+	// Set it to a Markdown link to the chat in your installation.
+	ChatLinkFormat string
+
+	mu sync.RWMutex
+	// templates maps a name to its variants by locale
+	templates map[string]map[string]*template.Template
+	funcs     template.FuncMap
+}
+
+// NewTemplates creates an empty template set.
+func NewTemplates() *Templates {
+	t := &Templates{
+		DefaultLocale:  DefaultTemplateLocale,
+		ChatLinkFormat: "%[2]s",
+		templates:      make(map[string]map[string]*template.Template),
+	}
+	t.funcs = template.FuncMap{
+		"plural":   PluralRu,
+		"pluralEn": PluralEn,
+		"mention":  mentionFunc,
+		"chatLink": t.chatLink,
+		"time":     formatTimeFunc,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"join":     strings.Join,
+	}
+	return t
+}
+
+// LoadTemplates loads all template files from the file system, e.g. an embed.FS.
+// The funcs are added before the files are parsed, so the files can use them.
+func LoadTemplates(fsys fs.FS, funcs ...template.FuncMap) (*Templates, error) {
+	t := NewTemplates()
+	for _, fm := range funcs {
+		t.Funcs(fm)
+	}
+
+	err := fs.WalkDir(fsys, ".", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(filePath, TemplateExt) {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", filePath, err)
+		}
+
+		name, locale := splitTemplateFileName(filePath)
+		if t.has(name, locale) {
+			return fmt.Errorf("duplicate template %s in %s", templateKey(name, locale), filePath)
+		}
+		return t.Add(name, locale, string(data))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// LoadTemplatesDir loads all template files from a directory.
+// The funcs are added before the files are parsed, so the files can use them.
+func LoadTemplatesDir(dir string, funcs ...template.FuncMap) (*Templates, error) {
+	return LoadTemplates(os.DirFS(dir), funcs...)
+}
+
+// Add parses and registers a template variant. An empty locale registers the fallback variant.
+func (t *Templates) Add(name, locale, text string) error {
+	locale = normalizeLocale(locale)
+	key := templateKey(name, locale)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tmpl, err := template.New(key).Funcs(t.funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", key, err)
+	}
+
+	if t.templates[name] == nil {
+		t.templates[name] = make(map[string]*template.Template)
+	}
+	t.templates[name][locale] = tmpl
+	return nil
+}
+
+// Funcs adds helper functions available to templates added afterwards.
+// Pass the functions to LoadTemplates to use them in the loaded files.
+func (t *Templates) Funcs(funcs template.FuncMap) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, fn := range funcs {
+		t.funcs[name] = fn
+	}
+}
+
+// has checks if the template variant exists.
+func (t *Templates) has(name, locale string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	_, ok := t.templates[name][normalizeLocale(locale)]
+	return ok
+}
+
+// Has checks if a template with the name exists in any locale.
+func (t *Templates) Has(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return len(t.templates[name]) > 0
+}
+
+// Render executes the template for the locale with the data.
+func (t *Templates) Render(name, locale string, data interface{}) (string, error) {
+	tmpl := t.lookup(name, locale)
+	if tmpl == nil {
+		return "", fmt.Errorf("template %q not found", name)
+	}
+
+	var result bytes.Buffer
+	if err := tmpl.Execute(&result, data); err != nil {
+		return "", fmt.Errorf("failed to render template %q: %w", name, err)
+	}
+
+	return strings.TrimSpace(result.String()), nil
+}
+
+// lookup finds the best variant of the template for the locale.
+func (t *Templates) lookup(name, locale string) *template.Template {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, candidate := range localeFallbacks(locale, t.DefaultLocale) {
+		if tmpl, ok := t.templates[name][candidate]; ok {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+func (t *Templates) chatLink(chatID int64, title string) string {
+	if title == "" {
+		title = fmt.Sprintf("#%d", chatID)
+	}
+	return fmt.Sprintf(t.ChatLinkFormat, chatID, title)
+}
+
+// SetTemplates sets the templates used by SendTemplate and ReplyTemplate.
+func (c *Client) SetTemplates(templates *Templates) {
+	c.templates = templates
+}
+
+// Templates returns the client templates.
+func (c *Client) Templates() *Templates {
+	return c.templates
+}
+
+// SendTemplate renders a template and sends it to a non-private chat.
+//
+// API: POST /bot/message
+func (c *Client) SendTemplate(chatID int64, name string, data interface{}, locale string) (*MessageResponse, error) {
+	text, err := c.renderTemplate(name, data, locale)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendMessage(chatID, text, nil)
+}
+
+// SendPrivateTemplate renders a template and sends it as a private message.
+//
+// API: POST /msg/post/private
+func (c *Client) SendPrivateTemplate(userID int64, name string, data interface{}, locale string) (*PrivateMessageResponse, error) {
+	text, err := c.renderTemplate(name, data, locale)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendPrivateMessageByID(userID, text, nil)
+}
+
+// ReplyTemplate renders a template and sends it as a reply to the request.
+//
+// API: POST /bot/message
+func (c *Client) ReplyTemplate(req *BotRequest, name string, data interface{}, locale string) (*MessageResponse, error) {
+	text, err := c.renderTemplate(name, data, locale)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendReply(req.ChatID, req.PostNo, text)
+}
+
+func (c *Client) renderTemplate(name string, data interface{}, locale string) (string, error) {
+	if c.templates == nil {
+		return "", fmt.Errorf("templates are not configured")
+	}
+	return c.templates.Render(name, locale, data)
+}
+
+// PluralRu selects the Russian plural form for n: one (1, 21), few (2-4, 22-24) or many (5-20, 25).
+func PluralRu(n interface{}, one, few, many string) string {
+	value := toInt64(n)
+	if value < 0 {
+		value = -value
+	}
+
+	mod10 := value % 10
+	mod100 := value % 100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return one
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return few
+	default:
+		return many
+	}
+}
+
+// PluralEn selects the English plural form for n.
+func PluralEn(n interface{}, one, other string) string {
+	if toInt64(n) == 1 {
+		return one
+	}
+	return other
+}
+
+func mentionFunc(user interface{}) string {
+	switch u := user.(type) {
+	case *User:
+		return "@" + u.UniqueName
+	case User:
+		return "@" + u.UniqueName
+	case string:
+		return "@" + normalizeMention(u)
+	default:
+		return fmt.Sprintf("@%v", u)
+	}
+}
+
+// formatTimeFunc formats a time with a layout, "02.01.2006 15:04" by default.
+func formatTimeFunc(value time.Time, layout ...string) string {
+	if len(layout) > 0 && layout[0] != "" {
+		return value.Format(layout[0])
+	}
+	return value.Format("02.01.2006 15:04")
+}
+
+func toInt64(n interface{}) int64 {
+	switch v := n.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// splitTemplateFileName returns the template name and locale of a file
+// path relative to the template root.
+func splitTemplateFileName(filePath string) (string, string) {
+	base := strings.TrimSuffix(filePath, TemplateExt)
+	dot := strings.LastIndex(base, ".")
+	if dot < 0 || dot < strings.LastIndex(base, "/") || !isLocale(base[dot+1:]) {
+		return base, ""
+	}
+	return base[:dot], base[dot+1:]
+}
+
+// isLocale reports whether the segment is a known language code with an
+// optional region.
+func isLocale(segment string) bool {
+	match := localePattern.FindStringSubmatch(segment)
+	return match != nil && languageCodes[strings.ToLower(match[1])]
+}
+
+func templateKey(name, locale string) string {
+	if locale == "" {
+		return name
+	}
+	return name + "." + locale
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// localeFallbacks returns the locales to try in order, ending with the fallback variant.
+func localeFallbacks(locale, defaultLocale string) []string {
+	var result []string
+	add := func(candidate string) {
+		for _, existing := range result {
+			if existing == candidate {
+				return
+			}
+		}
+		result = append(result, candidate)
+	}
+
+	for _, l := range []string{normalizeLocale(locale), normalizeLocale(defaultLocale)} {
+		if l == "" {
+			continue
+		}
+		add(l)
+		if dash := strings.Index(l, "-"); dash > 0 {
+			add(l[:dash])
+		}
+	}
+	add("")
+	return result
+}
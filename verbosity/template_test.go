@@ -0,0 +1,169 @@
+package verbosity
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"text/template"
+	"time"
+)
+
+func testTemplates(t *testing.T) *Templates {
+	t.Helper()
+	fsys := fstest.MapFS{
+		"templates/greeting.en.tmpl": {Data: []byte(`Hello, {{mention .User}}! You have {{.Count}} {{pluralEn .Count "task" "tasks"}}.`)},
+		"templates/greeting.ru.tmpl": {Data: []byte(`Привет, {{mention .User}}! У вас {{.Count}} {{plural .Count "задача" "задачи" "задач"}}.`)},
+		"templates/deadline.tmpl":    {Data: []byte(`Deadline: {{time .At}}`)},
+		"templates/readme.md":        {Data: []byte(`ignored`)},
+	}
+
+	root, err := fs.Sub(fsys, "templates")
+	if err != nil {
+		t.Fatalf("fs.Sub should not return error: %v", err)
+	}
+	templates, err := LoadTemplates(root)
+	if err != nil {
+		t.Fatalf("LoadTemplates should not return error: %v", err)
+	}
+	return templates
+}
+
+func TestTemplatesRenderWithFallback(t *testing.T) {
+	templates := testTemplates(t)
+	data := map[string]interface{}{"User": "john", "Count": 5}
+
+	tests := []struct {
+		locale   string
+		expected string
+	}{
+		{"ru", "Привет, @john! У вас 5 задач."},
+		{"ru-RU", "Привет, @john! У вас 5 задач."},
+		{"en", "Hello, @john! You have 5 tasks."},
+		{"de", "Hello, @john! You have 5 tasks."},
+		{"", "Hello, @john! You have 5 tasks."},
+	}
+
+	for _, test := range tests {
+		text, err := templates.Render("greeting", test.locale, data)
+		if err != nil {
+			t.Errorf("Render(%q) should not return error: %v", test.locale, err)
+			continue
+		}
+		if text != test.expected {
+			t.Errorf("Render(%q) = %q, expected %q", test.locale, text, test.expected)
+		}
+	}
+
+	at := time.Date(2024, 3, 8, 10, 30, 0, 0, time.UTC)
+	text, err := templates.Render("deadline", "ru", map[string]interface{}{"At": at})
+	if err != nil || text != "Deadline: 08.03.2024 10:30" {
+		t.Errorf("Unexpected fallback template result %q, %v", text, err)
+	}
+
+	if _, err := templates.Render("missing", "en", nil); err == nil {
+		t.Error("Render should return error for missing template")
+	}
+}
+
+func TestPluralRu(t *testing.T) {
+	tests := map[int]string{
+		0: "задач", 1: "задача", 2: "задачи", 4: "задачи", 5: "задач",
+		11: "задач", 12: "задач", 14: "задач", 21: "задача", 22: "задачи", 111: "задач", 101: "задача",
+	}
+	for n, expected := range tests {
+		if form := PluralRu(n, "задача", "задачи", "задач"); form != expected {
+			t.Errorf("PluralRu(%d) = %q, expected %q", n, form, expected)
+		}
+	}
+}
+
+func TestReplyTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SendMessageRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Text != "Привет, @anna! У вас 1 задача." {
+			t.Errorf("Unexpected text '%s'", req.Text)
+		}
+		if req.ReplyNo == nil || *req.ReplyNo != 9 {
+			t.Errorf("Expected reply to post 9, got %v", req.ReplyNo)
+		}
+		json.NewEncoder(w).Encode(MessageResponse{PostNo: 10})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+
+	req := &BotRequest{ChatID: 1, PostNo: 9}
+	if _, err := client.ReplyTemplate(req, "greeting", nil, "ru"); err == nil {
+		t.Error("ReplyTemplate should return error without templates")
+	}
+
+	client.SetTemplates(testTemplates(t))
+	data := map[string]interface{}{"User": "anna", "Count": 1}
+	if _, err := client.ReplyTemplate(req, "greeting", data, "ru"); err != nil {
+		t.Errorf("ReplyTemplate should not return error: %v", err)
+	}
+}
+
+func TestLoadTemplatesWithFuncs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"alert.tmpl":        {Data: []byte(`{{shout .}}`)},
+		"alert.new.tmpl":    {Data: []byte(`new {{.}}`)},
+		"alert.new.ru.tmpl": {Data: []byte(`новое {{.}}`)},
+	}
+
+	templates, err := LoadTemplates(fsys, template.FuncMap{"shout": func(s string) string { return s + "!" }})
+	if err != nil {
+		t.Fatalf("LoadTemplates should not return error: %v", err)
+	}
+
+	if text, err := templates.Render("alert", "en", "disk full"); err != nil || text != "disk full!" {
+		t.Errorf("Unexpected result %q, %v", text, err)
+	}
+	if text, err := templates.Render("alert.new", "de", "ticket"); err != nil || text != "new ticket" {
+		t.Errorf("Expected 'new' to be part of the name, got %q, %v", text, err)
+	}
+	if text, err := templates.Render("alert.new", "ru", "тикет"); err != nil || text != "новое тикет" {
+		t.Errorf("Unexpected result %q, %v", text, err)
+	}
+
+	templates = NewTemplates()
+	templates.Add("alert.new", "", "new")
+	if templates.Has("alert") {
+		t.Error("Has should not match templates by prefix")
+	}
+	if !templates.Has("alert.new") {
+		t.Error("Has should find the template")
+	}
+}
+
+func TestLoadTemplatesSubdirectoriesAndLocales(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/status.tmpl":    {Data: []byte(`a`)},
+		"b/status.tmpl":    {Data: []byte(`b`)},
+		"b/status.ru.tmpl": {Data: []byte(`б`)},
+		"status.ok.tmpl":   {Data: []byte(`ok`)},
+	}
+
+	templates, err := LoadTemplates(fsys)
+	if err != nil {
+		t.Fatalf("LoadTemplates should not return error: %v", err)
+	}
+	for name, expected := range map[string]string{"a/status": "a", "b/status": "b", "status.ok": "ok"} {
+		if text, err := templates.Render(name, "en", nil); err != nil || text != expected {
+			t.Errorf("Render(%q) = %q, %v, expected %q", name, text, err, expected)
+		}
+	}
+	if text, _ := templates.Render("b/status", "ru", nil); text != "б" {
+		t.Errorf("Expected the ru variant, got %q", text)
+	}
+
+	fsys["b/status.RU.tmpl"] = &fstest.MapFile{Data: []byte(`дубль`)}
+	if _, err := LoadTemplates(fsys); err == nil {
+		t.Error("Expected error for a duplicate template")
+	}
+}
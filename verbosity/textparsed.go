@@ -0,0 +1,223 @@
+package verbosity
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// BlockHashtag is the text block type of hashtags.
+const BlockHashtag = "hashtag"
+
+var hashtagPattern = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_]+)`)
+
+// Mentions returns all mention blocks of the message.
+func (r *BotRequest) Mentions() []TextBlock {
+	return r.blocksOfType(BlockMention)
+}
+
+// MentionedNames returns the unique names of all mentioned users.
+func (r *BotRequest) MentionedNames() []string {
+	var names []string
+	for _, block := range r.Mentions() {
+		if name := normalizeMention(block.Value); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IsMentioned checks if the user with the unique name is mentioned in the message.
+func (r *BotRequest) IsMentioned(uniqueName string) bool {
+	name := normalizeMention(uniqueName)
+	if name == "" {
+		return false
+	}
+	for _, mentioned := range r.MentionedNames() {
+		if strings.EqualFold(mentioned, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MentionedUserIDs returns the IDs of all users mentioned in the request.
+// Mentions without a user ID are resolved by unique name through the users API.
+func (c *Client) MentionedUserIDs(r *BotRequest) ([]int64, error) {
+	var ids []int64
+	var names []string
+	seen := map[int64]bool{}
+
+	for _, block := range r.Mentions() {
+		if block.UserID != 0 {
+			if !seen[block.UserID] {
+				seen[block.UserID] = true
+				ids = append(ids, block.UserID)
+			}
+			continue
+		}
+		if name := normalizeMention(block.Value); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return ids, nil
+	}
+
+	users, err := c.GetUsersByUniqueNames(names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+	for _, user := range users.Users {
+		if !seen[user.ID] {
+			seen[user.ID] = true
+			ids = append(ids, user.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// Links returns the URLs of all links in the message.
+func (r *BotRequest) Links() []string {
+	var links []string
+	for _, block := range r.blocksOfType(BlockLink) {
+		if block.URL != "" {
+			links = append(links, block.URL)
+		} else {
+			links = append(links, block.Value)
+		}
+	}
+	return links
+}
+
+// Hashtags returns all hashtags of the message without the leading '#'.
+func (r *BotRequest) Hashtags() []string {
+	var tags []string
+	seen := map[string]bool{}
+	add := func(tag string) {
+		tag = strings.TrimPrefix(tag, "#")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	for _, block := range r.TextParsed {
+		switch block.Type {
+		case BlockHashtag:
+			add(block.Value)
+		case BlockText:
+			for _, match := range hashtagPattern.FindAllStringSubmatch(block.Value, -1) {
+				add(match[1])
+			}
+		}
+	}
+
+	if len(r.TextParsed) == 0 {
+		for _, match := range hashtagPattern.FindAllStringSubmatch(r.Text, -1) {
+			add(match[1])
+		}
+	}
+
+	return tags
+}
+
+// CodeBlocks returns all code blocks of the message.
+func (r *BotRequest) CodeBlocks() []TextBlock {
+	return r.blocksOfType(BlockCodeBlock)
+}
+
+// TextWithoutMention returns the message text with mentions of the user removed.
+// The text is returned unchanged if the name is empty.
+func (r *BotRequest) TextWithoutMention(uniqueName string) string {
+	name := normalizeMention(uniqueName)
+	if name == "" {
+		return r.Text
+	}
+
+	if len(r.TextParsed) == 0 {
+		pattern := regexp.MustCompile(`(?i)(^|\s)@` + regexp.QuoteMeta(name) + `\b[,:]?`)
+		return strings.Join(strings.Fields(pattern.ReplaceAllString(r.Text, " ")), " ")
+	}
+
+	var result strings.Builder
+	skipPunctuation := false
+	for _, block := range r.TextParsed {
+		value := block.Value
+		switch {
+		case block.Type == BlockMention && strings.EqualFold(normalizeMention(value), name):
+			skipPunctuation = true
+			continue
+		case block.Type == BlockMention:
+			value = "@" + normalizeMention(value)
+		case block.Type == BlockHashtag:
+			value = "#" + strings.TrimPrefix(value, "#")
+		case block.Type == BlockCodeBlock, block.Type == BlockQuote:
+			startLine(&result)
+			value = strings.TrimSuffix(value, "\n") + "\n"
+		case skipPunctuation:
+			value = strings.TrimLeft(value, ",:")
+		}
+		skipPunctuation = false
+		result.WriteString(value)
+	}
+
+	return strings.TrimSpace(result.String())
+}
+
+// CommandFor returns the command and arguments of a message addressed to the bot.
+//
+// Both "/deploy now" and "@mybot deploy now" return "/deploy" with ["now"].
+// A "/deploy@mybot" suffix is stripped from the command.
+func (r *BotRequest) CommandFor(botName string) (string, []string) {
+	name := normalizeMention(botName)
+
+	if r.IsCommand() {
+		command, args := r.GetCommand()
+		if name != "" {
+			if at := strings.LastIndex(command, "@"); at > 0 && strings.EqualFold(command[at+1:], name) {
+				command = command[:at]
+			}
+		}
+		return command, args
+	}
+
+	if name == "" || !r.startsWithMention(name) {
+		return "", nil
+	}
+
+	parts := splitCommand(r.TextWithoutMention(name))
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return "/" + strings.TrimPrefix(parts[0], "/"), parts[1:]
+}
+
+// startsWithMention checks if the message begins with a mention of the user.
+func (r *BotRequest) startsWithMention(name string) bool {
+	for _, block := range r.TextParsed {
+		if block.Type == BlockText && strings.TrimSpace(block.Value) == "" {
+			continue
+		}
+		return block.Type == BlockMention && strings.EqualFold(normalizeMention(block.Value), name)
+	}
+
+	fields := strings.Fields(r.Text)
+	return len(fields) > 0 && strings.EqualFold(strings.TrimRight(fields[0], ",:"), "@"+name)
+}
+
+func (r *BotRequest) blocksOfType(blockType string) []TextBlock {
+	var blocks []TextBlock
+	for _, block := range r.TextParsed {
+		if block.Type == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func normalizeMention(name string) string {
+	return strings.TrimPrefix(strings.TrimSpace(name), "@")
+}
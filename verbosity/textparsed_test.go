@@ -0,0 +1,116 @@
+package verbosity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBotRequestTextParsedHelpers(t *testing.T) {
+	request := &BotRequest{
+		Text: "@mybot deploy #release to prod, cc @john see https://ci.example.com",
+		TextParsed: []TextBlock{
+			{Type: BlockMention, Value: "mybot"},
+			{Type: BlockText, Value: " deploy #release to prod, cc "},
+			{Type: BlockMention, Value: "john", UserID: 42},
+			{Type: BlockText, Value: " see "},
+			{Type: BlockLink, Value: "https://ci.example.com", URL: "https://ci.example.com"},
+			{Type: BlockCodeBlock, Value: "make deploy", Lang: "sh"},
+			{Type: BlockHashtag, Value: "#ops"},
+		},
+	}
+
+	if !request.IsMentioned("@MyBot") {
+		t.Error("Expected bot to be mentioned")
+	}
+	if request.IsMentioned("other") {
+		t.Error("Expected 'other' not to be mentioned")
+	}
+
+	names := request.MentionedNames()
+	if len(names) != 2 || names[0] != "mybot" || names[1] != "john" {
+		t.Errorf("Unexpected mentioned names %v", names)
+	}
+
+	links := request.Links()
+	if len(links) != 1 || links[0] != "https://ci.example.com" {
+		t.Errorf("Unexpected links %v", links)
+	}
+
+	tags := request.Hashtags()
+	if len(tags) != 2 || tags[0] != "release" || tags[1] != "ops" {
+		t.Errorf("Unexpected hashtags %v", tags)
+	}
+
+	code := request.CodeBlocks()
+	if len(code) != 1 || code[0].Lang != "sh" {
+		t.Errorf("Unexpected code blocks %+v", code)
+	}
+
+	text := request.TextWithoutMention("mybot")
+	expected := "deploy #release to prod, cc @john see https://ci.example.com\nmake deploy\n#ops"
+	if text != expected {
+		t.Errorf("Expected text '%s', got '%s'", expected, text)
+	}
+
+	plain := &BotRequest{Text: "see you @home"}
+	if text := plain.TextWithoutMention(""); text != plain.Text {
+		t.Errorf("Expected the text unchanged for an empty name, got '%s'", text)
+	}
+}
+
+func TestClientMentionedUserIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("unames") != "anna" {
+			t.Errorf("Expected lookup of 'anna', got '%s'", r.URL.Query().Get("unames"))
+		}
+		w.Write([]byte(`{"users": [{"id": 7, "unique_name": "anna"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{APIURL: server.URL, APIToken: "test_token_1234567890123456789012"})
+	request := &BotRequest{
+		TextParsed: []TextBlock{
+			{Type: BlockMention, Value: "john", UserID: 42},
+			{Type: BlockMention, Value: "anna"},
+		},
+	}
+
+	ids, err := client.MentionedUserIDs(request)
+	if err != nil {
+		t.Fatalf("MentionedUserIDs should not return error: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 42 || ids[1] != 7 {
+		t.Errorf("Unexpected user IDs %v", ids)
+	}
+}
+
+func TestBotRequestCommandFor(t *testing.T) {
+	tests := []struct {
+		request BotRequest
+		command string
+		args    int
+	}{
+		{BotRequest{Text: "/deploy prod"}, "/deploy", 1},
+		{BotRequest{Text: "/deploy@mybot prod"}, "/deploy", 1},
+		{BotRequest{Text: "@mybot deploy prod now"}, "/deploy", 2},
+		{BotRequest{Text: "@mybot, deploy"}, "/deploy", 0},
+		{BotRequest{
+			Text: "@mybot deploy prod",
+			TextParsed: []TextBlock{
+				{Type: BlockMention, Value: "mybot"},
+				{Type: BlockText, Value: " deploy prod"},
+			},
+		}, "/deploy", 1},
+		{BotRequest{Text: "hello @mybot"}, "", 0},
+		{BotRequest{Text: "@other deploy"}, "", 0},
+	}
+
+	for _, test := range tests {
+		command, args := test.request.CommandFor("mybot")
+		if command != test.command || len(args) != test.args {
+			t.Errorf("CommandFor(%q) = %q %v, expected %q with %d args",
+				test.request.Text, command, args, test.command, test.args)
+		}
+	}
+}
@@ -110,12 +110,16 @@ type OrgSyncResponse struct {
 // MessageResponse represents the response for message sending.
 type MessageResponse struct {
 	PostNo int64 `json:"post_no"`
+	// PostNos holds the post numbers of all parts of a split message.
+	PostNos []int64 `json:"-"`
 }
 
 // PrivateMessageResponse represents the response for private message sending.
 type PrivateMessageResponse struct {
 	ChatID int64 `json:"chat_id"`
 	PostNo int64 `json:"post_no"`
+	// PostNos holds the post numbers of all parts of a split message.
+	PostNos []int64 `json:"-"`
 }
 
 // FileUploadResponse represents the response for file upload.
@@ -140,11 +144,15 @@ type ValidationErrorResponse struct {
 
 // UpdateMessageRequest represents a request to update an existing message.
 type UpdateMessageRequest struct {
-	Text        string   `json:"text,omitempty"`
-	E2E         *bool    `json:"e2e,omitempty"`
-	ReplyNo     *int64   `json:"reply_no,omitempty"`
-	Quote       *string  `json:"quote,omitempty"`
-	Attachments []string `json:"attachments,omitempty"`
+	Text string `json:"text,omitempty"`
+	// TextParsed is the structured text, sent as in POST /bot/message.
+	// Text must hold the same content, as it is used if the structure
+	// is not applied.
+	TextParsed  []interface{} `json:"text_parsed,omitempty"`
+	E2E         *bool         `json:"e2e,omitempty"`
+	ReplyNo     *int64        `json:"reply_no,omitempty"`
+	Quote       *string       `json:"quote,omitempty"`
+	Attachments []string      `json:"attachments,omitempty"`
 }
 
 // UpdateMessageResponse represents the response for message update.
@@ -153,6 +161,9 @@ type UpdateMessageResponse struct {
 	ChatID  int64  `json:"chat_id"`
 	PostNo  int64  `json:"post_no"`
 	Version *int   `json:"ver,omitempty"`
+	// PostNos holds the updated post and the replies with the rest of a
+	// split text.
+	PostNos []int64 `json:"-"`
 }
 
 // DeleteMessageResponse represents the response for message deletion.
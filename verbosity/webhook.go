@@ -0,0 +1,292 @@
+package verbosity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDeliveryTTL is how long processed webhook deliveries are remembered.
+	DefaultDeliveryTTL = 10 * time.Minute
+	// DefaultDeliveryCapacity is the maximum number of deliveries kept by the default store.
+	DefaultDeliveryCapacity = 10000
+	// DefaultMaxWebhookBodySize limits the size of incoming webhook bodies.
+	DefaultMaxWebhookBodySize = 1 << 20
+)
+
+// DeliveryStore remembers recently processed webhook deliveries.
+//
+// Implementations must be safe for concurrent use. A shared implementation
+// (e.g. backed by Redis) allows several bot replicas to suppress duplicates together.
+type DeliveryStore interface {
+	// Remember records the key for ttl and reports whether it was already present.
+	Remember(key string, ttl time.Duration) (bool, error)
+	// Forget removes the key so that the delivery can be processed again.
+	Forget(key string) error
+}
+
+// MemoryDeliveryStore is an in-process DeliveryStore bounded by capacity.
+type MemoryDeliveryStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]time.Time
+	order    []deliveryEntry
+	now      func() time.Time
+}
+
+type deliveryEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryDeliveryStore creates an in-memory delivery store holding at most capacity keys.
+func NewMemoryDeliveryStore(capacity int) *MemoryDeliveryStore {
+	if capacity <= 0 {
+		capacity = DefaultDeliveryCapacity
+	}
+	return &MemoryDeliveryStore{
+		capacity: capacity,
+		entries:  make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Remember records the key for ttl and reports whether it was already present.
+func (s *MemoryDeliveryStore) Remember(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if expires, ok := s.entries[key]; ok && now.Before(expires) {
+		return true, nil
+	}
+
+	s.evict(now)
+
+	expires := now.Add(ttl)
+	s.entries[key] = expires
+	s.order = append(s.order, deliveryEntry{key: key, expires: expires})
+	return false, nil
+}
+
+// Forget removes the key from the store.
+func (s *MemoryDeliveryStore) Forget(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// Len returns the number of remembered deliveries.
+func (s *MemoryDeliveryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// evict drops stale and expired entries, and the oldest ones while the store is full.
+func (s *MemoryDeliveryStore) evict(now time.Time) {
+	for len(s.order) > 0 {
+		entry := s.order[0]
+		expires, ok := s.entries[entry.key]
+		if !ok || !expires.Equal(entry.expires) {
+			// Forgotten or re-remembered key
+			s.order = s.order[1:]
+			continue
+		}
+		if now.Before(entry.expires) && len(s.entries) < s.capacity {
+			break
+		}
+		delete(s.entries, entry.key)
+		s.order = s.order[1:]
+	}
+}
+
+// DeliveryKey returns the idempotency key of the message delivery.
+func (r *BotRequest) DeliveryKey() string {
+	return fmt.Sprintf("message:%d:%d", r.ChatID, r.PostNo)
+}
+
+// DeliveryKey returns the idempotency key of the action delivery.
+//
+// The key includes the user, so clicks on the same button by different users
+// are not treated as duplicates.
+func (r *ActionRequest) DeliveryKey() string {
+	params := url.Values{}
+	for key, value := range r.Params {
+		params.Set(key, value)
+	}
+	return fmt.Sprintf("action:%d:%d:%d:%s?%s", r.ChatID, r.PostNo, r.UserID, r.Action, params.Encode())
+}
+
+// WebhookHandler is an http.Handler receiving bot requests from the platform.
+//
+// It verifies the X-Signature header, parses the body into a BotRequest or
+// ActionRequest and drops deliveries that were already processed.
+type WebhookHandler struct {
+	// OnMessage is called for incoming messages.
+	OnMessage func(req *BotRequest) error
+	// OnAction is called for action button callbacks.
+	OnAction func(req *ActionRequest) error
+	// Deliveries remembers processed deliveries. Nil disables replay protection.
+	Deliveries DeliveryStore
+	// DeliveryTTL is how long a processed delivery is remembered.
+	DeliveryTTL time.Duration
+	// MaxBodySize limits the size of the request body.
+	MaxBodySize int64
+	// Dispatcher, if set, processes requests asynchronously. The delivery is
+	// acknowledged as soon as the request is queued.
+	Dispatcher *Dispatcher
+	// Verifier checks the X-Signature header. Requests are rejected if it is nil.
+	Verifier *Verifier
+}
+
+// NewWebhookHandler creates a webhook handler verifying signatures with the verifier.
+func NewWebhookHandler(verifier *Verifier) *WebhookHandler {
+	return &WebhookHandler{
+		Deliveries:  NewMemoryDeliveryStore(DefaultDeliveryCapacity),
+		DeliveryTTL: DefaultDeliveryTTL,
+		MaxBodySize: DefaultMaxWebhookBodySize,
+		Verifier:    verifier,
+	}
+}
+
+// ServeHTTP handles a single webhook delivery.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.maxBodySize()+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > h.maxBodySize() {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if h.Verifier == nil || !h.Verifier.Verify(body, r.Header.Get("X-Signature")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	key, chatID, handle, err := h.parse(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.Deliveries != nil {
+		seen, err := h.Deliveries.Remember(key, h.deliveryTTL())
+		if err != nil {
+			http.Error(w, "delivery store unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if seen {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	if h.Deliveries != nil {
+		handle = h.forgetOnFailure(key, handle)
+	}
+
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.Submit(chatID, handle); err != nil {
+			if h.Deliveries != nil {
+				h.Deliveries.Forget(key)
+			}
+			http.Error(w, "queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := handle(); err != nil {
+		// The platform retries the delivery after an error response
+		http.Error(w, "failed to process request", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// forgetOnFailure wraps the handler so that the delivery key is forgotten
+// if it fails or panics. The panic is passed on.
+//
+// On the async path the platform has already got a 200 and will not retry;
+// forgetting the key only lets a later duplicate of the delivery through
+// instead of acknowledging it as handled.
+func (h *WebhookHandler) forgetOnFailure(key string, handle func() error) func() error {
+	return func() error {
+		handled := false
+		defer func() {
+			if !handled {
+				h.Deliveries.Forget(key)
+			}
+		}()
+		err := handle()
+		handled = err == nil
+		return err
+	}
+}
+
+// parse decodes the body and returns its delivery key, chat ID and a function invoking the callback.
+func (h *WebhookHandler) parse(body []byte) (string, int64, func() error, error) {
+	var probe struct {
+		Action *string `json:"action"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return "", 0, nil, fmt.Errorf("failed to parse request: %w", err)
+	}
+
+	if probe.Action != nil {
+		request, err := ParseActionRequest(body)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		return request.DeliveryKey(), request.ChatID, func() error {
+			if h.OnAction == nil {
+				return nil
+			}
+			return h.OnAction(request)
+		}, nil
+	}
+
+	request, err := ParseBotRequest(body)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return request.DeliveryKey(), request.ChatID, func() error {
+		if h.OnMessage == nil {
+			return nil
+		}
+		return h.OnMessage(request)
+	}, nil
+}
+
+func (h *WebhookHandler) deliveryTTL() time.Duration {
+	if h.DeliveryTTL <= 0 {
+		return DefaultDeliveryTTL
+	}
+	return h.DeliveryTTL
+}
+
+func (h *WebhookHandler) maxBodySize() int64 {
+	if h.MaxBodySize <= 0 {
+		return DefaultMaxWebhookBodySize
+	}
+	return h.MaxBodySize
+}
@@ -0,0 +1,170 @@
+package verbosity
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookToken = "0123456789abcdef0123bot_secret_key"
+
+func newTestWebhookHandler(t *testing.T) *WebhookHandler {
+	t.Helper()
+	verifier, err := NewVerifier(testWebhookToken)
+	if err != nil {
+		t.Fatalf("NewVerifier should not return error: %v", err)
+	}
+	return NewWebhookHandler(verifier)
+}
+
+func postWebhook(t *testing.T, handler http.Handler, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("X-Signature", signBody(t, []byte(body)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebhookHandlerDropsDuplicateMessages(t *testing.T) {
+	handler := newTestWebhookHandler(t)
+
+	calls := 0
+	handler.OnMessage = func(req *BotRequest) error {
+		calls++
+		return nil
+	}
+
+	body := `{"user_id": 1, "chat_id": 10, "post_no": 5, "text": "/deploy"}`
+	for i := 0; i < 3; i++ {
+		if code := postWebhook(t, handler, body); code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", code)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected handler to be called once, got %d", calls)
+	}
+}
+
+func TestWebhookHandlerActionKeys(t *testing.T) {
+	handler := newTestWebhookHandler(t)
+
+	var users []int64
+	handler.OnAction = func(req *ActionRequest) error {
+		users = append(users, req.UserID)
+		return nil
+	}
+
+	first := `{"user_id": 1, "chat_id": 10, "post_no": 5, "action": "vote", "params": {"option": "a"}}`
+	second := `{"user_id": 2, "chat_id": 10, "post_no": 5, "action": "vote", "params": {"option": "a"}}`
+	postWebhook(t, handler, first)
+	postWebhook(t, handler, second)
+	postWebhook(t, handler, first)
+
+	if len(users) != 2 {
+		t.Errorf("Expected 2 processed actions, got %v", users)
+	}
+}
+
+func TestWebhookHandlerRetriesFailedDelivery(t *testing.T) {
+	handler := newTestWebhookHandler(t)
+
+	calls := 0
+	handler.OnMessage = func(req *BotRequest) error {
+		calls++
+		if calls == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}
+
+	body := `{"user_id": 1, "chat_id": 10, "post_no": 6, "text": "hi"}`
+	if code := postWebhook(t, handler, body); code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", code)
+	}
+	if code := postWebhook(t, handler, body); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	if calls != 2 {
+		t.Errorf("Expected handler to be called twice, got %d", calls)
+	}
+}
+
+func TestWebhookHandlerForgetsPanickedDelivery(t *testing.T) {
+	handler := newTestWebhookHandler(t)
+
+	calls := 0
+	handler.OnMessage = func(req *BotRequest) error {
+		calls++
+		if calls == 1 {
+			panic("temporary failure")
+		}
+		return nil
+	}
+
+	body := `{"user_id": 1, "chat_id": 10, "post_no": 7, "text": "hi"}`
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Panic should be passed on to net/http")
+			}
+		}()
+		postWebhook(t, handler, body)
+	}()
+	if code := postWebhook(t, handler, body); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	if calls != 2 {
+		t.Errorf("Expected the redelivery to be processed, got %d calls", calls)
+	}
+}
+
+func TestWebhookHandlerRejectsInvalidSignature(t *testing.T) {
+	handler := newTestWebhookHandler(t)
+	handler.OnMessage = func(req *BotRequest) error {
+		t.Error("Handler should not be called")
+		return nil
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"chat_id": 1}`))
+	req.Header.Set("X-Signature", "invalid")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestMemoryDeliveryStore(t *testing.T) {
+	store := NewMemoryDeliveryStore(2)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	if seen, _ := store.Remember("a", time.Minute); seen {
+		t.Error("Expected key 'a' to be new")
+	}
+	if seen, _ := store.Remember("a", time.Minute); !seen {
+		t.Error("Expected key 'a' to be seen")
+	}
+
+	// Capacity is enforced by evicting the oldest key
+	store.Remember("b", time.Minute)
+	store.Remember("c", time.Minute)
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 keys, got %d", store.Len())
+	}
+	if seen, _ := store.Remember("a", time.Minute); seen {
+		t.Error("Expected key 'a' to be evicted")
+	}
+
+	// Expired keys are not reported as seen
+	now = now.Add(2 * time.Minute)
+	if seen, _ := store.Remember("c", time.Minute); seen {
+		t.Error("Expected key 'c' to be expired")
+	}
+}